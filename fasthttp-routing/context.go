@@ -5,12 +5,16 @@
 package routing
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/newacorn/fasthttp"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"helpers/unsafefn"
 	"helpers/utilnet"
 )
@@ -22,8 +26,10 @@ type XFFInfo interface {
 	Port(ctx *Ctx)
 	IP(ctx *Ctx)
 	Secure(ctx *Ctx)
+	Prefix(ctx *Ctx)
 }
 type App struct {
+	// Log 为请求日志的父日志器，Ctx.Log 在没有请求级日志器时返回它
 	Log *zerolog.Logger
 }
 
@@ -46,15 +52,23 @@ type Ctx struct {
 	RIP   []byte
 	RPort int
 	RHost []byte
+	// RPrefix 受信任代理转发时的路径前缀（X-Forwarded-Prefix），见 Prefix
+	RPrefix []byte
 
 	router   *Router
 	pnames   []string               // list of route parameter names
 	pvalues  []string               // list of parameter values corresponding to pnames
+	hnames   []string               // list of host parameter names
+	hvalues  []string               // list of host parameter values corresponding to hnames
+	stores   map[string]routeStore  // the stores of the host matching the request
 	data     map[string]interface{} // data items managed by Get and Set
 	index    int                    // the index of the currently executing handler in handlers
 	handlers []Handler              // the handlers associated with the current route
 	route    *Route
 	bytes    []byte
+	log      *zerolog.Logger // the per-request logger set by SetLog
+	ctx      context.Context // the context set by SetContext
+	timedOut atomic.Bool     // whether TimeoutErrorWithResponse has been called
 }
 
 // Router returns the Router that is handling the incoming HTTP request.
@@ -65,7 +79,107 @@ func (c *Ctx) Route() *Route {
 	return c.route
 }
 
+// Meta returns the named metadata item of the route matching the request.
+// Nil is returned if no route matches or the route has no such item.
+func (c *Ctx) Meta(key string) any {
+	if c.route == nil {
+		return nil
+	}
+	return c.route.meta[key]
+}
+
+// Log returns the logger of the request. It is the logger set by SetLog, e.g. by the accesslog
+// middleware with the request ID and other request fields, or else the logger of the App,
+// or else the global zerolog logger.
+func (c *Ctx) Log() *zerolog.Logger {
+	if c.log != nil {
+		return c.log
+	}
+	if c.App != nil && c.App.Log != nil {
+		return c.App.Log
+	}
+	return &log.Logger
+}
+
+// SetLog sets the logger returned by Log for the rest of the request.
+func (c *Ctx) SetLog(l *zerolog.Logger) {
+	c.log = l
+}
+
+// Context returns the context of the request. It is the context set by SetContext, e.g. by the timeout
+// middleware with the deadline of the request, or else the RequestCtx, which is only cancelled when the
+// server shuts down. Values of both are looked up in the user values of the request.
+func (c *Ctx) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return c.RequestCtx
+}
+
+// SetContext sets the context returned by Context for the rest of the request.
+func (c *Ctx) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+// TimeoutErrorWithResponse sends resp to the client instead of c.Response, see
+// fasthttp.RequestCtx.TimeoutErrorWithResponse, and marks the request as timed out.
+// Handlers still running in other goroutines may keep using c, which is then not reused.
+func (c *Ctx) TimeoutErrorWithResponse(resp *fasthttp.Response) {
+	c.RequestCtx.TimeoutErrorWithResponse(resp)
+	c.timedOut.Store(true)
+}
+
+// TimeoutErrorWithCode sends a response with msg and statusCode, see TimeoutErrorWithResponse.
+func (c *Ctx) TimeoutErrorWithCode(msg string, statusCode int) {
+	var resp fasthttp.Response
+	resp.SetStatusCode(statusCode)
+	resp.SetBodyString(msg)
+	c.TimeoutErrorWithResponse(&resp)
+}
+
+// TimeoutError sends a 408 response with msg, see TimeoutErrorWithResponse.
+func (c *Ctx) TimeoutError(msg string) {
+	c.TimeoutErrorWithCode(msg, StatusRequestTimeout)
+}
+
+// TimedOut reports whether TimeoutErrorWithResponse has been called. Once the request timed out,
+// handlers which did not finish in time may still be writing c.Response, so middlewares must
+// not use it after Next returns, and should look at FinalResponse instead.
+func (c *Ctx) TimedOut() bool {
+	return c.timedOut.Load()
+}
+
+// FinalResponse returns the response sent to the client: the response given to
+// TimeoutErrorWithResponse if the request timed out, or else c.Response.
+func (c *Ctx) FinalResponse() *fasthttp.Response {
+	if c.TimedOut() {
+		return c.LastTimeoutErrorResponse()
+	}
+	return &c.Response
+}
+
+// HandleError handles err the way the router handles errors returned by the handler chain,
+// with Router.ErrorHandler. Middlewares call it to observe the final response of a failed request.
+func (c *Ctx) HandleError(err error) {
+	c.router.handleError(c, err)
+}
+
+// Params returns the path and host parameters of the current request as a map.
+// Unlike the values returned by Param, which refer to the request buffer,
+// the values are copied and remain valid after the request is handled.
+func (c *Ctx) Params() map[string]string {
+	params := make(map[string]string, len(c.pnames)+len(c.hnames))
+	for i, n := range c.hnames {
+		params[n] = strings.Clone(c.hvalues[i])
+	}
+	for i, n := range c.pnames {
+		params[n] = strings.Clone(c.pvalues[i])
+	}
+	return params
+}
+
 // Param returns the named parameter value that is found in the URL path matching the current route.
+// Parameters of the host pattern (see Router.Host) are looked up when the path has no such parameter.
 // If the named parameter cannot be found, an empty string will be returned.
 func (c *Ctx) Param(name string) string {
 	for i, n := range c.pnames {
@@ -73,6 +187,11 @@ func (c *Ctx) Param(name string) string {
 			return c.pvalues[i]
 		}
 	}
+	for i, n := range c.hnames {
+		if n == name {
+			return c.hvalues[i]
+		}
+	}
 	return ""
 }
 func (c *Ctx) Host() (host []byte) {
@@ -154,6 +273,17 @@ func (c *Ctx) Secure() (secure bool) {
 	}
 	return c.IsTLS()
 }
+
+// Prefix returns the path prefix under which a trusted proxy exposes the application, from its
+// X-Forwarded-Prefix header, e.g. "/app" when the proxy forwards "/app/users" as "/users". It is
+// empty without the xff middleware, or when the header is not trusted or absent. URL prepends it
+// to the URLs it builds.
+func (c *Ctx) Prefix() (prefix []byte) {
+	if c.XFFInfo != nil && len(c.RPrefix) == 0 {
+		c.XFFInfo.Prefix(c)
+	}
+	return c.RPrefix
+}
 func (c *Ctx) Proto() (proto string) {
 	if c.Secure() {
 		return HTTPS
@@ -180,12 +310,17 @@ func (c *Ctx) Set(name string, value interface{}) {
 // Next is normally used when a handler needs to do some postprocessing after the rest of the handlers
 // are executed.
 // 即使 Ctx.Next 不被调用，剩余的handler也可以被访问，除非直接返回不为nil的err或者调用Ctx.Abort方法。
+// Once the request timed out (see TimedOut), the following handlers are skipped as well.
 func (c *Ctx) Next() error {
 	c.index++
 	for n := len(c.handlers); c.index < n; c.index++ {
 		if err := c.handlers[c.index](c); err != nil {
 			return err
 		}
+		if c.TimedOut() {
+			// the rest of the chain may still be running in another goroutine, which owns c.index
+			return nil
+		}
 	}
 	return nil
 }
@@ -210,9 +345,14 @@ func (c *Ctx) Abort() {
 // If a parameter in the route is not provided a value, the parameter token will remain in the resulting URL.
 // Parameter values will be properly URL encoded.
 // The method returns an empty string if the URL creation fails.
+// The URL is preceded by the path prefix of the proxy forwarding the request, see Prefix.
 func (c *Ctx) URL(route string, pairs ...interface{}) string {
 	if r := c.router.routes[route]; r != nil {
-		return r.URL(pairs...)
+		u := r.URL(pairs...)
+		if prefix := c.Prefix(); len(prefix) != 0 && u != "" {
+			return string(prefix) + u
+		}
+		return u
 	}
 	return ""
 }
@@ -233,10 +373,21 @@ func (c *Ctx) init(ctx *fasthttp.RequestCtx) {
 	c.RequestCtx = ctx
 	c.index = -1
 	c.Serialize = Serialize
+	c.App = c.router.App
 }
 func (c *Ctx) clear() {
+	c.XFFInfo = nil
+	c.RSecure = PROTOUNKNOW
+	c.RIP = c.RIP[:0]
+	c.RPort = 0
+	c.RHost = c.RHost[:0]
+	c.RPrefix = c.RPrefix[:0]
 	c.data = nil
+	c.log = nil
+	c.ctx = nil
 	c.route = nil
+	c.hnames = nil
+	c.stores = nil
 }
 
 // Serialize converts the given data into a byte array.
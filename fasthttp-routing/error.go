@@ -4,7 +4,16 @@
 
 package routing
 
-import "net/http"
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+
+	"helpers/unsafefn"
+)
 
 // HTTPError represents an HTTP error with HTTP status code and error message
 type HTTPError interface {
@@ -17,6 +26,9 @@ type HTTPError interface {
 type HttpError struct {
 	Status  int    `json:"status" xml:"status"`
 	Message string `json:"message" xml:"message"`
+	// Internal is the underlying cause of the error. It is logged by the error renderers
+	// but never sent to the client.
+	Internal error `json:"-" xml:"-"`
 }
 
 // NewHTTPError creates a new HttpError instance.
@@ -24,9 +36,15 @@ type HttpError struct {
 // to generate the message based on the status code.
 func NewHTTPError(status int, message ...string) HTTPError {
 	if len(message) > 0 {
-		return &HttpError{status, message[0]}
+		return &HttpError{Status: status, Message: message[0]}
 	}
-	return &HttpError{status, http.StatusText(status)}
+	return &HttpError{Status: status, Message: http.StatusText(status)}
+}
+
+// WithInternal sets the underlying cause of the error and returns the error itself.
+func (e *HttpError) WithInternal(err error) *HttpError {
+	e.Internal = err
+	return e
 }
 
 // Error returns the error message.
@@ -34,7 +52,65 @@ func (e *HttpError) Error() string {
 	return e.Message
 }
 
+// Unwrap returns the underlying cause of the error.
+func (e *HttpError) Unwrap() error {
+	return e.Internal
+}
+
 // StatusCode returns the HTTP status code.
 func (e *HttpError) StatusCode() int {
 	return e.Status
 }
+
+// ErrorRendererOffers lists the content types RenderError can respond with, in order of preference
+// when the Accept header gives several of them the same quality.
+var ErrorRendererOffers = []string{MIMETextPlain, MIMEApplicationJSON, MIMEApplicationXML, MIMETextHTML}
+
+// RenderError is an error handler that can be assigned to Router.ErrorHandler.
+// It writes the error as plain text, JSON, XML or HTML according to the Accept header of the request.
+// Errors implementing HTTPError are rendered with their status code and message; any other error
+// is rendered as a generic 500 error so that its message is not leaked to the client.
+// Server errors and errors wrapping an underlying cause are logged together with the cause.
+func RenderError(c *Ctx, err error) {
+	he := toHttpError(err)
+	if he.Status >= http.StatusInternalServerError || errors.Unwrap(err) != nil {
+		c.Log().Error().Err(err).Int("status", he.Status).
+			Bytes("method", c.Method()).Bytes("path", c.Path()).Msg("request failed")
+	}
+	c.Response.ResetBody()
+	c.SetStatusCode(he.Status)
+	switch getOffer(unsafefn.BtoS(c.Request.Header.Peek(HeaderAccept)), acceptsOfferType, ErrorRendererOffers...) {
+	case MIMEApplicationJSON:
+		c.SetContentType(MIMEApplicationJSONCharsetUTF8)
+		b, _ := json.Marshal(he)
+		_, _ = c.Write(b)
+	case MIMEApplicationXML:
+		c.SetContentType(MIMEApplicationXMLCharsetUTF8)
+		b, _ := xml.Marshal(struct {
+			XMLName xml.Name `xml:"error"`
+			*HttpError
+		}{HttpError: he})
+		_, _ = c.WriteString(xml.Header)
+		_, _ = c.Write(b)
+	case MIMETextHTML:
+		c.SetContentType(MIMETextHTMLCharsetUTF8)
+		title := strconv.Itoa(he.Status) + " " + html.EscapeString(http.StatusText(he.Status))
+		c.SetBodyString("<!DOCTYPE html>\n<html><head><title>" + title + "</title></head><body><h1>" + title +
+			"</h1><p>" + html.EscapeString(he.Message) + "</p></body></html>\n")
+	default:
+		c.SetContentTypeBytes(defaultContentType)
+		c.SetBodyString(he.Message)
+	}
+}
+
+// toHttpError converts err to the status and message that are safe to show to the client.
+func toHttpError(err error) *HttpError {
+	var httpError HTTPError
+	if !errors.As(err, &httpError) {
+		return &HttpError{Status: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError)}
+	}
+	if he, ok := httpError.(*HttpError); ok {
+		return &HttpError{Status: he.Status, Message: he.Message}
+	}
+	return &HttpError{Status: httpError.StatusCode(), Message: httpError.Error()}
+}
@@ -6,9 +6,13 @@ package routing
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"net/http"
 	"testing"
 
+	"github.com/newacorn/fasthttp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,3 +28,36 @@ func TestNewHttpError(t *testing.T) {
 	s, _ := json.Marshal(e)
 	assert.Equal(t, `{"status":404,"message":"abc"}`, string(s))
 }
+
+func TestRenderError(t *testing.T) {
+	cause := errors.New("connection refused")
+	tests := []struct {
+		accept      string
+		err         error
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", NewHTTPError(http.StatusNotFound), http.StatusNotFound, MIMETextPlainCharsetUTF8, "Not Found"},
+		{"application/json", NewHTTPError(http.StatusNotFound, "no user"), http.StatusNotFound, MIMEApplicationJSONCharsetUTF8, `{"status":404,"message":"no user"}`},
+		{"application/xml", NewHTTPError(http.StatusBadRequest), http.StatusBadRequest, MIMEApplicationXMLCharsetUTF8, xml.Header + `<error><status>400</status><message>Bad Request</message></error>`},
+		{"text/html,application/xhtml+xml;q=0.9", NewHTTPError(http.StatusForbidden, "<b>no</b>"), http.StatusForbidden, MIMETextHTMLCharsetUTF8, "<!DOCTYPE html>\n<html><head><title>403 Forbidden</title></head><body><h1>403 Forbidden</h1><p>&lt;b&gt;no&lt;/b&gt;</p></body></html>\n"},
+		{"application/json", cause, http.StatusInternalServerError, MIMEApplicationJSONCharsetUTF8, `{"status":500,"message":"Internal Server Error"}`},
+		{"application/json", fmt.Errorf("load user: %w", NewError(http.StatusBadGateway, "upstream failed").WithInternal(cause)), http.StatusBadGateway, MIMEApplicationJSONCharsetUTF8, `{"status":502,"message":"upstream failed"}`},
+	}
+	for _, test := range tests {
+		router := New()
+		router.ErrorHandler = RenderError
+		err := test.err
+		router.Get("/", func(*Ctx) error { return err })
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/")
+		if test.accept != "" {
+			ctx.Request.Header.Set(HeaderAccept, test.accept)
+		}
+		router.HandleRequest(ctx)
+		assert.Equal(t, test.status, ctx.Response.StatusCode(), test.accept)
+		assert.Equal(t, test.contentType, string(ctx.Response.Header.ContentType()), test.accept)
+		assert.Equal(t, test.body, string(ctx.Response.Body()), test.accept)
+	}
+}
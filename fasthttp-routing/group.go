@@ -5,7 +5,11 @@
 package routing
 
 import (
+	"bytes"
+	"slices"
 	"strings"
+
+	"github.com/newacorn/fasthttp"
 )
 
 // RouteGroup represents a group of routes that share the same path prefix.
@@ -14,14 +18,21 @@ type RouteGroup struct {
 	router   *Router
 	handlers []Handler
 	name     string
+	// 非nil时，组内路由注册到该虚拟主机的 routeStore 中
+	host *virtualHost
+	// 与handlers按索引对应的中间件名称，未命名的中间件对应空字符串
+	handlerNames []string
+	// 组内新建路由继承的元数据
+	meta map[string]any
 }
 
 // newRouteGroup creates a new RouteGroup with the given path prefix, router, and handlers.
 func newRouteGroup(prefix string, router *Router, handlers []Handler) *RouteGroup {
 	return &RouteGroup{
-		prefix:   prefix,
-		router:   router,
-		handlers: handlers,
+		prefix:       prefix,
+		router:       router,
+		handlers:     handlers,
+		handlerNames: make([]string, len(handlers)),
 	}
 }
 func (r *RouteGroup) Name(name string) *RouteGroup {
@@ -98,14 +109,55 @@ func (r *RouteGroup) To(methods, path string, handlers ...Handler) *Route {
 // If no handler is provided, the new group will inherit the handlers registered
 // with the current group.
 func (r *RouteGroup) Group(prefix string, handlers ...Handler) *RouteGroup {
-	if len(handlers) == 0 {
+	inherit := len(handlers) == 0
+	if inherit {
 		handlers = make([]Handler, len(r.handlers))
 		copy(handlers, r.handlers)
 	}
 	r1 := newRouteGroup(r.prefix+prefix, r.router, handlers)
+	if inherit {
+		copy(r1.handlerNames, r.handlerNames)
+	}
+	r1.host = r.host
+	r1.meta = cloneMeta(r.meta)
 	r1.Name(combineNames(r.name, r1.name))
 	return r1
 }
+
+// Mount dispatches all requests under the given path prefix to handler, with the prefix
+// stripped from the request path while handler runs. Any fasthttp.RequestHandler can be mounted,
+// e.g. the HandleRequest method of another Router or the output of fasthttpadaptor.
+// The handlers of the group, and the optional handlers given here, are executed before handler.
+func (r *RouteGroup) Mount(prefix string, handler fasthttp.RequestHandler, handlers ...Handler) {
+	prefix = strings.TrimRight(prefix, "/")
+	strip := []byte(r.prefix + prefix)
+	hh := append(handlers[:len(handlers):len(handlers)], func(c *Ctx) error {
+		uri := c.Request.URI()
+		original := append([]byte(nil), uri.PathOriginal()...)
+		path := uri.Path()
+		if bytes.HasPrefix(original, strip) {
+			path = original[len(strip):]
+		} else if len(path) >= len(strip) {
+			path = path[len(strip):]
+		}
+		if len(path) == 0 {
+			path = []byte{'/'}
+		}
+		uri.SetPathBytes(path)
+		// restore the path even if handler panics, for the recovery middleware to log it
+		defer uri.SetPathBytes(original)
+		handler(c.RequestCtx)
+		return nil
+	})
+	r.Any(prefix, hh...)
+	r.Any(prefix+"/*", hh...)
+}
+
+// MountRouter mounts another Router under the given path prefix. See Mount for details.
+func (r *RouteGroup) MountRouter(prefix string, router *Router, handlers ...Handler) {
+	r.Mount(prefix, router.HandleRequest, handlers...)
+}
+
 func combineNames(names ...string) (mergedName string) {
 	for _, name := range names {
 		if name == "" {
@@ -124,4 +176,78 @@ func combineNames(names ...string) (mergedName string) {
 // These handlers will be shared by all routes belong to this group and its subgroups.
 func (r *RouteGroup) Use(handlers ...Handler) {
 	r.handlers = append(r.handlers, handlers...)
+	r.handlerNames = append(r.handlerNames, make([]string, len(handlers))...)
+}
+
+// UseNamed registers a named handler to the current route group.
+// Subgroups inherit it like any other handler, but can remove or replace it by name with Remove and Replace,
+// and a route can opt out of it with Route.Skip.
+func (r *RouteGroup) UseNamed(name string, handler Handler) {
+	r.handlers = append(r.handlers, namedHandler(name, handler))
+	r.handlerNames = append(r.handlerNames, name)
+}
+
+// UseExcept registers handlers that are skipped for the requests for which skip returns true.
+// Ctx.Route and Ctx.Meta are available to skip, e.g. to exempt the routes carrying some metadata.
+func (r *RouteGroup) UseExcept(skip Skipper, handlers ...Handler) {
+	for _, h := range handlers {
+		h := h
+		r.Use(func(c *Ctx) error {
+			if skip(c) {
+				return nil
+			}
+			return h(c)
+		})
+	}
+}
+
+// Remove removes the handlers registered with the given name by UseNamed from the current group.
+// Routes that are already added and the parent group are unaffected.
+func (r *RouteGroup) Remove(name string) {
+	for i := len(r.handlerNames) - 1; i >= 0; i-- {
+		if r.handlerNames[i] == name {
+			r.handlers = slices.Delete(r.handlers, i, i+1)
+			r.handlerNames = slices.Delete(r.handlerNames, i, i+1)
+		}
+	}
+}
+
+// Replace replaces the handlers registered with the given name by UseNamed in the current group.
+// Routes that are already added and the parent group are unaffected.
+func (r *RouteGroup) Replace(name string, handler Handler) {
+	for i := range r.handlerNames {
+		if r.handlerNames[i] == name {
+			r.handlers[i] = namedHandler(name, handler)
+		}
+	}
+}
+
+// Meta sets a metadata item that is inherited by the subgroups and the routes added to the group afterward.
+func (r *RouteGroup) Meta(key string, value any) *RouteGroup {
+	if r.meta == nil {
+		r.meta = make(map[string]any)
+	}
+	r.meta[key] = value
+	return r
+}
+
+// namedHandler wraps handler so that it is skipped for the routes that skip name.
+func namedHandler(name string, handler Handler) Handler {
+	return func(c *Ctx) error {
+		if c.route != nil && slices.Contains(c.route.skips, name) {
+			return nil
+		}
+		return handler(c)
+	}
+}
+
+func cloneMeta(meta map[string]any) map[string]any {
+	if meta == nil {
+		return nil
+	}
+	m := make(map[string]any, len(meta))
+	for k, v := range meta {
+		m[k] = v
+	}
+	return m
 }
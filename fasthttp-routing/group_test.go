@@ -6,6 +6,7 @@ package routing
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -91,3 +92,64 @@ func TestRouteGroupUse(t *testing.T) {
 	group2.Use(newHandler("3", &buf))
 	assert.Equal(t, 3, len(group2.handlers), "len(group2.handlers) =")
 }
+
+func TestRouteGroupNamedHandlers(t *testing.T) {
+	var buf bytes.Buffer
+	router := New()
+	router.UseNamed("auth", newHandler("auth.", &buf))
+	router.Use(newHandler("log.", &buf))
+	api := router.Group("/api")
+	api.Get("/users", newHandler("users.", &buf))
+	api.Get("/health", newHandler("health.", &buf)).Skip("auth")
+
+	public := api.Group("/public")
+	public.Remove("auth")
+	public.Get("/ping", newHandler("ping.", &buf))
+
+	admin := api.Group("/admin")
+	admin.Replace("auth", newHandler("admin-auth.", &buf))
+	admin.Get("/stats", newHandler("stats.", &buf))
+
+	tests := []struct {
+		path, expected string
+	}{
+		{"/api/users", "auth.log.users."},
+		{"/api/health", "log.health."},
+		{"/api/public/ping", "log.ping."},
+		{"/api/admin/stats", "admin-auth.log.stats."},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		serveRequest(router, "GET", "", test.path)
+		assert.Equal(t, test.expected, buf.String(), test.path)
+	}
+	assert.Equal(t, 2, len(router.handlers), "the router keeps its own handlers")
+}
+
+func TestRouteGroupMetaAndUseExcept(t *testing.T) {
+	var buf bytes.Buffer
+	router := New()
+	router.UseExcept(HasMeta("public", true), func(c *Ctx) error {
+		buf.WriteString("auth:" + fmt.Sprint(c.Meta("role")) + ".")
+		return nil
+	})
+	api := router.Group("/api").Meta("role", "user")
+	api.Get("/users", newHandler("users.", &buf))
+	api.Get("/stats", newHandler("stats.", &buf)).Meta("role", "admin")
+	api.Get("/ping", newHandler("ping.", &buf)).Meta("public", true)
+
+	tests := []struct {
+		path, expected string
+	}{
+		{"/api/users", "auth:user.users."},
+		{"/api/stats", "auth:admin.stats."},
+		{"/api/ping", "ping."},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		serveRequest(router, "GET", "", test.path)
+		assert.Equal(t, test.expected, buf.String(), test.path)
+	}
+	assert.Equal(t, "admin", router.Route("/api/stats").MetaValue("role"))
+	assert.Nil(t, router.Route("/api/users").MetaValue("public"))
+}
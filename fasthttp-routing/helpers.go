@@ -620,18 +620,35 @@ func isNoCache(cacheControl string) bool {
 type testConn struct {
 	r bytes.Buffer
 	w bytes.Buffer
+	// 远程地址，为空时使用 0.0.0.0:0
+	raddr net.Addr
 }
 
 func (c *testConn) Read(b []byte) (int, error)  { return c.r.Read(b) }  //nolint:wrapcheck // This must not be wrapped
 func (c *testConn) Write(b []byte) (int, error) { return c.w.Write(b) } //nolint:wrapcheck // This must not be wrapped
 func (*testConn) Close() error                  { return nil }
 
-func (*testConn) LocalAddr() net.Addr                { return &net.TCPAddr{Port: 0, Zone: "", IP: net.IPv4zero} }
-func (*testConn) RemoteAddr() net.Addr               { return &net.TCPAddr{Port: 0, Zone: "", IP: net.IPv4zero} }
+func (*testConn) LocalAddr() net.Addr { return &net.TCPAddr{Port: 0, Zone: "", IP: net.IPv4zero} }
+func (c *testConn) RemoteAddr() net.Addr {
+	if c.raddr != nil {
+		return c.raddr
+	}
+	return &net.TCPAddr{Port: 0, Zone: "", IP: net.IPv4zero}
+}
 func (*testConn) SetDeadline(_ time.Time) error      { return nil }
 func (*testConn) SetReadDeadline(_ time.Time) error  { return nil }
 func (*testConn) SetWriteDeadline(_ time.Time) error { return nil }
 
+// testTLSConn makes fasthttp.RequestCtx.IsTLS report true for requests served over it.
+type testTLSConn struct {
+	*testConn
+}
+
+func (testTLSConn) Handshake() error { return nil }
+func (testTLSConn) ConnectionState() tls.ConnectionState {
+	return tls.ConnectionState{HandshakeComplete: true}
+}
+
 func getStringImmutable(b []byte) string {
 	return string(b)
 }
@@ -719,6 +736,7 @@ const (
 	MIMEApplicationForm       = "application/x-www-form-urlencoded"
 	MIMEOctetStream           = "application/octet-stream"
 	MIMEMultipartForm         = "multipart/form-data"
+	MIMETextEventStream       = "text/event-stream"
 
 	MIMETextXMLCharsetUTF8         = "text/xml; charset=utf-8"
 	MIMETextHTMLCharsetUTF8        = "text/html; charset=utf-8"
@@ -972,6 +990,8 @@ const (
 	HeaderXDNSPrefetchControl             = "X-DNS-Prefetch-Control"
 	HeaderXPingback                       = "X-Pingback"
 	HeaderXRequestID                      = "X-Request-ID"
+	HeaderTraceparent                     = "Traceparent"
+	HeaderTracestate                      = "Tracestate"
 	HeaderXRequestedWith                  = "X-Requested-With"
 	HeaderXRobotsTag                      = "X-Robots-Tag"
 	HeaderXUACompatible                   = "X-UA-Compatible"
@@ -1136,4 +1156,12 @@ func c2b(s string) (b []byte) {
 	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
 
+// Skipper reports whether a middleware should be skipped for the request. See RouteGroup.UseExcept.
 type Skipper func(ctx *Ctx) bool
+
+// HasMeta returns a Skipper that skips the routes whose metadata item key equals value.
+func HasMeta(key string, value any) Skipper {
+	return func(ctx *Ctx) bool {
+		return ctx.Meta(key) == value
+	}
+}
@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"strings"
+
+	"helpers/unsafefn"
+	"helpers/utilnet"
+)
+
+// virtualHost keeps the routes registered through Router.Host for one host pattern.
+// 每个虚拟主机拥有独立的 请求方法 -> routeStore 映射。
+type virtualHost struct {
+	pattern string
+	// 按 '.' 分隔的主机名片段，匹配时从右向左比较
+	// "*" 只能作为最左侧片段，匹配一个或多个片段；"<name>" 匹配单个片段并作为主机参数
+	labels []string
+	// 主机参数名称，按从右向左的顺序，与匹配时收集的参数值一一对应
+	pnames []string
+	stores map[string]routeStore
+}
+
+func newVirtualHost(pattern string) *virtualHost {
+	h := &virtualHost{
+		pattern: pattern,
+		labels:  strings.Split(strings.ToLower(pattern), "."),
+		stores:  make(map[string]routeStore),
+	}
+	// labels are matched from right to left, so are the parameter values collected
+	for i := len(h.labels) - 1; i >= 0; i-- {
+		label := h.labels[i]
+		if label == "*" && i != 0 {
+			panic("routing: wildcard must be the leftmost label of host " + pattern)
+		}
+		if len(label) > 2 && label[0] == '<' && label[len(label)-1] == '>' {
+			h.pnames = append(h.pnames, label[1:len(label)-1])
+		}
+	}
+	return h
+}
+
+// match reports whether the host matches the pattern. The values of host parameters
+// are appended to pvalues in the order of pnames.
+func (h *virtualHost) match(host string, pvalues []string) ([]string, bool) {
+	j := len(host)
+	for i := len(h.labels) - 1; i >= 0; i-- {
+		label := h.labels[i]
+		if label == "*" {
+			// at least one label must remain for the wildcard
+			return pvalues, j > 0
+		}
+		if j < 0 {
+			return pvalues, false
+		}
+		k := strings.LastIndexByte(host[:j], '.')
+		part := host[k+1 : j]
+		if len(label) > 2 && label[0] == '<' && label[len(label)-1] == '>' {
+			if part == "" {
+				return pvalues, false
+			}
+			pvalues = append(pvalues, part)
+		} else if !strings.EqualFold(label, part) {
+			return pvalues, false
+		}
+		j = k
+	}
+	return pvalues, j < 0
+}
+
+// Host returns a RouteGroup whose routes are only matched for requests with the given host.
+// The pattern may start with "*." to match any subdomain, and a label in the format of "<name>"
+// matches a single label whose value can be retrieved with Ctx.Param.
+// Hosts are matched against the Host request header (without port) in the order they are registered;
+// requests that match no host are dispatched to the routes registered on the router itself.
+// If no handler is provided, the group inherits the handlers registered with the router.
+func (r *Router) Host(pattern string, handlers ...Handler) *RouteGroup {
+	var host *virtualHost
+	for _, h := range r.hosts {
+		if h.pattern == pattern {
+			host = h
+			break
+		}
+	}
+	if host == nil {
+		host = newVirtualHost(pattern)
+		r.hosts = append(r.hosts, host)
+	}
+	inherit := len(handlers) == 0
+	if inherit {
+		handlers = make([]Handler, len(r.handlers))
+		copy(handlers, r.handlers)
+	}
+	group := newRouteGroup("", r, handlers)
+	if inherit {
+		copy(group.handlerNames, r.handlerNames)
+	}
+	group.host = host
+	return group
+}
+
+// matchHost returns the stores of the virtual host matching the request.
+// The stores of the router are returned if no virtual host matches.
+func (r *Router) matchHost(c *Ctx) map[string]routeStore {
+	c.hvalues = c.hvalues[:0]
+	hostHeader := c.Request.Header.Host()
+	if len(r.hosts) == 0 || len(hostHeader) == 0 {
+		return r.stores
+	}
+	host, _, _ := utilnet.SplitIpAndPort(unsafefn.BtoS(hostHeader))
+	for _, h := range r.hosts {
+		var ok bool
+		if c.hvalues, ok = h.match(host, c.hvalues[:0]); ok {
+			c.hnames = h.pnames
+			return h.stores
+		}
+	}
+	c.hvalues = c.hvalues[:0]
+	return r.stores
+}
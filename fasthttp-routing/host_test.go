@@ -0,0 +1,152 @@
+package routing
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveRequest(r *Router, method, host, uri string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(uri)
+	ctx.Request.Header.SetHost(host)
+	r.HandleRequest(ctx)
+	return ctx
+}
+
+func writeParam(name string) Handler {
+	return func(c *Ctx) error {
+		_, err := c.WriteString(name + "=" + c.Param(name))
+		return err
+	}
+}
+
+func TestVirtualHostMatch(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		ok            bool
+		values        []string
+	}{
+		{"api.example.com", "api.example.com", true, nil},
+		{"api.example.com", "API.Example.com", true, nil},
+		{"api.example.com", "x.api.example.com", false, nil},
+		{"api.example.com", "example.com", false, nil},
+		{"*.example.com", "a.example.com", true, nil},
+		{"*.example.com", "a.b.example.com", true, nil},
+		{"*.example.com", "example.com", false, nil},
+		{"<tenant>.example.com", "acme.example.com", true, []string{"acme"}},
+		{"<tenant>.example.com", "a.acme.example.com", false, []string{"acme"}},
+		{"<tenant>.<region>.example.com", "acme.eu.example.com", true, []string{"eu", "acme"}},
+	}
+	for _, test := range tests {
+		h := newVirtualHost(test.pattern)
+		values, ok := h.match(test.host, nil)
+		assert.Equal(t, test.ok, ok, test.pattern+" matches "+test.host)
+		if ok {
+			assert.Equal(t, test.values, values, test.pattern+" values of "+test.host)
+		}
+	}
+	assert.Panics(t, func() { newVirtualHost("api.*.com") })
+}
+
+func TestRouterHost(t *testing.T) {
+	router := New()
+	router.Get("/", func(c *Ctx) error {
+		_, err := c.WriteString("default")
+		return err
+	})
+	router.Host("api.example.com").Get("/", func(c *Ctx) error {
+		_, err := c.WriteString("api")
+		return err
+	})
+	router.Host("<tenant>.example.com").Get("/users/<id>", writeParam("tenant"))
+	router.Host("<tenant>.<region>.example.net").Get("/", func(c *Ctx) error {
+		_, err := c.WriteString(c.Param("tenant") + "@" + c.Param("region"))
+		return err
+	})
+	router.Host("*.example.org").Get("/", func(c *Ctx) error {
+		_, err := c.WriteString("org")
+		return err
+	})
+
+	assert.Equal(t, "default", string(serveRequest(router, "GET", "localhost:8080", "/").Response.Body()))
+	assert.Equal(t, "api", string(serveRequest(router, "GET", "api.example.com:8080", "/").Response.Body()))
+	assert.Equal(t, "tenant=acme", string(serveRequest(router, "GET", "acme.example.com", "/users/1").Response.Body()))
+	assert.Equal(t, "acme@eu", string(serveRequest(router, "GET", "acme.eu.example.net", "/").Response.Body()))
+	assert.Equal(t, "org", string(serveRequest(router, "GET", "www.example.org", "/").Response.Body()))
+	assert.Equal(t, http.StatusNotFound, serveRequest(router, "GET", "acme.example.com", "/").Response.StatusCode())
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(router, "POST", "acme.example.com", "/users/1").Response.StatusCode())
+
+	// the same path on different hosts is not a conflict
+	assert.Nil(t, router.Validate())
+	assert.Equal(t, "api.example.com", router.Routes()[1].Host)
+}
+
+func TestRouterHostNamedHandlers(t *testing.T) {
+	var buf bytes.Buffer
+	router := New()
+	router.UseNamed("auth", newHandler("auth.", &buf))
+	router.Use(newHandler("log.", &buf))
+	public := router.Host("public.example.com")
+	public.Remove("auth")
+	public.Get("/", newHandler("public.", &buf))
+	admin := router.Host("admin.example.com")
+	admin.Replace("auth", newHandler("admin-auth.", &buf))
+	admin.Get("/", newHandler("admin.", &buf))
+
+	serveRequest(router, "GET", "public.example.com", "/")
+	assert.Equal(t, "log.public.", buf.String())
+	buf.Reset()
+	serveRequest(router, "GET", "admin.example.com", "/")
+	assert.Equal(t, "admin-auth.log.admin.", buf.String())
+}
+
+func TestRouteGroupMount(t *testing.T) {
+	sub := New()
+	sub.Get("/", func(c *Ctx) error {
+		_, err := c.WriteString("index")
+		return err
+	})
+	sub.Get("/users/<id>", writeParam("id"))
+
+	router := New()
+	var seen string
+	admin := router.Group("/admin", func(c *Ctx) error {
+		seen = string(c.Path())
+		return nil
+	})
+	admin.MountRouter("/console/", sub)
+	router.Mount("/raw", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.Path())
+	})
+
+	ctx := serveRequest(router, "GET", "", "/admin/console/users/3?x=1")
+	assert.Equal(t, "id=3", string(ctx.Response.Body()))
+	assert.Equal(t, "/admin/console/users/3", seen)
+	assert.Equal(t, "/admin/console/users/3", string(ctx.Path()), "path is restored after the mounted handler")
+	assert.Equal(t, "index", string(serveRequest(router, "GET", "", "/admin/console").Response.Body()))
+	assert.Equal(t, "index", string(serveRequest(router, "GET", "", "/admin/console/").Response.Body()))
+	assert.Equal(t, http.StatusNotFound, serveRequest(router, "GET", "", "/admin/console/nope").Response.StatusCode())
+	assert.Equal(t, "/a/b", string(serveRequest(router, "DELETE", "", "/raw/a/b").Response.Body()))
+
+	// the path is restored when the mounted handler panics
+	router = New()
+	router.Use(func(c *Ctx) (err error) {
+		defer func() {
+			if recover() != nil {
+				seen = string(c.Path())
+			}
+		}()
+		return c.Next()
+	})
+	router.Mount("/panic", func(ctx *fasthttp.RequestCtx) {
+		panic("mounted")
+	})
+	seen = ""
+	serveRequest(router, "GET", "", "/panic/a")
+	assert.Equal(t, "/panic/a", seen)
+}
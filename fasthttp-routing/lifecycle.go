@@ -0,0 +1,211 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/newacorn/fasthttp/prefork"
+	"github.com/rs/zerolog/log"
+)
+
+type ListenConfig struct {
+	// Prefork 使用 prefork 启动 GOMAXPROCS 个子进程监听同一地址，ListenUnix 不支持
+	// 主进程只负责创建子进程，OnStart/OnShutdown 钩子在子进程中执行
+	Prefork bool
+	// ShutdownTimeout 收到 SIGINT/SIGTERM 后等待进行中的请求完成的最长时间，默认 10 秒
+	ShutdownTimeout time.Duration
+	// DisableSignals 不处理 SIGINT/SIGTERM，由调用方调用 Router.Shutdown
+	DisableSignals bool
+}
+
+var DefListenCfg = ListenConfig{
+	ShutdownTimeout: 10 * time.Second,
+}
+
+// Server returns the fasthttp.Server used by Listen, ListenTLS and ListenUnix, whose Handler is the router.
+// Its options, e.g. ReadTimeout or MaxRequestBodySize, can be changed before listening.
+func (r *Router) Server() *fasthttp.Server {
+	return r.server
+}
+
+// SetServer replaces the server used by Listen, ListenTLS and ListenUnix.
+// The Handler of the server is set to the router if it is nil.
+func (r *Router) SetServer(s *fasthttp.Server) {
+	if s.Handler == nil {
+		s.Handler = r.HandleRequest
+	}
+	r.server = s
+}
+
+// OnStart registers a hook called before the server starts listening.
+// Hooks are called in registration order, and an error aborts the start and is returned by Listen.
+func (r *Router) OnStart(hook func() error) {
+	r.onStart = append(r.onStart, hook)
+}
+
+// OnShutdown registers a hook called by Shutdown after the in-flight requests are done,
+// e.g. to stop background workers or close stores. Hooks are called in the reverse order
+// of registration with the context passed to Shutdown, and their errors are joined.
+func (r *Router) OnShutdown(hook func(ctx context.Context) error) {
+	r.onShutdown = append(r.onShutdown, hook)
+}
+
+// Listen serves HTTP requests on the TCP address until the server is shut down,
+// either by Shutdown or by SIGINT/SIGTERM. It returns nil after a graceful shutdown.
+//
+//	router.OnShutdown(store.Close)
+//	if err := router.Listen(":80"); err != nil {
+//		log.Fatal(err)
+//	}
+func (r *Router) Listen(addr string, cfgs ...*ListenConfig) error {
+	cfg := listenConfig(cfgs)
+	if cfg.Prefork {
+		p := prefork.New(r.server)
+		return r.serve(cfg, func() error {
+			return p.ListenAndServe(addr)
+		})
+	}
+	return r.serve(cfg, func() error {
+		return r.server.ListenAndServe(addr)
+	})
+}
+
+// ListenTLS is like Listen, but serves HTTPS requests with the certificate and key files.
+func (r *Router) ListenTLS(addr, certFile, keyFile string, cfgs ...*ListenConfig) error {
+	cfg := listenConfig(cfgs)
+	if cfg.Prefork {
+		p := prefork.New(r.server)
+		return r.serve(cfg, func() error {
+			// the arguments of prefork are in the order of key and certificate
+			return p.ListenAndServeTLS(addr, keyFile, certFile)
+		})
+	}
+	return r.serve(cfg, func() error {
+		return r.server.ListenAndServeTLS(addr, certFile, keyFile)
+	})
+}
+
+// ListenUnix is like Listen, but serves HTTP requests on the unix socket at path, created with mode.
+// ListenConfig.Prefork is ignored.
+func (r *Router) ListenUnix(path string, mode os.FileMode, cfgs ...*ListenConfig) error {
+	cfg := *listenConfig(cfgs)
+	cfg.Prefork = false
+	return r.serve(&cfg, func() error {
+		return r.server.ListenAndServeUNIX(path, mode)
+	})
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting connections, waits for the
+// in-flight requests until ctx is done, and then calls the OnShutdown hooks.
+// Shutdown may be called more than once, later calls wait for the first one and return its result.
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.shutdownOnce.Do(func() {
+		err := r.server.ShutdownWithContext(ctx)
+		for i := len(r.onShutdown) - 1; i >= 0; i-- {
+			err = errors.Join(err, r.onShutdown[i](ctx))
+		}
+		r.shutdownErr = err
+		close(r.shutdownDone)
+	})
+	<-r.shutdownDone
+	return r.shutdownErr
+}
+
+func listenConfig(cfgs []*ListenConfig) *ListenConfig {
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		return cfgs[0]
+	}
+	return &DefListenCfg
+}
+
+// serve runs listen in the serving process, between the OnStart hooks and the shutdown.
+func (r *Router) serve(cfg *ListenConfig, listen func() error) error {
+	if cfg.Prefork && !prefork.IsChild() {
+		return r.serveMaster(cfg, listen)
+	}
+	for _, hook := range r.onStart {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+	timeout := cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefListenCfg.ShutdownTimeout
+	}
+	if !cfg.DisableSignals {
+		// register before listening, a signal must never kill the process once requests are accepted
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			defer signal.Stop(sig)
+			select {
+			case s := <-sig:
+				log.Info().Str("signal", s.String()).Msg("routing: shutting down")
+				r.shutdownWithTimeout(timeout)
+			case <-r.shutdownDone:
+			}
+		}()
+	}
+	if cfg.Prefork {
+		go r.watchMaster(timeout)
+	}
+	if err := listen(); err != nil {
+		// the OnStart hooks have run, let the OnShutdown hooks release what they acquired
+		return errors.Join(err, r.shutdownWithTimeout(timeout))
+	}
+	<-r.shutdownDone
+	return r.shutdownErr
+}
+
+func (r *Router) shutdownWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return r.Shutdown(ctx)
+}
+
+// serveMaster runs the prefork master, which only spawns and respawns the children.
+// It returns on SIGINT/SIGTERM, and the children shut down gracefully once they notice
+// the master is gone, see watchMaster.
+func (r *Router) serveMaster(cfg *ListenConfig, listen func() error) error {
+	errCh := make(chan error, 1)
+	var sig chan os.Signal
+	if !cfg.DisableSignals {
+		sig = make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+	}
+	go func() {
+		errCh <- listen()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case s := <-sig:
+		log.Info().Str("signal", s.String()).Msg("routing: prefork master exiting")
+		return nil
+	}
+}
+
+// watchMaster shuts down a prefork child when its master process exits.
+func (r *Router) watchMaster(timeout time.Duration) {
+	ppid := os.Getppid()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if os.Getppid() != ppid {
+				log.Info().Int("pid", os.Getpid()).Msg("routing: prefork master exited, shutting down")
+				r.shutdownWithTimeout(timeout)
+				return
+			}
+		case <-r.shutdownDone:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func unixClient(path string) *fasthttp.HostClient {
+	return &fasthttp.HostClient{
+		Addr: path,
+		Dial: func(addr string) (net.Conn, error) {
+			return net.Dial("unix", addr)
+		},
+	}
+}
+
+// waitServing retries a request until the server accepts connections.
+func waitServing(t *testing.T, client *fasthttp.HostClient) {
+	for i := 0; i < 100; i++ {
+		if _, _, err := client.Get(nil, "http://localhost/ping"); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server not started")
+}
+
+func TestRouterShutdown(t *testing.T) {
+	router := New()
+	started := make(chan struct{})
+	router.Get("/ping", func(c *Ctx) error {
+		return nil
+	})
+	router.Get("/slow", func(c *Ctx) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		_, err := c.WriteString("done")
+		return err
+	})
+	var calls []string
+	router.OnStart(func() error {
+		calls = append(calls, "start")
+		return nil
+	})
+	router.OnShutdown(func(ctx context.Context) error {
+		calls = append(calls, "shutdown 1")
+		return nil
+	})
+	router.OnShutdown(func(ctx context.Context) error {
+		calls = append(calls, "shutdown 2")
+		return errors.New("close store")
+	})
+
+	path := filepath.Join(t.TempDir(), "wx.sock")
+	served := make(chan error, 1)
+	go func() {
+		served <- router.ListenUnix(path, 0o600, &ListenConfig{DisableSignals: true})
+	}()
+	client := unixClient(path)
+	waitServing(t, client)
+
+	// the in-flight request completes before the hooks run
+	slow := make(chan string, 1)
+	go func() {
+		_, body, _ := client.Get(nil, "http://localhost/slow")
+		slow <- string(body)
+	}()
+	<-started
+	err := router.Shutdown(context.Background())
+	assert.EqualError(t, err, "close store")
+	assert.Equal(t, "done", <-slow)
+	assert.Equal(t, []string{"start", "shutdown 2", "shutdown 1"}, calls)
+	assert.Equal(t, err, <-served)
+	assert.Equal(t, err, router.Shutdown(context.Background()), "shut down once")
+}
+
+func TestRouterListenSignal(t *testing.T) {
+	router := New()
+	router.Get("/ping", func(c *Ctx) error {
+		return nil
+	})
+	stopped := false
+	router.OnShutdown(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	path := filepath.Join(t.TempDir(), "wx.sock")
+	served := make(chan error, 1)
+	go func() {
+		served <- router.ListenUnix(path, 0o600, &ListenConfig{ShutdownTimeout: time.Second})
+	}()
+	waitServing(t, unixClient(path))
+
+	assert.Nil(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-served:
+		assert.Nil(t, err)
+		assert.True(t, stopped)
+	case <-time.After(2 * time.Second):
+		t.Fatal("not shut down")
+	}
+}
+
+func TestRouterOnStartError(t *testing.T) {
+	router := New()
+	router.OnStart(func() error {
+		return errors.New("token")
+	})
+	err := router.ListenUnix(filepath.Join(t.TempDir(), "wx.sock"), 0o600, &ListenConfig{DisableSignals: true})
+	assert.EqualError(t, err, "token")
+}
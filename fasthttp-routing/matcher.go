@@ -0,0 +1,148 @@
+package routing
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ParamMatcher matches a route parameter without regular expression.
+// It returns the length of the prefix of s that belongs to the parameter, or -1 if s does not match.
+// Like a regular expression in "<name:pattern>", the matcher only has to match a prefix of s:
+// the rest of s is matched against the remaining part of the route.
+type ParamMatcher func(s string) int
+
+// matchers maps the names usable in "<name:matcher>" tokens to their ParamMatcher.
+var matchers = map[string]ParamMatcher{
+	"int":   matchInt,
+	"alpha": matchAlpha,
+	"alnum": matchAlnum,
+	"uuid":  matchUUID,
+	"date":  matchDate,
+}
+
+// RegisterMatcher registers a named ParamMatcher that can be used in route paths, e.g.
+// RegisterMatcher("hex", fn) makes "/colors/<c:hex>" match parameters with fn.
+// A pattern that is the name of a matcher is never compiled as a regular expression.
+// RegisterMatcher is not safe for concurrent use and should be called before routes are added.
+func RegisterMatcher(name string, matcher ParamMatcher) {
+	matchers[name] = matcher
+}
+
+// matchInt matches an optionally negative decimal integer: -?[0-9]+
+func matchInt(s string) int {
+	i := 0
+	if len(s) > 0 && s[0] == '-' {
+		i++
+	}
+	j := i
+	for ; j < len(s) && s[j] >= '0' && s[j] <= '9'; j++ {
+	}
+	if j == i {
+		return -1
+	}
+	return j
+}
+
+// matchAlpha matches [A-Za-z]+
+func matchAlpha(s string) int {
+	i := 0
+	for ; i < len(s) && isAlpha(s[i]); i++ {
+	}
+	if i == 0 {
+		return -1
+	}
+	return i
+}
+
+// matchAlnum matches [A-Za-z0-9]+
+func matchAlnum(s string) int {
+	i := 0
+	for ; i < len(s) && (isAlpha(s[i]) || s[i] >= '0' && s[i] <= '9'); i++ {
+	}
+	if i == 0 {
+		return -1
+	}
+	return i
+}
+
+// matchUUID matches the canonical textual form of a UUID: 8-4-4-4-12 hexadecimal digits.
+func matchUUID(s string) int {
+	if len(s) < 36 {
+		return -1
+	}
+	for i := 0; i < 36; i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return -1
+			}
+		default:
+			if unhex(s[i]) < 0 {
+				return -1
+			}
+		}
+	}
+	return 36
+}
+
+// matchDate matches a calendar date in the form of YYYY-MM-DD.
+func matchDate(s string) int {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return -1
+	}
+	for _, i := range [8]int{0, 1, 2, 3, 5, 6, 8, 9} {
+		if s[i] < '0' || s[i] > '9' {
+			return -1
+		}
+	}
+	month := (s[5]-'0')*10 + s[6] - '0'
+	day := (s[8]-'0')*10 + s[9] - '0'
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return -1
+	}
+	return 10
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c - 'a' + 10)
+	case c >= 'A' && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
+
+var errInvalidUUID = errors.New("routing: invalid uuid")
+
+// ParamInt returns the named parameter value converted to int.
+func (c *Ctx) ParamInt(name string) (int, error) {
+	return strconv.Atoi(c.Param(name))
+}
+
+// ParamInt64 returns the named parameter value converted to int64.
+func (c *Ctx) ParamInt64(name string) (int64, error) {
+	return strconv.ParseInt(c.Param(name), 10, 64)
+}
+
+// ParamUUID returns the named parameter value parsed as a UUID in the form of 8-4-4-4-12 hexadecimal digits.
+func (c *Ctx) ParamUUID(name string) (uuid [16]byte, err error) {
+	s := c.Param(name)
+	if len(s) != 36 || matchUUID(s) != 36 {
+		return uuid, errInvalidUUID
+	}
+	for i, j := 0, 0; i < 36; i += 2 {
+		if s[i] == '-' {
+			i++
+		}
+		uuid[j] = byte(unhex(s[i])<<4 | unhex(s[i+1]))
+		j++
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		matcher, s string
+		n          int
+	}{
+		{"int", "123", 3},
+		{"int", "-12/abc", 3},
+		{"int", "12a", 2},
+		{"int", "-", -1},
+		{"int", "", -1},
+		{"alpha", "abcXYZ1", 6},
+		{"alpha", "1abc", -1},
+		{"alnum", "abc123/x", 6},
+		{"alnum", "-", -1},
+		{"uuid", "123e4567-e89b-12d3-a456-426614174000", 36},
+		{"uuid", "123E4567-E89B-12D3-A456-426614174000/x", 36},
+		{"uuid", "123e4567e89b12d3a456426614174000", -1},
+		{"uuid", "123e4567-e89b-12d3-a456-42661417400g", -1},
+		{"date", "2024-05-23", 10},
+		{"date", "2024-13-01", -1},
+		{"date", "2024-00-01", -1},
+		{"date", "2024-05-32", -1},
+		{"date", "2024/05/23", -1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.n, matchers[test.matcher](test.s), test.matcher+"("+test.s+") =")
+	}
+}
+
+func TestStoreGetMatcher(t *testing.T) {
+	RegisterMatcher("even", func(s string) int {
+		if n := matchInt(s); n > 0 && (s[n-1]-'0')%2 == 0 {
+			return n
+		}
+		return -1
+	})
+	h := newStore()
+	h.Add("/users/<id:int>", "1")
+	h.Add("/users/<name:alpha>", "2")
+	h.Add("/posts/<date:date>/<slug>", "3")
+	h.Add("/objects/<uuid:uuid>", "4")
+	h.Add("/numbers/<n:even>", "5")
+	h.Add("/numbers/<n>", "6")
+
+	tests := []struct {
+		key   string
+		value interface{}
+		param string
+	}{
+		{"/users/123", "1", "123"},
+		{"/users/abc", "2", "abc"},
+		{"/users/a1", nil, ""},
+		{"/posts/2024-05-23/hello", "3", "2024-05-23"},
+		{"/posts/2024-5-23/hello", nil, ""},
+		{"/objects/123e4567-e89b-12d3-a456-426614174000", "4", "123e4567-e89b-12d3-a456-426614174000"},
+		{"/numbers/42", "5", "42"},
+		{"/numbers/43", "6", "43"},
+	}
+	pvalues := make([]string, 2)
+	for _, test := range tests {
+		data, _ := h.Get(test.key, pvalues)
+		assert.Equal(t, test.value, data, "store.Get("+test.key+") =")
+		if data != nil {
+			assert.Equal(t, test.param, pvalues[0], "store.Get("+test.key+").pvalues[0] =")
+		}
+	}
+}
+
+func TestCtxTypedParams(t *testing.T) {
+	router := New()
+	var (
+		id   int
+		id64 int64
+		uuid [16]byte
+		err  error
+	)
+	router.Get("/users/<id:int>/<uuid:uuid>", func(c *Ctx) error {
+		id, _ = c.ParamInt("id")
+		id64, _ = c.ParamInt64("id")
+		uuid, err = c.ParamUUID("uuid")
+		return nil
+	})
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/-42/123e4567-e89b-12d3-a456-426614174000")
+	router.HandleRequest(ctx)
+	assert.Equal(t, -42, id)
+	assert.Equal(t, int64(-42), id64)
+	assert.Nil(t, err)
+	assert.Equal(t, [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}, uuid)
+
+	route := router.Route("/users/<id:int>/<uuid:uuid>")
+	u, err := route.URLByIndex([]string{"7", "123e4567-e89b-12d3-a456-426614174000"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/7/123e4567-e89b-12d3-a456-426614174000", u)
+	_, err = route.URLByIndex([]string{"7a", "123e4567-e89b-12d3-a456-426614174000"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,172 @@
+// Package accesslog provides a middleware writing one structured zerolog line per request.
+//
+//	router.Use(accesslog.New(), trace.New(), recovery.New())
+//	router.Get("/health", health).Meta(accesslog.LevelKey, zerolog.Disabled)
+//
+// Requests which must not reach the middleware at all, e.g. those of the routes carrying some
+// metadata, are left out by registering it with RouteGroup.UseExcept:
+//
+//	router.UseExcept(routing.HasMeta("internal", true), accesslog.New())
+//
+// The middleware also gives each request a child logger carrying the method and path, and the
+// request ID and trace ID when the trace middleware runs after it, which handlers use through Ctx.Log:
+//
+//	c.Log().Info().Str("openid", openid).Msg("message received")
+package accesslog
+
+import (
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/rs/zerolog"
+	"helpers/unsafefn"
+)
+
+// The fields an access log line can contain, see Config.Fields.
+const (
+	FieldMethod    = "method"
+	FieldRoute     = "route"
+	FieldRouteName = "route_name"
+	FieldPath      = "path"
+	FieldStatus    = "status"
+	FieldLatency   = "latency"
+	FieldBytes     = "bytes"
+	FieldIP        = "ip"
+	FieldUserAgent = "user_agent"
+	FieldRequestID = "request_id"
+)
+
+// LevelKey is the route metadata key overriding the level of the access log lines of a route,
+// e.g. route.Meta(accesslog.LevelKey, zerolog.DebugLevel). zerolog.Disabled turns them off.
+const LevelKey = "accesslog.level"
+
+type Config struct {
+	// Logger 写访问日志的日志器，为 nil 时使用 Ctx.Log
+	Logger *zerolog.Logger
+	// Fields 访问日志包含的字段，默认为 DefaultFields；请求失败时总会附带 error 字段
+	Fields []string
+	// Sampler 对状态码小于 400 的请求进行采样，为 nil 时全部记录；4xx/5xx 请求总是记录
+	Sampler zerolog.Sampler
+	// RequestIDHeader 请求ID所在的头部，先查找响应头部，再查找请求头部，默认为 X-Request-ID
+	RequestIDHeader string
+	// DisableContextLogger 不为请求设置附带 method、path 字段的子日志器
+	DisableContextLogger bool
+}
+
+// DefaultFields are the fields logged when Config.Fields is empty.
+var DefaultFields = []string{
+	FieldMethod, FieldRoute, FieldPath, FieldStatus, FieldLatency,
+	FieldBytes, FieldIP, FieldUserAgent, FieldRequestID,
+}
+
+var DefCfg = Config{
+	RequestIDHeader: routing.HeaderXRequestID,
+}
+
+// New creates a middleware that logs every request after the handlers after it have finished.
+// Responses with a status code below 400 are logged at the info level, 4xx at the warn level and
+// 5xx at the error level, unless the route sets LevelKey.
+//
+// Errors returned by the handlers are handled with Ctx.HandleError inside the middleware, so that
+// the logged status and size are those of the response sent; the middleware should therefore be
+// registered first.
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	idHeader := cfg.RequestIDHeader
+	if idHeader == "" {
+		idHeader = DefCfg.RequestIDHeader
+	}
+	return func(c *routing.Ctx) error {
+		start := time.Now()
+		logger := cfg.Logger
+		if logger == nil {
+			logger = c.Log()
+		}
+		if !cfg.DisableContextLogger {
+			l := c.Log().With().Str(FieldMethod, string(c.Method())).Str(FieldPath, string(c.Path())).Logger()
+			c.SetLog(&l)
+		}
+
+		err := c.Next()
+		if err != nil && !c.TimedOut() {
+			c.HandleError(err)
+		}
+
+		status := c.FinalResponse().StatusCode()
+		level := zerolog.InfoLevel
+		if status >= 500 {
+			level = zerolog.ErrorLevel
+		} else if status >= 400 {
+			level = zerolog.WarnLevel
+		}
+		if l, ok := c.Meta(LevelKey).(zerolog.Level); ok {
+			level = l
+		}
+		if level == zerolog.Disabled || logger.GetLevel() > level {
+			return nil
+		}
+		if status < 400 && cfg.Sampler != nil && !cfg.Sampler.Sample(level) {
+			return nil
+		}
+		e := logger.WithLevel(level)
+		for _, f := range fields {
+			addField(e, c, f, idHeader, start)
+		}
+		if err != nil {
+			e.Err(err)
+		}
+		e.Msg("request")
+		return nil
+	}
+}
+
+func addField(e *zerolog.Event, c *routing.Ctx, field, idHeader string, start time.Time) {
+	switch field {
+	case FieldMethod:
+		e.Bytes(field, c.Method())
+	case FieldRoute:
+		if route := c.Route(); route != nil {
+			e.Str(field, route.Path())
+		}
+	case FieldRouteName:
+		if route := c.Route(); route != nil {
+			e.Str(field, route.RouteName())
+		}
+	case FieldPath:
+		e.Bytes(field, c.Path())
+	case FieldStatus:
+		e.Int(field, c.FinalResponse().StatusCode())
+	case FieldLatency:
+		e.Dur(field, time.Since(start))
+	case FieldBytes:
+		// the size of a streamed body is only known when the Content-Length is set
+		resp := c.FinalResponse()
+		if resp.IsBodyStream() {
+			e.Int(field, resp.Header.ContentLength())
+		} else {
+			e.Int(field, len(resp.Body()))
+		}
+	case FieldIP:
+		e.Str(field, unsafefn.BtoS(c.IP()))
+	case FieldUserAgent:
+		e.Bytes(field, c.UserAgent())
+	case FieldRequestID:
+		// the trace middleware echoes the request ID it accepted or generated in the response
+		id := c.FinalResponse().Header.Peek(idHeader)
+		if len(id) == 0 {
+			id = c.Request.Header.Peek(idHeader)
+		}
+		if len(id) > 0 {
+			e.Bytes(field, id)
+		}
+	}
+}
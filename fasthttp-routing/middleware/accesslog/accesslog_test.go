@@ -0,0 +1,121 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/routingtest"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func readLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		m := map[string]any{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &m))
+		lines = append(lines, m)
+	}
+	buf.Reset()
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	router := routing.New()
+	router.App.Log = &logger
+	router.Use(New())
+	router.Get("/users/<id>", func(c *routing.Ctx) error {
+		c.Log().Info().Str("user", c.Param("id")).Msg("loading")
+		_, err := c.WriteString("user " + c.Param("id"))
+		return err
+	}).Name("user")
+	router.Get("/fail", func(c *routing.Ctx) error {
+		return routing.ErrForbidden
+	})
+	router.Get("/health", func(c *routing.Ctx) error {
+		return nil
+	}).Meta(LevelKey, zerolog.Disabled)
+	client := router.TestClient()
+
+	res, _ := client.Get("/users/1").Header(routing.HeaderXRequestID, "req-1").
+		Header(routing.HeaderUserAgent, "test").RemoteIP("10.0.0.1").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK)
+	lines := readLines(t, buf)
+	if assert.Len(t, lines, 2) {
+		// handlers log with the request context
+		assert.Equal(t, "loading", lines[0]["message"])
+		assert.Equal(t, "GET", lines[0]["method"])
+		assert.Equal(t, "/users/1", lines[0]["path"])
+
+		l := lines[1]
+		assert.Equal(t, "info", l["level"])
+		assert.Equal(t, "request", l["message"])
+		assert.Equal(t, "/users/<id>", l["route"])
+		assert.Equal(t, float64(200), l["status"])
+		assert.Equal(t, float64(6), l["bytes"])
+		assert.Equal(t, "10.0.0.1", l["ip"])
+		assert.Equal(t, "test", l["user_agent"])
+		assert.Equal(t, "req-1", l["request_id"])
+		assert.Contains(t, l, "latency")
+	}
+
+	res, _ = client.Get("/fail").Do()
+	routingtest.Expect(t, res).Status(routing.StatusForbidden)
+	lines = readLines(t, buf)
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "warn", lines[0]["level"])
+		assert.Equal(t, float64(403), lines[0]["status"])
+		assert.Equal(t, "Forbidden", lines[0]["error"])
+	}
+
+	res, _ = client.Get("/missing").Do()
+	routingtest.Expect(t, res).Status(routing.StatusNotFound)
+	lines = readLines(t, buf)
+	if assert.Len(t, lines, 1) {
+		assert.NotContains(t, lines[0], "route")
+	}
+
+	client.Get("/health").Do()
+	assert.Empty(t, readLines(t, buf))
+}
+
+func TestAccessLogConfig(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+	router := routing.New()
+	router.Use(New(&Config{
+		Logger:               &logger,
+		Fields:               []string{FieldStatus, FieldRouteName},
+		Sampler:              &zerolog.BasicSampler{N: 2},
+		DisableContextLogger: true,
+	}))
+	router.Get("/ok", func(c *routing.Ctx) error {
+		return nil
+	}).Name("ok")
+	router.Get("/error", func(c *routing.Ctx) error {
+		return routing.NewHTTPError(routing.StatusServiceUnavailable)
+	})
+	client := router.TestClient()
+
+	for i := 0; i < 4; i++ {
+		client.Get("/ok").Do()
+	}
+	lines := readLines(t, buf)
+	assert.Len(t, lines, 2, "successful requests are sampled")
+	assert.Equal(t, map[string]any{"level": "info", "status": float64(200), "route_name": "ok", "message": "request"}, lines[0])
+
+	for i := 0; i < 2; i++ {
+		client.Get("/error").Do()
+	}
+	lines = readLines(t, buf)
+	assert.Len(t, lines, 2, "failed requests are always logged")
+	assert.Equal(t, "error", lines[0]["level"])
+}
@@ -1,10 +1,14 @@
 package compress
 
 import (
+	"bytes"
+
 	routing "fasthttp-routing"
 	"github.com/newacorn/fasthttp"
 )
 
+var eventStream = []byte(routing.MIMETextEventStream)
+
 // New creates a new middleware handler
 func New(cfgs ...Config) routing.Handler {
 	// Set default config
@@ -49,10 +53,15 @@ func New(cfgs ...Config) routing.Handler {
 		}
 
 		// Continue stack
-		if err := c.Next(); err != nil {
+		if err := c.Next(); err != nil || c.TimedOut() {
 			return err
 		}
 
+		// Don't compress event streams, each event must reach the client as soon as it is flushed
+		if bytes.HasPrefix(c.Response.Header.ContentType(), eventStream) {
+			return nil
+		}
+
 		// Compress response
 		compressor(c.RequestCtx)
 
@@ -36,6 +36,7 @@ import (
 //
 // Config defines the config for middleware.
 type Config struct {
+	// Deprecated: register the middleware with RouteGroup.UseExcept instead.
 	Skip func(c *routing.Ctx) bool
 	// []string{"*"} match all paths
 	// 其它值做前缀匹配
@@ -105,6 +106,9 @@ func New(cfgs ...*Config) routing.Handler {
 			return nil
 		}
 		err := ctx.Next()
+		if ctx.TimedOut() {
+			return err
+		}
 		if unsafefn.BtoS(ctx.Method()) == routing.MethodOptions {
 			ctx.Response.Header.AddCanonicalNoS(routing.HeaderVary, routing.HeaderAccessControlRequestMethod)
 		}
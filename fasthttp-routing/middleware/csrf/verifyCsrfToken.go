@@ -2,40 +2,91 @@ package csrf
 
 import (
 	"crypto/hmac"
+	"encoding/base64"
 	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	routing "fasthttp-routing"
 	"fasthttp-routing/middleware/session"
 	"github.com/newacorn/fasthttp"
+	"github.com/rs/zerolog/log"
 	"helpers/unsafefn"
+	"helpers/utilcrypt"
 )
 
-var mismatchError = errors.New("csrf token mismatch")
+var (
+	// ErrTokenMismatch is the cause of the failures of the requests which do not carry the CSRF
+	// token, or carry another token.
+	ErrTokenMismatch = errors.New("csrf token mismatch")
+	// ErrOriginMismatch is the cause of the failures of the requests whose Origin, or Referer when
+	// there is no Origin, is neither the origin of the request nor a trusted origin.
+	ErrOriginMismatch = errors.New("csrf origin mismatch")
+	// ErrNoSession is returned when the session middleware has not run before the csrf middleware,
+	// unless DoubleSubmit is set.
+	ErrNoSession = errors.New("csrf: no session data, use the session middleware or DoubleSubmit")
+)
 
+// Deprecated: ReadingMethod is not used, the safe methods GET, HEAD, OPTIONS and TRACE are matched exactly.
 const ReadingMethod = "HEADGETOPTIONS"
 const HeaderNameFromMeta = "X-CSRF-TOKEN"
 const HeaderNameFromCookie = "X-XSRF-TOKEN"
 const NameFromFrom = "_token"
 
+// MetaExempt is the metadata item exempting a route from the verification when set to true:
+//
+//	app.Post("/webhooks/<provider>", handler).Meta(csrf.MetaExempt, true)
+const MetaExempt = "csrf.exempt"
+
+// ContextKey is the user value of the request holding the CSRF token in DoubleSubmit mode, see Token.
+const ContextKey = "csrf"
+
 // const NameInSession = "_token"
 
 type Config struct {
-	skip         routing.Skipper
-	except       []string
-	noCookie     bool
-	cokLifetime  time.Duration
-	cokPath      string
-	cokDomain    string
-	cokHttpOnly  bool
-	cokSame_site fasthttp.CookieSameSite
-	cokSecure    bool
+	// Deprecated: register the middleware with RouteGroup.UseExcept instead.
+	Skip routing.Skipper
+	// Except 免于校验的路由，为路由名称或者注册时的路径（含分组前缀），如 "/webhooks/*"、"/api/users/<id>"，
+	// 与匹配请求的路由比较而不是与请求路径做前缀匹配。设置了元数据 MetaExempt 为 true 的路由同样免于校验
+	Except []string
+	// TrustedOrigins 除与请求同源以外，不安全方法的请求允许的来源，如 "https://admin.example.com"，
+	// "https://*.example.com" 匹配其任意子域名
+	TrustedOrigins []string
+	// DisableOriginCheck 为 true 时不校验不安全方法请求的 Origin 及 Referer 头。
+	// 请求既没有 Origin 也没有 Referer 时只校验令牌
+	DisableOriginCheck bool
+	// DoubleSubmit 为 true 时使用无状态的双重提交模式，无需会话中间件：令牌由 AppendHash 签名后保存在 cookie CokName 中，
+	// 请求需在表单或者头中提交相同的令牌。cookie 可能被同站的子域名覆盖，建议使用 __Host- 前缀的 CokName
+	DoubleSubmit bool
+	// AppendHash DoubleSubmit 模式下签名令牌，该模式下必须配置，例如 utilcrypt.NewHMACHash(key, oldKeys...)，
+	// 密钥需固定且在多个实例间相同，否则重启或者换实例后令牌失效
+	AppendHash utilcrypt.BytesWithHash
+	// ErrorHandler 校验失败时调用，err 为 ErrTokenMismatch 或者 ErrOriginMismatch，
+	// 默认返回状态码为 403 的 routing.HTTPError
+	ErrorHandler func(c *routing.Ctx, err error) error
+	// NoCookie 为 true 时不在响应中设置令牌的 cookie，DoubleSubmit 模式下忽略
+	NoCookie    bool
+	CokName     string
+	CokLifetime time.Duration
+	CokPath     string
+	CokDomain   string
+	// CokHttpOnly 为 true 时前端脚本无法读取 cookie 并通过 X-XSRF-TOKEN 头提交
+	CokHttpOnly bool
+	CokSameSite fasthttp.CookieSameSite
+	CokSecure   bool
+	// except Except 的集合
+	except map[string]struct{}
+	// trusted 规范化为小写的 TrustedOrigins
+	trusted []string
 }
 
 var DefCfg = Config{
-	cokLifetime:  time.Hour * 7 * 24,
-	cokSame_site: fasthttp.CookieSameSiteNoneMode,
+	CokName:     "XSRF-TOKEN",
+	CokLifetime: time.Hour * 7 * 24,
+	CokSameSite: fasthttp.CookieSameSiteLaxMode,
 }
 
 func New(cfgs ...*Config) routing.Handler {
@@ -46,41 +97,211 @@ func New(cfgs ...*Config) routing.Handler {
 	} else {
 		cfg = &DefCfg
 	}
+	if cfg.CokName == "" {
+		cfg.CokName = DefCfg.CokName
+	}
+	if cfg.DoubleSubmit && cfg.AppendHash == nil {
+		log.Fatal().Caller().Msg("csrf: AppendHash must be configured with a fixed key in DoubleSubmit mode")
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = forbidden
+	}
+	cfg.except = make(map[string]struct{}, len(cfg.Except))
+	for _, name := range cfg.Except {
+		cfg.except[name] = struct{}{}
+	}
+	cfg.trusted = cfg.trusted[:0]
+	for _, origin := range cfg.TrustedOrigins {
+		cfg.trusted = append(cfg.trusted, strings.TrimSuffix(strings.ToLower(origin), "/"))
+	}
 	return cfg.handle
 }
+
+// forbidden is the default ErrorHandler.
+func forbidden(_ *routing.Ctx, err error) error {
+	return &routing.HttpError{Status: http.StatusForbidden, Message: http.StatusText(http.StatusForbidden), Internal: err}
+}
+
+// Token returns the CSRF token of the request, to be rendered in the forms as the field _token or
+// in a meta tag sent back in the X-CSRF-TOKEN header. It is the token of the session, or the
+// token of the cookie in DoubleSubmit mode. It returns nil if the middleware has not run.
+func Token(c *routing.Ctx) []byte {
+	if token, ok := c.UserValue(ContextKey).([]byte); ok {
+		return token
+	}
+	if data, ok := c.UserValue(session.ContextKey).(*session.Data); ok {
+		return data.CsrfToken()
+	}
+	return nil
+}
+
 func (cfg *Config) handle(c *routing.Ctx) (err error) {
-	sessionData := c.UserValue(session.ContextKey).(*session.Data)
-	token2 := sessionData.CsrfToken()
-	if cfg.isReading(c) || cfg.inExceptArray(c) || cfg.tokensMatch(c, token2) || sessionData.Manager().AppendHash.ValidateHash(token2) {
-		err = c.Next()
-		if cfg.noCookie || len(token2) == 0 {
-			return
+	if cfg.Skip != nil && cfg.Skip(c) {
+		return c.Next()
+	}
+	if cfg.DoubleSubmit {
+		return cfg.handleDoubleSubmit(c)
+	}
+	sessionData, ok := c.UserValue(session.ContextKey).(*session.Data)
+	if !ok {
+		return ErrNoSession
+	}
+	if !cfg.isReading(c) && !cfg.isExempt(c) {
+		if err = cfg.verify(c, sessionData.CsrfToken(), sessionData.Manager().AppendHash); err != nil {
+			return cfg.ErrorHandler(c, err)
 		}
-		cok := cfg.newCookie(token2)
-		c.Response.Header.SetCookie(cok)
-		fasthttp.ReleaseCookie(cok)
+	}
+	err = c.Next()
+	if c.TimedOut() {
 		return
 	}
-	return mismatchError
+	// the handlers may have regenerated the token, e.g. on login
+	if token := sessionData.CsrfToken(); !cfg.NoCookie && len(token) != 0 {
+		cfg.setCookie(c, token)
+	}
+	return
+}
+
+// handleDoubleSubmit verifies that the token of the request matches the token of the cookie, and
+// issues a token when the cookie has none.
+func (cfg *Config) handleDoubleSubmit(c *routing.Ctx) (err error) {
+	token := c.Request.Header.Cookie(cfg.CokName)
+	if !validToken(token, cfg.AppendHash) {
+		token = nil
+	}
+	if !cfg.isReading(c) && !cfg.isExempt(c) {
+		if err = cfg.verify(c, token, cfg.AppendHash); err != nil {
+			return cfg.ErrorHandler(c, err)
+		}
+	}
+	if token == nil {
+		token = session.GenerateToken2(make([]byte, session.AppendHashCsrfTokenLen),
+			make([]byte, session.UrlEncodedCsrfTokenLen), cfg.AppendHash)
+		cfg.setCookie(c, token)
+	} else {
+		// the cookie buffer is reused once the request has been handled
+		token = append([]byte(nil), token...)
+	}
+	c.SetUserValue(ContextKey, token)
+	return c.Next()
 }
+
+// isReading reports whether the request method is safe, i.e. it does not change the state.
 func (cfg *Config) isReading(c *routing.Ctx) bool {
-	return strings.Contains(ReadingMethod, unsafefn.BtoS(c.Method()))
+	switch unsafefn.BtoS(c.Method()) {
+	case routing.MethodGet, routing.MethodHead, routing.MethodOptions, routing.MethodTrace:
+		return true
+	}
+	return false
 }
-func (cfg *Config) inExceptArray(c *routing.Ctx) bool {
-	for i := range cfg.except {
-		if strings.HasPrefix(unsafefn.BtoS(c.Path()), cfg.except[i]) {
+
+// isExempt reports whether the route matching the request is exempted by Except or MetaExempt.
+func (cfg *Config) isExempt(c *routing.Ctx) bool {
+	route := c.Route()
+	if route == nil {
+		return false
+	}
+	if exempt, _ := c.Meta(MetaExempt).(bool); exempt {
+		return true
+	}
+	if _, ok := cfg.except[route.RouteName()]; ok {
+		return true
+	}
+	_, ok := cfg.except[route.Path()]
+	return ok
+}
+
+// verify checks the origin of the request, then its token against token2.
+func (cfg *Config) verify(c *routing.Ctx, token2 []byte, appendHash utilcrypt.BytesWithHash) error {
+	if !cfg.DisableOriginCheck && !cfg.originMatch(c) {
+		log.Info().Str("origin", string(c.Request.Header.Peek(routing.HeaderOrigin))).
+			Str("referer", string(c.Request.Header.Referer())).Msg("csrf origin mismatch")
+		return ErrOriginMismatch
+	}
+	if !cfg.tokensMatch(c, token2, appendHash) {
+		return ErrTokenMismatch
+	}
+	return nil
+}
+
+// originMatch reports whether the Origin of the request, or the origin of its Referer when it has
+// no Origin, is the origin of the request or a trusted origin. The requests with neither header,
+// e.g. from clients other than the browsers, match.
+func (cfg *Config) originMatch(c *routing.Ctx) bool {
+	origin := unsafefn.BtoS(c.Request.Header.Peek(routing.HeaderOrigin))
+	if origin == "" {
+		referer := unsafefn.BtoS(c.Request.Header.Referer())
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if origin == "null" {
+		// sandboxed documents, redirects across origins, file: URLs
+		return false
+	}
+	origin = strings.ToLower(origin)
+	return cfg.sameOrigin(c, origin) || cfg.trustedOrigin(origin)
+}
+
+// sameOrigin reports whether origin is the scheme, host and port of the request.
+func (cfg *Config) sameOrigin(c *routing.Ctx, origin string) bool {
+	scheme, hostPort, ok := strings.Cut(origin, "://")
+	if !ok || scheme != c.Proto() {
+		return false
+	}
+	host, port := hostPort, ""
+	if i := strings.LastIndexByte(hostPort, ':'); i > strings.LastIndexByte(hostPort, ']') {
+		host, port = hostPort[:i], hostPort[i+1:]
+	}
+	if port == "" {
+		port = "80"
+		if scheme == routing.HTTPS {
+			port = "443"
+		}
+	}
+	return strings.EqualFold(host, unsafefn.BtoS(c.Host())) && port == strconv.Itoa(c.Port())
+}
+
+func (cfg *Config) trustedOrigin(origin string) bool {
+	for _, trusted := range cfg.trusted {
+		if origin == trusted {
+			return true
+		}
+		// https://*.example.com
+		scheme, host, ok := strings.Cut(trusted, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
 			return true
 		}
 	}
 	return false
 }
-func (cfg *Config) tokensMatch(c *routing.Ctx, token2 []byte) bool {
+
+// tokensMatch reports whether the request carries the CSRF token token2. The tag of the token is
+// verified first, so that forged tokens are rejected without comparing them.
+func (cfg *Config) tokensMatch(c *routing.Ctx, token2 []byte, appendHash utilcrypt.BytesWithHash) bool {
 	token := getTokenFromRequest(c)
+	if len(token) == 0 || len(token2) == 0 || len(token) != len(token2) {
+		return false
+	}
+	if !validToken(token, appendHash) {
+		return false
+	}
+	return hmac.Equal(token, token2)
+}
 
-	if len(token) != 0 && len(token2) != 0 {
-		return hmac.Equal(token, token2)
+// validToken reports whether token is an encoded token with a valid tag.
+func validToken(token []byte, appendHash utilcrypt.BytesWithHash) bool {
+	if len(token) == 0 {
+		return false
 	}
-	return false
+	raw := make([]byte, base64.RawURLEncoding.DecodedLen(len(token)))
+	n, err := base64.RawURLEncoding.Decode(raw, token)
+	return err == nil && appendHash.ValidateHash(raw[:n])
 }
 
 func getTokenFromRequest(c *routing.Ctx) (token []byte) {
@@ -94,19 +315,27 @@ func getTokenFromRequest(c *routing.Ctx) (token []byte) {
 	// 如果cookie经过加密这里还需要解密处理
 	return
 }
+
+func (cfg *Config) setCookie(c *routing.Ctx, csrfToken []byte) {
+	cok := cfg.newCookie(csrfToken)
+	c.Response.Header.SetCookie(cok)
+	fasthttp.ReleaseCookie(cok)
+}
+
 func (cfg *Config) newCookie(csrfToken []byte) (cok *fasthttp.Cookie) {
 	cok = fasthttp.AcquireCookie()
-	if cfg.cokDomain != "" {
-		cok.SetDomain(cfg.cokDomain)
+	if cfg.CokDomain != "" {
+		cok.SetDomain(cfg.CokDomain)
 	}
-	if cfg.cokPath != "" {
-		cok.SetPath(cfg.cokPath)
+	if cfg.CokPath != "" {
+		cok.SetPath(cfg.CokPath)
 	}
-	cok.SetKey("XSRF-TOKEN")
+	cok.SetKey(cfg.CokName)
 	cok.SetValueBytes(csrfToken)
 	// cok.SetExpire(time.Now().Add(cfg.cokLifetime * time.Second))
-	cok.SetMaxAge(int(cfg.cokLifetime.Seconds()))
-	cok.SetSecure(cfg.cokSecure)
-	cok.SetSameSite(cfg.cokSame_site)
+	cok.SetMaxAge(int(cfg.CokLifetime.Seconds()))
+	cok.SetHTTPOnly(cfg.CokHttpOnly)
+	cok.SetSecure(cfg.CokSecure)
+	cok.SetSameSite(cfg.CokSameSite)
 	return
 }
@@ -0,0 +1,180 @@
+package csrf
+
+import (
+	"net/http"
+	"testing"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/session"
+	"fasthttp-routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"helpers/utilcrypt"
+)
+
+func newApp(cfg *Config, withSession bool) *routing.Router {
+	app := routing.New()
+	if withSession {
+		sessionCfg := session.DefCfg
+		sessionCfg.Store = session.NewMemoryStoreWithCleanup(0)
+		app.Use(session.New(&sessionCfg))
+	}
+	app.Use(New(cfg))
+	ok := func(c *routing.Ctx) error {
+		c.SetBodyString("ok")
+		return nil
+	}
+	app.Get("/form", func(c *routing.Ctx) error {
+		c.SetBody(Token(c))
+		return nil
+	})
+	app.Post("/submit", ok)
+	app.Post("/webhooks/<provider>", ok)
+	app.Post("/hooks/*", ok).Name("hooks")
+	app.Post("/callback", ok).Meta(MetaExempt, true)
+	return app
+}
+
+// token gets the token of the client from the form.
+func token(t *testing.T, client *routing.TestClient) string {
+	res, err := client.Get("/form").Do()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, res.Body())
+	return string(res.Body())
+}
+
+func TestSessionToken(t *testing.T) {
+	t.Parallel()
+	app := newApp(&Config{}, true)
+	client := app.TestClient()
+	tok := token(t, client)
+	assert.Equal(t, tok, string(client.Jar["XSRF-TOKEN"].Value()))
+
+	res, err := client.Post("/submit").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+	res, _ = client.Post("/submit").Form(map[string]string{NameFromFrom: tok + "x"}).Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+	res, _ = client.Post("/submit").Header(HeaderNameFromMeta, tok[1:]+"A").Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+
+	res, _ = client.Post("/submit").Form(map[string]string{NameFromFrom: tok}).Do()
+	routingtest.Expect(t, res).Status(http.StatusOK).Body("ok")
+	res, _ = client.Post("/submit").Header(HeaderNameFromCookie, tok).Do()
+	routingtest.Expect(t, res).Status(http.StatusOK)
+
+	// the token of another session
+	res, _ = app.TestClient().Post("/submit").Header(HeaderNameFromMeta, tok).Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+}
+
+func TestSafeMethods(t *testing.T) {
+	t.Parallel()
+	app := newApp(&Config{}, true)
+	client := app.TestClient()
+	for _, method := range []string{"T", "AD", "ADGET", "GETOPTIONS", "get", "PUT"} {
+		res, err := client.Request(method, "/submit").Do()
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode(), method)
+	}
+	for _, method := range []string{"GET", "HEAD", "OPTIONS", "TRACE"} {
+		res, err := client.Request(method, "/submit").Header("Origin", "http://evil.com").Do()
+		assert.Nil(t, err)
+		assert.NotEqual(t, http.StatusForbidden, res.StatusCode(), method)
+	}
+}
+
+func TestExempt(t *testing.T) {
+	t.Parallel()
+	app := newApp(&Config{Except: []string{"/webhooks/<provider>", "hooks"}}, true)
+	client := app.TestClient()
+	for _, uri := range []string{"/webhooks/github", "/hooks/a/b", "/callback"} {
+		res, err := client.Post(uri).Do()
+		assert.Nil(t, err)
+		routingtest.Expect(t, res).Status(http.StatusOK)
+	}
+	// a prefix of an exempted path, which matches no route
+	res, _ := client.Post("/webhooks").Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+	res, _ = client.Post("/submit").Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+}
+
+func TestOrigin(t *testing.T) {
+	t.Parallel()
+	app := newApp(&Config{TrustedOrigins: []string{"https://Admin.example.com", "https://*.trusted.com"}}, true)
+	client := app.TestClient()
+	tok := token(t, client)
+	for _, tc := range []struct {
+		header, value string
+		status        int
+	}{
+		{"Origin", "http://localhost", http.StatusOK},
+		{"Origin", "http://localhost:80", http.StatusOK},
+		{"Origin", "https://localhost", http.StatusForbidden},
+		{"Origin", "http://localhost:8080", http.StatusForbidden},
+		{"Origin", "http://evil.com", http.StatusForbidden},
+		{"Origin", "null", http.StatusForbidden},
+		{"Origin", "https://admin.example.com", http.StatusOK},
+		{"Origin", "https://a.b.trusted.com", http.StatusOK},
+		{"Origin", "https://trusted.com", http.StatusForbidden},
+		{"Origin", "http://a.trusted.com", http.StatusForbidden},
+		{"Referer", "http://localhost/form?a=b", http.StatusOK},
+		{"Referer", "http://evil.com/localhost", http.StatusForbidden},
+		{"Referer", "not a url", http.StatusForbidden},
+	} {
+		res, err := client.Post("/submit").Header(tc.header, tc.value).Header(HeaderNameFromMeta, tok).Do()
+		assert.Nil(t, err)
+		assert.Equal(t, tc.status, res.StatusCode(), tc.header+": "+tc.value)
+	}
+
+	app = newApp(&Config{DisableOriginCheck: true}, true)
+	client = app.TestClient()
+	tok = token(t, client)
+	res, _ := client.Post("/submit").Header("Origin", "http://evil.com").Header(HeaderNameFromMeta, tok).Do()
+	routingtest.Expect(t, res).Status(http.StatusOK)
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	t.Parallel()
+	cfg := &Config{DoubleSubmit: true, AppendHash: utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))}
+	app := newApp(cfg, false)
+	client := app.TestClient()
+	tok := token(t, client)
+	assert.Equal(t, tok, string(client.Jar["XSRF-TOKEN"].Value()))
+	// the token is kept while the cookie is valid
+	assert.Equal(t, tok, token(t, client))
+
+	res, _ := client.Post("/submit").Header(HeaderNameFromMeta, tok).Do()
+	routingtest.Expect(t, res).Status(http.StatusOK)
+	res, _ = client.Post("/submit").Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+
+	// a cookie not signed with the key of the application
+	other := utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))
+	forged := string(session.GenerateToken2(make([]byte, session.AppendHashCsrfTokenLen),
+		make([]byte, session.UrlEncodedCsrfTokenLen), other))
+	res, _ = app.TestClient().Post("/submit").Cookie("XSRF-TOKEN", forged).Header(HeaderNameFromMeta, forged).Do()
+	routingtest.Expect(t, res).Status(http.StatusForbidden)
+}
+
+func TestErrorHandler(t *testing.T) {
+	t.Parallel()
+	var cause error
+	cfg := &Config{ErrorHandler: func(c *routing.Ctx, err error) error {
+		cause = err
+		return routing.NewHTTPError(419, "page expired")
+	}}
+	app := newApp(cfg, true)
+	res, _ := app.TestClient().Post("/submit").Do()
+	routingtest.Expect(t, res).Status(419)
+	assert.ErrorIs(t, cause, ErrTokenMismatch)
+	res, _ = app.TestClient().Post("/submit").Header("Origin", "http://evil.com").Do()
+	routingtest.Expect(t, res).Status(419)
+	assert.ErrorIs(t, cause, ErrOriginMismatch)
+}
+
+func TestNoSession(t *testing.T) {
+	t.Parallel()
+	res, _ := newApp(&Config{}, false).TestClient().Get("/form").Do()
+	routingtest.Expect(t, res).Status(http.StatusInternalServerError)
+}
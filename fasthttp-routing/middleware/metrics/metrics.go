@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/newacorn/fasthttp"
+)
+
+type Config struct {
+	// Registry 指标注册表，默认为 DefaultRegistry
+	Registry *Registry
+	// Namespace 指标名前缀，例如 wx 得到 wx_http_requests_total
+	Namespace string
+	// Buckets 请求耗时直方图的桶(秒)，默认为 DefBuckets
+	Buckets []float64
+}
+
+var DefCfg = Config{}
+
+// unmatched is the route label of the requests that match no route, so that the paths of
+// such requests, e.g. from scanners, do not create a series each.
+const unmatched = "unmatched"
+
+// New creates a middleware collecting the following metrics by method and route path:
+//
+//	http_requests_total{method,route,status}        counter
+//	http_request_duration_seconds{method,route}     histogram
+//	http_requests_in_flight{method,route}           gauge
+//
+// The status of a request failing with an error is the status of the error, see routing.HTTPError.
+// Register the middleware with RouteGroup.UseExcept to leave routes like /metrics itself out.
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	reg := cfg.Registry
+	if reg == nil {
+		reg = DefaultRegistry
+	}
+	prefix := ""
+	if cfg.Namespace != "" {
+		prefix = cfg.Namespace + "_"
+	}
+	requests := reg.CounterVec(prefix+"http_requests_total",
+		"Number of HTTP requests handled.", "method", "route", "status")
+	durations := reg.HistogramVec(prefix+"http_request_duration_seconds",
+		"Duration of HTTP requests in seconds.", cfg.Buckets, "method", "route")
+	inFlight := reg.GaugeVec(prefix+"http_requests_in_flight",
+		"Number of HTTP requests being handled.", "method", "route")
+
+	return func(c *routing.Ctx) error {
+		start := time.Now()
+		method := methodLabel(c.Method())
+		route := unmatched
+		if r := c.Route(); r != nil {
+			route = r.Path()
+		}
+		g := inFlight.WithLabelValues(method, route)
+		g.Inc()
+		// a panic must not leak the request in the gauge, even if it is recovered later
+		defer g.Dec()
+		err := c.Next()
+
+		status := c.FinalResponse().StatusCode()
+		if err != nil && !c.TimedOut() {
+			status = http.StatusInternalServerError
+			var he routing.HTTPError
+			if errors.As(err, &he) {
+				status = he.StatusCode()
+			}
+		}
+		requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		durations.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// methodLabel limits the method label to the methods of routing.Methods.
+func methodLabel(method []byte) string {
+	for _, m := range routing.Methods {
+		if string(method) == m {
+			return m
+		}
+	}
+	return "OTHER"
+}
+
+// RegisterServer registers the connection metrics of s, labelled with server=name:
+//
+//	fasthttp_server_open_connections{server}              gauge
+//	fasthttp_server_concurrency{server}                   gauge
+//	fasthttp_server_rejected_connections_total{server,reason} counter
+//
+// reason is "concurrency" for the connections rejected because of Server.Concurrency and
+// "per_ip" for those rejected because of Server.MaxConnsPerIP. Registering another server under
+// the same name replaces the previous one.
+func RegisterServer(reg *Registry, s *fasthttp.Server, name string) {
+	reg.GaugeFunc("fasthttp_server_open_connections", "Number of open connections.", func() float64 {
+		return float64(s.GetOpenConnectionsCount())
+	}, "server", name)
+	reg.GaugeFunc("fasthttp_server_concurrency", "Number of connections being served.", func() float64 {
+		return float64(s.GetCurrentConcurrency())
+	}, "server", name)
+	reg.CounterFunc("fasthttp_server_rejected_connections_total", "Number of rejected connections.", func() float64 {
+		return float64(s.GetRejectedConnectionsCount())
+	}, "server", name, "reason", "concurrency")
+	reg.CounterFunc("fasthttp_server_rejected_connections_total", "Number of rejected connections.", func() float64 {
+		return float64(s.GetPerIPRejectedConnectionsCount())
+	}, "server", name, "reason", "per_ip")
+}
+
+// RegisterHostClient registers the connection pool metrics of c, labelled with addr=c.Addr:
+//
+//	fasthttp_client_connections{addr}      gauge
+//	fasthttp_client_pending_requests{addr} gauge
+func RegisterHostClient(reg *Registry, c *fasthttp.HostClient) {
+	reg.GaugeFunc("fasthttp_client_connections", "Number of open connections of the host client.", func() float64 {
+		return float64(c.ConnsCount())
+	}, "addr", c.Addr)
+	reg.GaugeFunc("fasthttp_client_pending_requests", "Number of requests being sent by the host client.", func() float64 {
+		return float64(c.PendingRequests())
+	}, "addr", c.Addr)
+}
+
+// StoreObserver returns a function recording the duration and errors of session store operations,
+// labelled with store=name and the operation, for session.ObserveStore:
+//
+//	session_store_duration_seconds{store,op} histogram
+//	session_store_errors_total{store,op}     counter
+func StoreObserver(reg *Registry, name string) func(op string, d time.Duration, err error) {
+	durations := reg.HistogramVec("session_store_duration_seconds",
+		"Duration of session store operations in seconds.",
+		[]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "store", "op")
+	errs := reg.CounterVec("session_store_errors_total", "Number of failed session store operations.", "store", "op")
+	return func(op string, d time.Duration, err error) {
+		durations.WithLabelValues(name, op).Observe(d.Seconds())
+		if err != nil {
+			errs.WithLabelValues(name, op).Inc()
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/recovery"
+	"fasthttp-routing/routingtest"
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	reg.Counter("jobs_total", "Jobs done.").Add(3)
+	g := reg.GaugeVec("queue_length", "Queued jobs.", "queue")
+	g.WithLabelValues(`a"b`).Set(2.5)
+	g.WithLabelValues("c").Inc()
+	h := reg.Histogram("job_seconds", "", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(3)
+	reg.GaugeFunc("temperature", "Line 1\nline 2.", func() float64 { return 21 }, "room", "a")
+	reg.GaugeFunc("temperature", "", func() float64 { return 19 }, "room", "b")
+
+	assert.Equal(t, `# TYPE job_seconds histogram
+job_seconds_bucket{le="0.1"} 2
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 3
+job_seconds_sum 3.15
+job_seconds_count 3
+# HELP jobs_total Jobs done.
+# TYPE jobs_total counter
+jobs_total 3
+# HELP queue_length Queued jobs.
+# TYPE queue_length gauge
+queue_length{queue="a\"b"} 2.5
+queue_length{queue="c"} 1
+# HELP temperature Line 1\nline 2.
+# TYPE temperature gauge
+temperature{room="a"} 21
+temperature{room="b"} 19
+`, string(reg.AppendText(nil)))
+
+	// registered metrics are returned again, conflicting registrations panic
+	assert.Equal(t, uint64(3), reg.Counter("jobs_total", "").Value())
+	assert.Panics(t, func() { reg.Gauge("jobs_total", "") })
+	assert.Panics(t, func() { reg.CounterVec("jobs_total", "", "queue") })
+	assert.Panics(t, func() { reg.Counter("jobs-total", "") })
+	assert.Panics(t, func() { g.WithLabelValues() })
+}
+
+func TestMetrics(t *testing.T) {
+	reg := NewRegistry()
+	router := routing.New()
+	router.Use(New(&Config{Registry: reg, Namespace: "wx", Buckets: []float64{1}}))
+	router.Get("/users/<id>", func(c *routing.Ctx) error {
+		assert.Equal(t, float64(1), reg.GaugeVec("wx_http_requests_in_flight", "", "method", "route").
+			WithLabelValues("GET", "/users/<id>").Value())
+		return nil
+	})
+	router.Post("/fail", func(c *routing.Ctx) error {
+		return errors.New("db")
+	})
+	router.Get("/metrics", reg.Handler)
+	client := router.TestClient()
+
+	client.Get("/users/1").Do()
+	client.Get("/users/2").Do()
+	client.Post("/fail").Do()
+	client.Get("/missing/1").Do()
+	client.Request("BREW", "/missing/2").Do()
+
+	res, _ := client.Get("/metrics").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK).Header(routing.HeaderContentType, MIMETextExposition)
+	body := string(res.Body())
+	for _, line := range []string{
+		`wx_http_requests_total{method="GET",route="/users/<id>",status="200"} 2`,
+		`wx_http_requests_total{method="POST",route="/fail",status="500"} 1`,
+		`wx_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`wx_http_requests_total{method="OTHER",route="unmatched",status="404"} 1`,
+		`wx_http_request_duration_seconds_count{method="GET",route="/users/<id>"} 2`,
+		`wx_http_requests_in_flight{method="GET",route="/users/<id>"} 0`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
+
+func TestMetricsPanic(t *testing.T) {
+	reg := NewRegistry()
+	router := routing.New()
+	router.Use(recovery.New(), New(&Config{Registry: reg}))
+	router.Get("/panic", func(c *routing.Ctx) error {
+		panic("boom")
+	})
+	res, err := router.TestClient().Get("/panic").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusInternalServerError)
+	assert.Equal(t, float64(0), reg.GaugeVec("http_requests_in_flight", "", "method", "route").
+		WithLabelValues("GET", "/panic").Value())
+}
+
+func TestRegisterServer(t *testing.T) {
+	reg := NewRegistry()
+	s := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {}}
+	RegisterServer(reg, s, "wx")
+	RegisterHostClient(reg, &fasthttp.HostClient{Addr: "api.weixin.qq.com:443"})
+	observe := StoreObserver(reg, "redis")
+	observe("find", 2*time.Millisecond, nil)
+	observe("commit", time.Millisecond, errors.New("timeout"))
+
+	text := string(reg.AppendText(nil))
+	for _, line := range []string{
+		`fasthttp_server_open_connections{server="wx"} `,
+		`fasthttp_server_rejected_connections_total{server="wx",reason="concurrency"} 0`,
+		`fasthttp_server_rejected_connections_total{server="wx",reason="per_ip"} 0`,
+		`fasthttp_client_connections{addr="api.weixin.qq.com:443"} 0`,
+		`fasthttp_client_pending_requests{addr="api.weixin.qq.com:443"} 0`,
+		`session_store_duration_seconds_bucket{store="redis",op="find",le="0.0025"} 1`,
+		`session_store_errors_total{store="redis",op="commit"} 1`,
+	} {
+		assert.True(t, strings.Contains(text, line), line)
+	}
+	assert.NotContains(t, text, `session_store_errors_total{store="redis",op="find"}`)
+
+	// registering again with the same labels replaces the series
+	RegisterServer(reg, &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {}}, "wx")
+	RegisterHostClient(reg, &fasthttp.HostClient{Addr: "api.weixin.qq.com:443"})
+	reg.GaugeFunc("queue_length", "", func() float64 { return 1 })
+	reg.GaugeFunc("queue_length", "", func() float64 { return 2 })
+	text = string(reg.AppendText(nil))
+	assert.Equal(t, 1, strings.Count(text, `fasthttp_server_open_connections{server="wx"} `))
+	assert.Equal(t, 1, strings.Count(text, `fasthttp_server_rejected_connections_total{server="wx",reason="per_ip"} `))
+	assert.Equal(t, 1, strings.Count(text, `fasthttp_client_connections{addr="api.weixin.qq.com:443"} `))
+	assert.Contains(t, text, "queue_length 2\n")
+	assert.NotContains(t, text, "queue_length 1\n")
+}
@@ -0,0 +1,483 @@
+// Package metrics collects request, server, client and session store metrics and exposes them
+// in the Prometheus text exposition format, see
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format.
+//
+//	router.Use(metrics.New())
+//	metrics.RegisterServer(metrics.DefaultRegistry, router.Server(), "wx")
+//	router.Get("/metrics", metrics.DefaultRegistry.Handler)
+package metrics
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	routing "fasthttp-routing"
+)
+
+// MIMETextExposition is the content type of the Prometheus text exposition format.
+const MIMETextExposition = "text/plain; version=0.0.4; charset=utf-8"
+
+var nameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds metric families by name. Its methods return the metric registered under
+// the name, creating it on first use, and panic if the name is registered with another type
+// or other labels.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]family
+}
+
+// DefaultRegistry is the registry used by New when Config.Registry is nil.
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+type family interface {
+	typ() string
+	help() string
+	labelNames() []string
+	// write appends the samples of the family.
+	write(b []byte, name string) []byte
+}
+
+func (r *Registry) get(name, help, typ string, labels []string, create func() family) family {
+	if !nameRe.MatchString(name) {
+		panic("metrics: invalid metric name " + strconv.Quote(name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.typ() != typ || strings.Join(f.labelNames(), ",") != strings.Join(labels, ",") {
+			panic("metrics: " + name + " is already registered as a " + f.typ() + " with other labels")
+		}
+		return f
+	}
+	f := create()
+	r.families[name] = f
+	return f
+}
+
+// Counter returns the counter without labels registered under name.
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).WithLabelValues()
+}
+
+// CounterVec returns the counters registered under name, partitioned by the label names.
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return r.get(name, help, "counter", labels, func() family {
+		return &CounterVec{vec: newVec(help, labels, func() *Counter { return &Counter{} })}
+	}).(*CounterVec)
+}
+
+// Gauge returns the gauge without labels registered under name.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).WithLabelValues()
+}
+
+// GaugeVec returns the gauges registered under name, partitioned by the label names.
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return r.get(name, help, "gauge", labels, func() family {
+		return &GaugeVec{vec: newVec(help, labels, func() *Gauge { return &Gauge{} })}
+	}).(*GaugeVec)
+}
+
+// Histogram returns the histogram without labels registered under name.
+// buckets are the upper bounds of the buckets in increasing order, DefBuckets if empty.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).WithLabelValues()
+}
+
+// HistogramVec returns the histograms registered under name, partitioned by the label names.
+// The buckets of a registered histogram are kept.
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	buckets = append([]float64(nil), buckets...)
+	return r.get(name, help, "histogram", labels, func() family {
+		return &HistogramVec{vec: newVec(help, labels, func() *Histogram { return newHistogram(buckets) })}
+	}).(*HistogramVec)
+}
+
+// GaugeFunc registers a gauge whose value is returned by fn when the metrics are collected.
+// labels are pairs of label names and values; functions registered under the same name
+// must use the same label names, in the same order. Registering a function with the label
+// values of a registered one replaces it.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64, labels ...string) {
+	r.funcMetric(name, help, "gauge", fn, labels)
+}
+
+// CounterFunc is like GaugeFunc, but registers a counter, fn must never decrease.
+func (r *Registry) CounterFunc(name, help string, fn func() float64, labels ...string) {
+	r.funcMetric(name, help, "counter", fn, labels)
+}
+
+func (r *Registry) funcMetric(name, help, typ string, fn func() float64, labels []string) {
+	if len(labels)%2 != 0 {
+		panic("metrics: labels of " + name + " must be name and value pairs")
+	}
+	names := make([]string, 0, len(labels)/2)
+	values := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		names = append(names, labels[i])
+		values = append(values, labels[i+1])
+	}
+	f := r.get(name, help, typ, names, func() family {
+		return &funcFamily{t: typ, h: help, names: names}
+	}).(*funcFamily)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, s := range f.series {
+		if slices.Equal(s.values, values) {
+			f.series[i].fn = fn
+			return
+		}
+	}
+	f.series = append(f.series, funcSeries{values: values, fn: fn})
+}
+
+// Handler writes all metrics in the text exposition format, sorted by name.
+// It is a routing.Handler, so that it can be mounted with router.Get("/metrics", registry.Handler).
+func (r *Registry) Handler(c *routing.Ctx) error {
+	c.SetContentType(MIMETextExposition)
+	_, err := c.Write(r.AppendText(nil))
+	return err
+}
+
+// AppendText appends all metrics in the text exposition format to b.
+func (r *Registry) AppendText(b []byte) []byte {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		families[i] = r.families[name]
+	}
+	r.mu.RUnlock()
+	for i, f := range families {
+		if f.help() != "" {
+			b = append(b, "# HELP "...)
+			b = append(b, names[i]...)
+			b = append(b, ' ')
+			b = append(b, helpReplacer.Replace(f.help())...)
+			b = append(b, '\n')
+		}
+		b = append(b, "# TYPE "...)
+		b = append(b, names[i]...)
+		b = append(b, ' ')
+		b = append(b, f.typ()...)
+		b = append(b, '\n')
+		b = f.write(b, names[i])
+	}
+	return b
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// appendSample appends a sample line, extra is an additional label such as le of a histogram bucket.
+func appendSample(b []byte, name string, names, values []string, extraName, extraValue string, v float64) []byte {
+	b = append(b, name...)
+	if len(names) > 0 || extraName != "" {
+		b = append(b, '{')
+		for i, n := range names {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendLabel(b, n, values[i])
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				b = append(b, ',')
+			}
+			b = appendLabel(b, extraName, extraValue)
+		}
+		b = append(b, '}')
+	}
+	b = append(b, ' ')
+	b = appendFloat(b, v)
+	return append(b, '\n')
+}
+
+func appendLabel(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	b = append(b, `="`...)
+	b = append(b, labelReplacer.Replace(value)...)
+	return append(b, '"')
+}
+
+func appendFloat(b []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(b, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(b, "-Inf"...)
+	case math.IsNaN(v):
+		return append(b, "NaN"...)
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
+
+// vec holds the metrics of a family by label values.
+type vec[T any] struct {
+	h      string
+	names  []string
+	create func() *T
+	mu     sync.RWMutex
+	series map[string]*labeled[T]
+}
+
+type labeled[T any] struct {
+	values []string
+	metric *T
+}
+
+func newVec[T any](help string, names []string, create func() *T) vec[T] {
+	return vec[T]{h: help, names: names, create: create, series: make(map[string]*labeled[T])}
+}
+
+func (v *vec[T]) help() string {
+	return v.h
+}
+
+func (v *vec[T]) labelNames() []string {
+	return v.names
+}
+
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.names) {
+		panic("metrics: expected " + strconv.Itoa(len(v.names)) + " label values, got " + strconv.Itoa(len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s.metric
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = &labeled[T]{values: append([]string(nil), values...), metric: v.create()}
+		v.series[key] = s
+	}
+	return s.metric
+}
+
+// sorted returns the series sorted by label values, so that the output is stable.
+func (v *vec[T]) sorted() []*labeled[T] {
+	v.mu.RLock()
+	series := make([]*labeled[T], 0, len(v.series))
+	for _, s := range v.series {
+		series = append(series, s)
+	}
+	v.mu.RUnlock()
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+	})
+	return series
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+type CounterVec struct {
+	vec[Counter]
+}
+
+// WithLabelValues returns the counter of the label values, given in the order of the label names.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values)
+}
+
+func (v *CounterVec) typ() string {
+	return "counter"
+}
+
+func (v *CounterVec) write(b []byte, name string) []byte {
+	for _, s := range v.sorted() {
+		b = appendSample(b, name, v.names, s.values, "", "", float64(s.metric.Value()))
+	}
+	return b
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits uint64
+}
+
+func (g *Gauge) Set(f float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(f))
+}
+
+func (g *Gauge) Add(f float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+f)) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+type GaugeVec struct {
+	vec[Gauge]
+}
+
+// WithLabelValues returns the gauge of the label values, given in the order of the label names.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values)
+}
+
+func (v *GaugeVec) typ() string {
+	return "gauge"
+}
+
+func (v *GaugeVec) write(b []byte, name string) []byte {
+	for _, s := range v.sorted() {
+		b = appendSample(b, name, v.names, s.values, "", "", s.metric.Value())
+	}
+	return b
+}
+
+// DefBuckets are the default histogram buckets in seconds, suited to request latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	upper []float64
+	// counts 每个桶(不累计)的计数，最后一个为 +Inf 桶
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upper: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+// Observe adds v, e.g. a duration in seconds, to the histogram.
+func (h *Histogram) Observe(v float64) {
+	atomic.AddUint64(&h.counts[sort.SearchFloat64s(h.upper, v)], 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns the sum of the observations.
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+}
+
+type HistogramVec struct {
+	vec[Histogram]
+}
+
+// WithLabelValues returns the histogram of the label values, given in the order of the label names.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) typ() string {
+	return "histogram"
+}
+
+func (v *HistogramVec) write(b []byte, name string) []byte {
+	for _, s := range v.sorted() {
+		h := s.metric
+		var cumulative uint64
+		for i, upper := range h.upper {
+			cumulative += atomic.LoadUint64(&h.counts[i])
+			b = appendSample(b, name+"_bucket", v.names, s.values, "le", string(appendFloat(nil, upper)), float64(cumulative))
+		}
+		cumulative += atomic.LoadUint64(&h.counts[len(h.upper)])
+		b = appendSample(b, name+"_bucket", v.names, s.values, "le", "+Inf", float64(cumulative))
+		b = appendSample(b, name+"_sum", v.names, s.values, "", "", h.Sum())
+		b = appendSample(b, name+"_count", v.names, s.values, "", "", float64(cumulative))
+	}
+	return b
+}
+
+type funcFamily struct {
+	t, h   string
+	names  []string
+	mu     sync.Mutex
+	series []funcSeries
+}
+
+type funcSeries struct {
+	values []string
+	fn     func() float64
+}
+
+func (f *funcFamily) typ() string {
+	return f.t
+}
+
+func (f *funcFamily) help() string {
+	return f.h
+}
+
+func (f *funcFamily) labelNames() []string {
+	return f.names
+}
+
+func (f *funcFamily) write(b []byte, name string) []byte {
+	f.mu.Lock()
+	series := append([]funcSeries(nil), f.series...)
+	f.mu.Unlock()
+	for _, s := range series {
+		b = appendSample(b, name, f.names, s.values, "", "", s.fn())
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	shardCount = 64
+	// sweepEvery 每个分片每处理 sweepEvery 次请求清理一次过期的键
+	sweepEvery = 1024
+)
+
+// MemoryStore keeps the limits in the memory of the process, in shards locked separately.
+// Idle keys are dropped once their limit is fully restored.
+type MemoryStore struct {
+	shards [shardCount]memoryShard
+	now    func() time.Time
+}
+
+type memoryShard struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	ops     int
+}
+
+type entry struct {
+	// 令牌桶
+	tokens float64
+	last   time.Time
+	// 滑动窗口
+	window     int64
+	prev, curr float64
+
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{now: time.Now}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*entry)
+	}
+	return s
+}
+
+// Take takes one request from the limit of key.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	shard := &s.shards[fnv32(key)%shardCount]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.ops++
+	if shard.ops%sweepEvery == 0 {
+		for k, e := range shard.entries {
+			if now.After(e.expires) {
+				delete(shard.entries, k)
+			}
+		}
+	}
+	e, ok := shard.entries[key]
+	if !ok || now.After(e.expires) {
+		e = &entry{}
+		shard.entries[key] = e
+	}
+	var res Result
+	if limit.Algorithm == SlidingWindow {
+		res = e.slidingWindow(limit, now)
+		e.expires = now.Add(2 * limit.Period)
+	} else {
+		res = e.tokenBucket(limit, now)
+		e.expires = now.Add(res.Reset)
+	}
+	return res, nil
+}
+
+func (e *entry) tokenBucket(l Limit, now time.Time) Result {
+	burst := float64(l.burst())
+	// tokens per nanosecond
+	rate := float64(l.Rate) / float64(l.Period)
+	if e.last.IsZero() {
+		e.tokens = burst
+	} else if elapsed := now.Sub(e.last); elapsed > 0 {
+		e.tokens = math.Min(burst, e.tokens+float64(elapsed)*rate)
+	}
+	e.last = now
+	res := Result{Limit: int(burst)}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1 - e.tokens) / rate))
+	}
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration(math.Ceil((burst - e.tokens) / rate))
+	return res
+}
+
+func (e *entry) slidingWindow(l Limit, now time.Time) Result {
+	period := int64(l.Period)
+	window := now.UnixNano() / period
+	if e.window != window {
+		if e.window == window-1 {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.window = window
+	}
+	elapsed := now.UnixNano() - window*period
+	rate := float64(l.Rate)
+	count := e.prev*float64(period-elapsed)/float64(period) + e.curr
+	res := Result{Limit: l.Rate, Reset: time.Duration(period - elapsed)}
+	if count+1 <= rate {
+		e.curr++
+		count++
+		res.Allowed = true
+	} else if e.curr+1 > rate {
+		// wait for the next window, in which the count of this window decays
+		res.RetryAfter = time.Duration(float64(period-elapsed) + float64(period)*(1-(rate-1)/e.curr))
+	} else {
+		// wait until the count of the previous window decays enough
+		res.RetryAfter = time.Duration(float64(period)*(1-(rate-e.curr-1)/e.prev) - float64(elapsed))
+	}
+	res.Remaining = int(math.Max(0, rate-count))
+	return res
+}
+
+// fnv32 is the 32-bit FNV-1a hash of key.
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
@@ -0,0 +1,187 @@
+// Package ratelimit provides a middleware limiting the rate of requests per key, e.g. per client IP,
+// with the token bucket or the sliding window algorithm.
+//
+//	router.Use(ratelimit.New(&ratelimit.Config{
+//		Limit: ratelimit.Limit{Rate: 100, Period: time.Minute},
+//	}))
+//	// a stricter limit for a single route
+//	router.Post("/login", login).Meta(ratelimit.LimitKey, ratelimit.Limit{Rate: 5, Period: time.Minute})
+//
+// Config.Key composes with the route, see KeyRoute, or any other request data, e.g. the user of
+// the session; the requests which must not be limited at all are left out with RouteGroup.UseExcept.
+//
+// The counters are kept by a Store, NewMemoryStore for a single instance and
+// redisstore.New for instances sharing the limits.
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	routing "fasthttp-routing"
+)
+
+// Algorithm selects how a Limit is enforced.
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of Limit.Burst requests, and refills Limit.Rate tokens every Limit.Period.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit.Rate requests in any window of Limit.Period, approximated by weighting
+	// the count of the previous fixed window with its overlap with the sliding window.
+	SlidingWindow
+)
+
+// Limit is the number of requests allowed per key.
+type Limit struct {
+	// Rate 每个 Period 允许的请求数，不大于 0 表示不限制
+	Rate int
+	// Period 统计周期
+	Period time.Duration
+	// Burst 令牌桶的容量，默认为 Rate；滑动窗口忽略此字段
+	Burst int
+	// Algorithm 限流算法，默认为 TokenBucket
+	Algorithm Algorithm
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// Result is the outcome of taking one request from a limit.
+type Result struct {
+	Allowed bool
+	// Limit 对应 RateLimit-Limit，令牌桶为桶容量，滑动窗口为 Rate
+	Limit int
+	// Remaining 本次请求之后剩余的请求数
+	Remaining int
+	// Reset 额度完全恢复前的时间
+	Reset time.Duration
+	// RetryAfter 请求被拒绝时，下一个请求可以被允许前的时间
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the limits. Take must be atomic per key, so that concurrent requests,
+// possibly from several instances sharing the store, cannot exceed the limit.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// LimitKey is the route metadata key overriding Config.Limit for a route, with a Limit value.
+// Routes with their own limit are counted separately from the other routes.
+const LimitKey = "ratelimit.limit"
+
+type Config struct {
+	// Limit 默认的限制，Rate 为 0 时使用 DefCfg.Limit；可以通过路由元数据 LimitKey 为单个路由覆盖
+	Limit Limit
+	// Key 返回限流的键，默认为 KeyIP；返回空字符串时不限流
+	Key func(c *routing.Ctx) string
+	// Store 默认为进程内的 NewMemoryStore()
+	Store Store
+	// Prefix 存储键的前缀，用于多个中间件共享同一个 Store，默认为 "rl:"
+	Prefix string
+	// DisableHeaders 不设置 RateLimit-* 头部
+	DisableHeaders bool
+	// FailOpen 存储出错时记录日志并放行请求，默认返回错误
+	FailOpen bool
+}
+
+var DefCfg = Config{
+	Limit:  Limit{Rate: 60, Period: time.Minute},
+	Prefix: "rl:",
+}
+
+// KeyIP keys the limits by the client IP, see routing.Ctx.IP.
+func KeyIP(c *routing.Ctx) string {
+	return string(c.IP())
+}
+
+// KeyRoute keys the limits by the route path and the key returned by key, so that each route
+// has its own counters, e.g. KeyRoute(KeyIP) limits a client on every route separately.
+// The requests matching no route are keyed by key alone.
+func KeyRoute(key func(c *routing.Ctx) string) func(c *routing.Ctx) string {
+	return func(c *routing.Ctx) string {
+		k := key(c)
+		if route := c.Route(); route != nil && k != "" {
+			return route.Path() + "|" + k
+		}
+		return k
+	}
+}
+
+// New creates a middleware rejecting the requests over the limit with routing.ErrTooManyRequests
+// and a Retry-After header. The RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers of https://datatracker.ietf.org/doc/draft-ietf-httpapi-ratelimit-headers/
+// are set on all limited responses.
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	keyFn := cfg.Key
+	if keyFn == nil {
+		keyFn = KeyIP
+	}
+	store := cfg.Store
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = DefCfg.Prefix
+	}
+	defLimit := cfg.Limit
+	if defLimit.Rate == 0 {
+		defLimit = DefCfg.Limit
+	}
+	return func(c *routing.Ctx) error {
+		limit := defLimit
+		key := prefix
+		if l, ok := c.Meta(LimitKey).(Limit); ok {
+			limit = l
+			key += c.Route().Path() + "|"
+		}
+		if limit.Rate <= 0 || limit.Period <= 0 {
+			return c.Next()
+		}
+		k := keyFn(c)
+		if k == "" {
+			return c.Next()
+		}
+		res, err := store.Take(c.Context(), key+k, limit)
+		if err != nil {
+			if !cfg.FailOpen {
+				return err
+			}
+			c.Log().Warn().Err(err).Str("key", k).Msg("ratelimit: store failed, request allowed")
+			return c.Next()
+		}
+		if !cfg.DisableHeaders {
+			setHeaders(c, limit, res)
+		}
+		if !res.Allowed {
+			c.Response.Header.Set(routing.HeaderRetryAfter, strconv.Itoa(seconds(res.RetryAfter)))
+			return routing.ErrTooManyRequests
+		}
+		return c.Next()
+	}
+}
+
+func setHeaders(c *routing.Ctx, limit Limit, res Result) {
+	h := &c.Response.Header
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(limit.Rate)+";w="+strconv.Itoa(seconds(limit.Period)))
+}
+
+// seconds rounds d up to whole seconds, as the headers take delta seconds.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/routingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Period: time.Second, Burst: 3}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, _ := store.Take(ctx, "k", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, _ := store.Take(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 3, res.Limit)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	// one token is refilled every 500ms
+	now = now.Add(500 * time.Millisecond)
+	res, _ = store.Take(ctx, "k", limit)
+	assert.True(t, res.Allowed)
+	res, _ = store.Take(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+
+	// other keys are independent
+	res, _ = store.Take(ctx, "other", limit)
+	assert.True(t, res.Allowed)
+
+	// a restored bucket is dropped and starts full again
+	now = now.Add(time.Hour)
+	res, _ = store.Take(ctx, "k", limit)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 4, Period: time.Second, Algorithm: SlidingWindow}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		res, _ := store.Take(ctx, "k", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3-i, res.Remaining)
+	}
+	res, _ := store.Take(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	// the next window starts in 1s, and 1/4 of it must pass for the count to drop to 3
+	assert.Equal(t, 1250*time.Millisecond, res.RetryAfter)
+
+	// half way through the next window, the previous window counts for half
+	now = now.Add(1500 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		res, _ = store.Take(ctx, "k", limit)
+		assert.True(t, res.Allowed)
+	}
+	res, _ = store.Take(ctx, "k", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	// the previous window must decay to 1 request
+	assert.Equal(t, 250*time.Millisecond, res.RetryAfter)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("redis down")
+}
+
+func TestRateLimit(t *testing.T) {
+	store := NewMemoryStore()
+	router := routing.New()
+	router.Use(New(&Config{Limit: Limit{Rate: 2, Period: time.Minute}, Store: store}))
+	router.Get("/", func(c *routing.Ctx) error {
+		return nil
+	})
+	router.Post("/login", func(c *routing.Ctx) error {
+		return nil
+	}).Meta(LimitKey, Limit{Rate: 1, Period: time.Minute})
+	router.Get("/open", func(c *routing.Ctx) error {
+		return nil
+	}).Meta(LimitKey, Limit{})
+	client := router.TestClient()
+	get := func(uri, ip string) *routing.TestResponse {
+		res, err := client.Get(uri).RemoteIP(ip).Do()
+		assert.Nil(t, err)
+		return res
+	}
+
+	for i := 1; i >= 0; i-- {
+		routingtest.Expect(t, get("/", "10.0.0.1")).Status(routing.StatusOK).
+			Header("RateLimit-Limit", "2").
+			Header("RateLimit-Remaining", strconv.Itoa(i)).
+			Header("RateLimit-Policy", "2;w=60")
+	}
+	routingtest.Expect(t, get("/", "10.0.0.1")).Status(routing.StatusTooManyRequests).
+		Header(routing.HeaderRetryAfter, "30").
+		Header("RateLimit-Reset", "60")
+	routingtest.Expect(t, get("/", "10.0.0.2")).Status(routing.StatusOK)
+
+	// routes with their own limit are counted separately
+	res, _ := client.Post("/login").RemoteIP("10.0.0.1").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK).Header("RateLimit-Limit", "1")
+	res, _ = client.Post("/login").RemoteIP("10.0.0.1").Do()
+	routingtest.Expect(t, res).Status(routing.StatusTooManyRequests)
+	for i := 0; i < 3; i++ {
+		routingtest.Expect(t, get("/open", "10.0.0.1")).Status(routing.StatusOK).Header("RateLimit-Limit", "")
+	}
+
+	// routes keyed separately with KeyRoute
+	router = routing.New()
+	router.Use(New(&Config{Limit: Limit{Rate: 1, Period: time.Minute}, Key: KeyRoute(KeyIP)}))
+	router.Get("/a", func(c *routing.Ctx) error {
+		return nil
+	})
+	router.Get("/b", func(c *routing.Ctx) error {
+		return nil
+	})
+	client = router.TestClient()
+	routingtest.Expect(t, get("/a", "10.0.0.1")).Status(routing.StatusOK)
+	routingtest.Expect(t, get("/b", "10.0.0.1")).Status(routing.StatusOK)
+	routingtest.Expect(t, get("/a", "10.0.0.1")).Status(routing.StatusTooManyRequests)
+	routingtest.Expect(t, get("/a", "10.0.0.2")).Status(routing.StatusOK)
+
+	router = routing.New()
+	router.Use(New(&Config{Store: failingStore{}, FailOpen: true, Key: func(c *routing.Ctx) string {
+		return string(c.QueryArgs().Peek("openid"))
+	}}))
+	router.Get("/", func(c *routing.Ctx) error {
+		return nil
+	})
+	res, _ = router.TestClient().Get("/?openid=o1").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK)
+
+	router = routing.New()
+	router.Use(New(&Config{Store: failingStore{}}))
+	router.Get("/", func(c *routing.Ctx) error {
+		return nil
+	})
+	res, _ = router.TestClient().Get("/").Do()
+	routingtest.Expect(t, res).Status(routing.StatusInternalServerError)
+}
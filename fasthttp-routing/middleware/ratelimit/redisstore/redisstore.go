@@ -0,0 +1,119 @@
+// Package redisstore provides a ratelimit.Store sharing the limits between instances through Redis.
+// Each request runs a Lua script, so that the limits are updated atomically, with the clock of
+// the Redis server, so that the clocks of the instances do not matter.
+package redisstore
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"fasthttp-routing/middleware/ratelimit"
+	"github.com/redis/rueidis"
+)
+
+// tokenBucketScript returns {allowed, remaining, retry after ms, reset ms}.
+var tokenBucketScript = rueidis.NewLuaScript(`
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+elseif now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / period)
+end
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * period / rate)
+end
+local reset = math.ceil((burst - tokens) * period / rate)
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+
+// slidingWindowScript returns {allowed, remaining, retry after ms, reset ms}.
+var slidingWindowScript = rueidis.NewLuaScript(`
+local rate = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = math.floor(now / period)
+local state = redis.call('HMGET', KEYS[1], 'window', 'prev', 'curr')
+local prev = 0
+local curr = 0
+local w = tonumber(state[1])
+if w == window then
+	prev = tonumber(state[2])
+	curr = tonumber(state[3])
+elseif w == window - 1 then
+	prev = tonumber(state[3])
+end
+local elapsed = now - window * period
+local count = prev * (period - elapsed) / period + curr
+local allowed = 0
+local retry = 0
+if count + 1 <= rate then
+	curr = curr + 1
+	count = count + 1
+	allowed = 1
+elseif curr + 1 > rate then
+	retry = math.ceil(period - elapsed + period * (1 - (rate - 1) / curr))
+else
+	retry = math.ceil(period * (1 - (rate - curr - 1) / prev) - elapsed)
+end
+redis.call('HSET', KEYS[1], 'window', window, 'prev', prev, 'curr', curr)
+redis.call('PEXPIRE', KEYS[1], 2 * period)
+return {allowed, math.max(0, math.floor(rate - count)), retry, period - elapsed}
+`)
+
+type RedisStore struct {
+	cli    rueidis.Client
+	prefix string
+}
+
+func New(client rueidis.Client) *RedisStore {
+	return NewWithPrefix(client, "")
+}
+
+// NewWithPrefix creates a store prefixing the keys with prefix, in addition to ratelimit.Config.Prefix.
+func NewWithPrefix(client rueidis.Client, prefix string) *RedisStore {
+	return &RedisStore{cli: client, prefix: prefix}
+}
+
+// Take takes one request from the limit of key. Periods are handled with millisecond precision.
+func (r *RedisStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	period := strconv.FormatInt(limit.Period.Milliseconds(), 10)
+	rate := strconv.Itoa(limit.Rate)
+	keys := []string{r.prefix + key}
+	var resp rueidis.RedisResult
+	res := ratelimit.Result{Limit: limit.Rate}
+	if limit.Algorithm == ratelimit.SlidingWindow {
+		resp = slidingWindowScript.Exec(ctx, r.cli, keys, []string{rate, period})
+	} else {
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Rate
+		}
+		res.Limit = burst
+		resp = tokenBucketScript.Exec(ctx, r.cli, keys, []string{rate, period, strconv.Itoa(burst)})
+	}
+	values, err := resp.AsIntSlice()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	res.Allowed = values[0] == 1
+	res.Remaining = int(values[1])
+	res.RetryAfter = time.Duration(values[2]) * time.Millisecond
+	res.Reset = time.Duration(values[3]) * time.Millisecond
+	return res, nil
+}
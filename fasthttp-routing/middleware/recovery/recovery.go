@@ -0,0 +1,90 @@
+package recovery
+
+import (
+	"fmt"
+	"runtime"
+
+	routing "fasthttp-routing"
+)
+
+// PanicError is returned by the middleware when a subsequent handler panics.
+// It is handled by Router.ErrorHandler like any other error, and rendered as a 500 error.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic, empty if DisableStack is set.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+type Config struct {
+	Skip routing.Skipper
+	// StackSize is the maximum number of bytes of the captured stack trace. Default 4KB.
+	StackSize int
+	// DisableStack disables capturing the stack trace.
+	DisableStack bool
+	// Handler is called with the recovered panic, before the error is returned to the router.
+	// The default handler logs the panic value and the stack trace.
+	Handler func(c *routing.Ctx, err *PanicError)
+}
+
+var DefCfg = Config{
+	StackSize: 4 << 10,
+	Handler:   logPanic,
+}
+
+// New creates a middleware that recovers from panics in the handlers after it and
+// converts them into a *PanicError returned from the handler chain. A *PanicError panic value
+// is returned as is, keeping the stack trace captured where the panic happened.
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	return func(c *routing.Ctx) (err error) {
+		if cfg.Skip != nil && cfg.Skip(c) {
+			return c.Next()
+		}
+		defer func() {
+			if v := recover(); v != nil {
+				// a *PanicError is re-raised with the stack of the goroutine which panicked, e.g. by the timeout middleware
+				pe, ok := v.(*PanicError)
+				if !ok {
+					pe = &PanicError{Value: v}
+					if !cfg.DisableStack {
+						size := cfg.StackSize
+						if size <= 0 {
+							size = DefCfg.StackSize
+						}
+						pe.Stack = make([]byte, size)
+						pe.Stack = pe.Stack[:runtime.Stack(pe.Stack, false)]
+					}
+				} else if cfg.DisableStack {
+					pe.Stack = nil
+				}
+				if cfg.Handler != nil {
+					cfg.Handler(c, pe)
+				}
+				c.Abort()
+				err = pe
+			}
+		}()
+		return c.Next()
+	}
+}
+
+func logPanic(c *routing.Ctx, err *PanicError) {
+	c.Log().Error().Str("panic", fmt.Sprint(err.Value)).Bytes("method", c.Method()).Bytes("path", c.Path()).
+		Bytes("stack", err.Stack).Msg("recovered from panic")
+}
@@ -0,0 +1,64 @@
+package recovery
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	routing "fasthttp-routing"
+	"github.com/newacorn/fasthttp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecovery(t *testing.T) {
+	var recovered *PanicError
+	router := routing.New()
+	router.ErrorHandler = routing.RenderError
+	router.Use(New(&Config{Handler: func(c *routing.Ctx, err *PanicError) {
+		recovered = err
+	}}))
+	cause := errors.New("db is down")
+	router.Get("/panic", func(c *routing.Ctx) error {
+		panic(cause)
+	})
+	router.Get("/ok", func(c *routing.Ctx) error {
+		c.SetBodyString("ok")
+		return nil
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/panic")
+	ctx.Request.Header.Set(routing.HeaderAccept, routing.MIMEApplicationJSON)
+	router.HandleRequest(ctx)
+	assert.Equal(t, http.StatusInternalServerError, ctx.Response.StatusCode())
+	assert.Equal(t, `{"status":500,"message":"Internal Server Error"}`, string(ctx.Response.Body()))
+	assert.NotNil(t, recovered)
+	assert.True(t, errors.Is(recovered, cause))
+	assert.Contains(t, string(recovered.Stack), "recovery.TestRecovery")
+
+	// the pooled context keeps serving requests after a panic
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/ok")
+	router.HandleRequest(ctx)
+	assert.Equal(t, "ok", string(ctx.Response.Body()))
+}
+
+func TestLogPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	router := routing.New()
+	router.App.Log = &logger
+	router.Use(New())
+	router.Get("/panic", func(c *routing.Ctx) error {
+		panic("boom")
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/panic")
+	router.HandleRequest(ctx)
+	assert.Equal(t, http.StatusInternalServerError, ctx.Response.StatusCode())
+	assert.Contains(t, buf.String(), `"panic":"boom"`)
+	assert.Contains(t, buf.String(), `"path":"/panic"`)
+}
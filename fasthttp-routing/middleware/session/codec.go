@@ -6,54 +6,116 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
-	"github.com/valyala/bytebufferpool"
 )
 
 // Codec is the interface for encoding/decoding session data to and from a byte
 // slice for use by the session store.
+// The deadline is the absolute expiry of the session, see Data.Deadline. Data encoded before the
+// deadline was kept may decode to a zero deadline, the session then gets a new one.
 type Codec interface {
-	Encode(csrfToken []byte, values map[string]interface{}) ([]byte, error)
-	Decode(encodedData []byte, dstCsrfToken []byte) (csrfToken []byte, values map[string]interface{}, err error)
+	Encode(deadline time.Time, csrfToken []byte, values map[string]interface{}) ([]byte, error)
+	Decode(encodedData []byte, dstCsrfToken []byte) (deadline time.Time, csrfToken []byte, values map[string]interface{}, err error)
+}
+
+// MigrationCodec encodes the session data with Codec, and decodes the data encoded by Codec or,
+// failing that, by one of Previous, so that a store can hold the sessions written by different
+// codecs while the instances are switched to another codec. The sessions are written again with
+// Codec when they are modified. For instance, to switch from JSONCodec to MsgpackCodec, first
+// deploy
+//
+//	MigrationCodec{Codec: JSONCodec{}, Previous: []Codec{MsgpackCodec{}}}
+//
+// so that all the instances read the new format, then
+//
+//	MigrationCodec{Codec: MsgpackCodec{}, Previous: []Codec{JSONCodec{}}}
+//
+// and finally MsgpackCodec alone once the sessions written with JSONCodec have expired.
+type MigrationCodec struct {
+	Codec    Codec
+	Previous []Codec
+}
+
+func (m MigrationCodec) Encode(deadline time.Time, csrfToken []byte, values map[string]interface{}) ([]byte, error) {
+	return m.Codec.Encode(deadline, csrfToken, values)
+}
+
+func (m MigrationCodec) Decode(encodedData []byte, dstCsrfToken []byte) (deadline time.Time, csrfToken []byte, values map[string]interface{}, err error) {
+	deadline, csrfToken, values, err = m.Codec.Decode(encodedData, dstCsrfToken)
+	if err == nil {
+		return
+	}
+	for _, codec := range m.Previous {
+		deadline2, csrfToken2, values2, err2 := codec.Decode(encodedData, dstCsrfToken)
+		if err2 == nil {
+			return deadline2, csrfToken2, values2, nil
+		}
+	}
+	return
+}
+
+// ConvertValue converts v with the first of Codec and Previous implementing ValueConverter which
+// succeeds, as v may have been decoded by any of them.
+func (m MigrationCodec) ConvertValue(v interface{}, dst interface{}) (err error) {
+	err = NewDataError("convert value: no codec implements ValueConverter")
+	for _, codec := range append([]Codec{m.Codec}, m.Previous...) {
+		if c, ok := codec.(ValueConverter); ok {
+			if err = c.ConvertValue(v, dst); err == nil {
+				return nil
+			}
+		}
+	}
+	return
+}
+
+func init() {
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+	gob.Register([]FlashMessage{})
 }
 
 // GobCodec is used for encoding/decoding session data to and from a byte
-// slice using the encoding/gob package.
+// slice using the encoding/gob package. The types of the values, other than
+// the basic types, map[string]interface{}, []interface{} and time.Time, must be
+// registered with gob.Register.
 type GobCodec struct{}
 
-// Encode converts a session deadline and values into a byte slice.
-func (GobCodec) Encode(deadline time.Time, values map[string]interface{}) ([]byte, *bytebufferpool.ByteBuffer, error) {
-	aux := &struct {
-		Deadline time.Time
-		Values   map[string]interface{}
-	}{
-		Deadline: deadline,
-		Values:   values,
-	}
-	b := bytebufferpool.Get()
+type gobAux struct {
+	Deadline  time.Time
+	CsrfToken []byte
+	Values    map[string]interface{}
+}
 
-	// var b bytes.Buffer
-	if err := gob.NewEncoder(b).Encode(&aux); err != nil {
+// Encode converts a session deadline, CSRF token and values into a byte slice.
+func (GobCodec) Encode(deadline time.Time, csrfToken []byte, values map[string]interface{}) ([]byte, error) {
+	aux := &gobAux{
+		Deadline:  deadline,
+		CsrfToken: csrfToken,
+		Values:    values,
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(aux); err != nil {
 		err = NewDataError("codecEncode:" + err.Error())
 		log.Error().Str("Error", err.Error()).Send()
-		return nil, b, err
+		return nil, err
 	}
 
-	return b.Bytes(), b, nil
+	return b.Bytes(), nil
 }
 
-// Decode converts a byte slice into a session deadline and values.
-func (GobCodec) Decode(b []byte) (time.Time, map[string]interface{}, error) {
-	aux := &struct {
-		Deadline time.Time
-		Values   map[string]interface{}
-	}{}
+// Decode converts a byte slice into a session deadline, CSRF token and values.
+func (GobCodec) Decode(b []byte, dstCsrfToken []byte) (time.Time, []byte, map[string]interface{}, error) {
+	aux := &gobAux{}
 
 	r := bytes.NewReader(b)
-	if err := gob.NewDecoder(r).Decode(&aux); err != nil {
+	if err := gob.NewDecoder(r).Decode(aux); err != nil {
 		err = NewDataError("decode session data: " + err.Error())
 		log.Error().Str("Err", err.Error()).Send()
-		return time.Time{}, nil, err
+		return time.Time{}, nil, nil, err
+	}
+	if aux.Values == nil {
+		aux.Values = make(map[string]interface{})
 	}
 
-	return aux.Deadline, aux.Values, nil
+	return aux.Deadline, append(dstCsrfToken, aux.CsrfToken...), aux.Values, nil
 }
@@ -0,0 +1,68 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+var benchCodecs = []struct {
+	name  string
+	codec Codec
+}{
+	{"JSON", JSONCodec{}},
+	{"Msgpack", MsgpackCodec{}},
+}
+
+func codecValues() map[string]interface{} {
+	return map[string]interface{}{
+		"userID":   "1123239fjsaldfjlsdaafsdfsdfsdf",
+		"login":    true,
+		"visits":   42,
+		"lastSeen": time.Now(),
+		"cart":     []interface{}{"sku-1", "sku-2", 3},
+		"prefs":    map[string]interface{}{"lang": "zh-CN", "theme": "dark", "pageSize": 20},
+		"raw":      []byte("322222222222222222aflsfjlasjflasjlfjasldfjlsadfjlas23293890283"),
+	}
+}
+
+func BenchmarkCodecEncode(b *testing.B) {
+	deadline := time.Now().Add(time.Hour)
+	csrfToken := []byte("3121289182798127afsdfasfoweir2323werw0e8rw")
+	values := codecValues()
+	for _, c := range benchCodecs {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var n int
+			for i := 0; i < b.N; i++ {
+				data, err := c.codec.Encode(deadline, csrfToken, values)
+				if err != nil {
+					b.Fatal(err)
+				}
+				n = len(data)
+			}
+			b.ReportMetric(float64(n), "bytes")
+		})
+	}
+}
+
+func BenchmarkCodecDecode(b *testing.B) {
+	deadline := time.Now().Add(time.Hour)
+	csrfToken := []byte("3121289182798127afsdfasfoweir2323werw0e8rw")
+	values := codecValues()
+	for _, c := range benchCodecs {
+		b.Run(c.name, func(b *testing.B) {
+			data, err := c.codec.Encode(deadline, csrfToken, values)
+			if err != nil {
+				b.Fatal(err)
+			}
+			dst := make([]byte, 0, len(csrfToken))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, _, err = c.codec.Decode(data, dst[:0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package session
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgpackCodec(t *testing.T) {
+	t.Parallel()
+	deadline := time.UnixMilli(time.Now().UnixMilli())
+	values := map[string]interface{}{
+		"nil":     nil,
+		"bool":    true,
+		"int":     -1 << 40,
+		"small":   -3,
+		"uint64":  uint64(math.MaxUint64),
+		"int8":    int8(-100),
+		"float":   1.5,
+		"float32": float32(2.5),
+		"string":  "s",
+		"long":    string(make([]byte, 70000)),
+		"bytes":   []byte{0, 1, 2},
+		"time":    time.Unix(1<<35, 5),
+		"time32":  time.Unix(1700000000, 0),
+		"time64":  time.Unix(1700000000, 999),
+		"dur":     3 * time.Second,
+		"cart":    testCart{Items: []string{"a"}, Total: 1},
+		"other":   testUnregistered{Name: "x"},
+		"array":   []interface{}{1, "a", map[string]interface{}{"k": 2.5}},
+		"strings": []string{"a", "b"},
+	}
+	codec := MsgpackCodec{}
+	b, err := codec.Encode(deadline, []byte("csrf"), values)
+	assert.Nil(t, err)
+	dl, csrfToken, got, err := codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.True(t, deadline.Equal(dl))
+	assert.Equal(t, "csrf", string(csrfToken))
+	for key, v := range values {
+		if tm, ok := v.(time.Time); ok {
+			assert.True(t, tm.Equal(got[key].(time.Time)), key)
+			continue
+		}
+		if key == "other" {
+			assert.Equal(t, map[string]interface{}{"Name": "x"}, got[key])
+			continue
+		}
+		assert.Equal(t, v, got[key], key)
+	}
+
+	d := &Data{manager: &Manager{Codec: codec}, values: got}
+	assert.Equal(t, int64(-1<<40), d.GetInt64("int"))
+	assert.Equal(t, int32(-3), d.GetInt32("small"))
+	assert.Equal(t, float64(-3), d.GetFloat("small"))
+	_, ok := Get[int32](d, "int")
+	assert.False(t, ok)
+	_, ok = Get[uint](d, "small")
+	assert.False(t, ok)
+	_, ok = Get[int](d, "float")
+	assert.False(t, ok)
+	u, ok := Get[testUnregistered](d, "other")
+	assert.True(t, ok)
+	assert.Equal(t, "x", u.Name)
+
+	// no deadline and no values
+	b, err = codec.Encode(time.Time{}, nil, nil)
+	assert.Nil(t, err)
+	dl, _, got, err = codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.True(t, dl.IsZero())
+	assert.NotNil(t, got)
+}
+
+func TestMsgpackCodecInvalid(t *testing.T) {
+	t.Parallel()
+	codec := MsgpackCodec{}
+	b, err := codec.Encode(time.Now(), []byte("csrf"), map[string]interface{}{"a": []byte("abc"), "b": "c"})
+	assert.Nil(t, err)
+	for i := 0; i < len(b); i++ {
+		_, _, _, err = codec.Decode(b[:i], nil)
+		assert.NotNil(t, err, i)
+	}
+	_, _, _, err = codec.Decode(append(b, 0), nil)
+	assert.NotNil(t, err)
+	_, _, _, err = codec.Decode([]byte(`{"V":{}}`), nil)
+	assert.NotNil(t, err)
+	_, _, _, err = codec.Decode(append([]byte{msgpackMagic, msgpackVersion + 1}, b[2:]...), nil)
+	assert.NotNil(t, err)
+	// a map of 2^32-1 entries
+	_, _, _, err = codec.Decode([]byte{msgpackMagic, msgpackVersion, 0, 0xa0, 0xdf, 0xff, 0xff, 0xff, 0xff}, nil)
+	assert.NotNil(t, err)
+
+	nested := map[string]interface{}{}
+	for i := 0; i < msgpackMaxDepth+1; i++ {
+		nested = map[string]interface{}{"n": nested}
+	}
+	_, err = codec.Encode(time.Time{}, nil, nested)
+	assert.NotNil(t, err)
+}
+
+func TestMsgpackCodecCorruptTyped(t *testing.T) {
+	t.Parallel()
+	ext := func(name string, value ...byte) []byte {
+		payload := append(appendMsgpackStr(nil, name), value...)
+		return append(appendMsgpackExtHeader(nil, len(payload), msgpackExtTyped), payload...)
+	}
+	tags, _ := typeName(testTags{})
+	counts, _ := typeName(testCounts{})
+	dur, _ := typeName(time.Duration(0))
+	for _, b := range [][]byte{
+		ext(tags, 0xc0),
+		ext(dur, 0xc0),
+		// [1]
+		ext(tags, 0x91, 0x01),
+		// {"a": "b"}
+		ext(counts, 0x81, 0xa1, 'a', 0xa1, 'b'),
+		ext(dur, 0xa1, 'a'),
+	} {
+		d := msgpackDecoder{b: b}
+		_, err := d.value(msgpackMaxDepth)
+		var dataErr *DataError
+		assert.ErrorAs(t, err, &dataErr, "%x", b)
+	}
+
+	// the values of the registered type are still decoded
+	d := msgpackDecoder{b: ext(dur, 0x05)}
+	v, err := d.value(msgpackMaxDepth)
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Nanosecond, v)
+}
+
+// FuzzMsgpackCodec checks that corrupt session data is reported with an error, never a panic.
+func FuzzMsgpackCodec(f *testing.F) {
+	codec := MsgpackCodec{}
+	for _, values := range []map[string]interface{}{
+		nil,
+		{"int": 1, "string": "s", "bytes": []byte("b"), "time": time.Unix(1700000000, 0)},
+		{"cart": testCart{Items: []string{"a"}, Total: 1}, "tags": testTags{"a"}, "counts": testCounts{"a": 1}},
+		{"dur": time.Second, "array": []interface{}{1.5, nil, map[string]interface{}{"k": true}}},
+	} {
+		b, err := codec.Encode(time.Now(), []byte("csrf"), values)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		_, _, _, _ = codec.Decode(b, nil)
+	})
+}
+
+func TestGobCodec(t *testing.T) {
+	t.Parallel()
+	deadline := time.Now()
+	codec := GobCodec{}
+	b, err := codec.Encode(deadline, []byte("csrf"), map[string]interface{}{"int": 1, "time": deadline})
+	assert.Nil(t, err)
+	dl, csrfToken, values, err := codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.True(t, deadline.Equal(dl))
+	assert.Equal(t, "csrf", string(csrfToken))
+	assert.Equal(t, 1, values["int"])
+	assert.True(t, deadline.Equal(values["time"].(time.Time)))
+}
+
+func TestMigrationCodec(t *testing.T) {
+	t.Parallel()
+	values := map[string]interface{}{"int": 1}
+	jsonData, _ := JSONCodec{}.Encode(time.Time{}, []byte("old"), values)
+	codec := MigrationCodec{Codec: MsgpackCodec{}, Previous: []Codec{GobCodec{}, JSONCodec{}}}
+	_, csrfToken, got, err := codec.Decode(jsonData, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(csrfToken))
+	assert.Equal(t, 1, got["int"])
+
+	b, err := codec.Encode(time.Time{}, []byte("new"), values)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(msgpackMagic), b[0])
+	_, csrfToken, got, err = codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(csrfToken))
+	assert.Equal(t, 1, got["int"])
+
+	_, _, _, err = codec.Decode([]byte("garbage"), nil)
+	assert.NotNil(t, err)
+
+	d := &Data{manager: &Manager{Codec: codec}, values: map[string]interface{}{"f": float64(2)}}
+	assert.Equal(t, int64(2), d.GetInt64("f"))
+}
+
+// TestCodecMiddleware switches a store from JSONCodec to MsgpackCodec during a session.
+func TestCodecMiddleware(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewMemoryStoreWithCleanup(0)
+	app := routing.New()
+	app.Use(New(&cfg))
+	app.Get("/put", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("count", d.GetInt("count")+1)
+		d.Put("at", time.Unix(1700000000, 0))
+		return nil
+	})
+	client := app.TestClient()
+	_, err := client.Get("/put").Do()
+	assert.Nil(t, err)
+
+	cfg.manager.Codec = MigrationCodec{Codec: MsgpackCodec{}, Previous: []Codec{JSONCodec{}}}
+	_, err = client.Get("/put").Do()
+	assert.Nil(t, err)
+	cfg.manager.Codec = MsgpackCodec{}
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		assert.Equal(t, 2, d.Get("count"))
+		assert.Equal(t, int64(1700000000), d.GetTime("at").Unix())
+		return nil
+	})
+	_, err = client.Get("/get").Do()
+	assert.Nil(t, err)
+}
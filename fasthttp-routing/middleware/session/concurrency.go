@@ -0,0 +1,198 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConflictPolicy controls how a session modified by concurrent requests is committed, see
+// Config.Conflict.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite commits the data of the request over the data committed by the concurrent
+	// requests since it was loaded: the last commit wins.
+	ConflictOverwrite ConflictPolicy = iota
+
+	// ConflictMerge applies the keys put or removed by the request to the latest data of the
+	// store, and commits again, up to Config.MaxCommitRetries times before failing with a
+	// ConflictError. The values put by the request win over the values of the concurrent requests.
+	ConflictMerge
+
+	// ConflictReject fails the commit with a ConflictError, so that the client can retry the
+	// request with the latest session.
+	ConflictReject
+)
+
+const (
+	// DefaultMaxCommitRetries is the default of Config.MaxCommitRetries.
+	DefaultMaxCommitRetries = 3
+	// DefaultLockTimeout is the default of Config.LockTimeout.
+	DefaultLockTimeout = 5 * time.Second
+	// DefaultLockTTL is the default of Config.LockTTL.
+	DefaultLockTTL = 30 * time.Second
+)
+
+// storeAs returns store as a T, seeing through ObserveStore, which implements all the optional
+// interfaces.
+func storeAs[T any](store Store) (t T, ok bool) {
+	if o, isObserved := store.(*observedStore); isObserved {
+		if _, ok = o.store.(T); !ok {
+			return
+		}
+	}
+	t, ok = store.(T)
+	return
+}
+
+// versionedStore returns the store when the conflicts are handled.
+func (s *Manager) versionedStore() (VersionedStore, bool) {
+	if s.Conflict == ConflictOverwrite {
+		return nil, false
+	}
+	return storeAs[VersionedStore](s.Store)
+}
+
+func (s *Manager) doStoreFindVersion(ctx context.Context, vs VersionedStore, token []byte) (b []byte, version string, found bool, err error) {
+	b, version, found, err = vs.FindVersion(contextOrBackground(ctx), storeKey(token))
+	if err != nil {
+		err = NewStoreError("find session data:" + err.Error())
+		log.Error().Str("Err", err.Error()).Bytes("token", token).Msg("find session data occur error")
+	}
+	return
+}
+
+// commitVersion commits data if the session has not been committed by another request since it
+// was loaded, and handles the conflict according to Conflict otherwise.
+func (s *Manager) commitVersion(ctx context.Context, vs VersionedStore, data *Data) (err error) {
+	ctx = contextOrBackground(ctx)
+	for i := 0; ; i++ {
+		var b []byte
+		b, err = s.Codec.Encode(data.deadline, data.csrfToken, data.values)
+		if err != nil {
+			return NewEncodingError(err.Error())
+		}
+		var committed bool
+		committed, err = vs.CommitVersion(ctx, storeKey(data.token), b, data.expiry(), data.version)
+		if err != nil {
+			err = NewStoreError("commit session data:" + err.Error())
+			log.Error().Str("Err", err.Error()).Msg("commit session data occur error")
+			return
+		}
+		if committed {
+			return nil
+		}
+		if s.Conflict == ConflictReject || i >= s.MaxCommitRetries {
+			err = NewConflictError("session modified by a concurrent request")
+			log.Warn().Str("Err", err.Error()).Int("retries", i).Msg("commit session data occur conflict")
+			return
+		}
+		if err = s.mergeLatest(ctx, vs, data); err != nil {
+			return
+		}
+	}
+}
+
+// mergeLatest replaces the values of data with the latest values of the store, with the keys put
+// or removed by the request applied.
+func (s *Manager) mergeLatest(ctx context.Context, vs VersionedStore, data *Data) (err error) {
+	b, version, found, err := s.doStoreFindVersion(ctx, vs, data.token)
+	if err != nil {
+		return
+	}
+	values := make(map[string]interface{}, len(data.values))
+	if found {
+		_, csrfToken, latest, err := s.Codec.Decode(b, nil)
+		if err != nil {
+			return NewEncodingError(err.Error())
+		}
+		if !data.cleared && latest != nil {
+			values = latest
+		}
+		if !data.csrfChanged {
+			data.csrfToken = append(data.csrfToken[:0], csrfToken...)
+		}
+	}
+	for key := range data.changed {
+		if v, ok := data.values[key]; ok {
+			values[key] = v
+		} else {
+			delete(values, key)
+		}
+	}
+	data.values = values
+	data.version = version
+	return nil
+}
+
+// lockSession acquires the lock of the session token, waiting LockTimeout at most.
+func (s *Manager) lockSession(ctx context.Context, token []byte) (unlock func(), err error) {
+	locker, ok := storeAs[LockingStore](s.Store)
+	if !ok {
+		locker = &s.locker
+	}
+	ctx, cancel := context.WithTimeout(contextOrBackground(ctx), s.LockTimeout)
+	defer cancel()
+	unlock, err = locker.Lock(ctx, storeKey(token), s.LockTTL)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = ErrLockTimeout
+	} else if err != nil {
+		err = NewStoreError("lock session:" + err.Error())
+	}
+	if err != nil {
+		log.Warn().Str("Err", err.Error()).Msg("lock session occur error")
+	}
+	return
+}
+
+// localLocker locks the sessions in the process, for the stores which do not implement
+// LockingStore.
+type localLocker struct {
+	mu    sync.Mutex
+	locks map[string]*localLock
+}
+
+type localLock struct {
+	// ch 容量为 1，持有锁时其中有一个元素
+	ch chan struct{}
+	// refs 持有以及等待此锁的请求数，为 0 时从 locks 中删除
+	refs int
+}
+
+func (l *localLocker) Lock(ctx context.Context, token []byte, _ time.Duration) (unlock func(), err error) {
+	key := string(token)
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*localLock)
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &localLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+	select {
+	case lock.ch <- struct{}{}:
+		return func() {
+			<-lock.ch
+			l.release(key, lock)
+		}, nil
+	case <-ctx.Done():
+		l.release(key, lock)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *localLocker) release(key string, lock *localLock) {
+	l.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+	l.mu.Unlock()
+}
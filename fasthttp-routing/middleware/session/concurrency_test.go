@@ -0,0 +1,162 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrentApp serves /slow, which puts a and waits for release before committing, and /fast,
+// which puts b.
+func concurrentApp(cfg *Config) (app *routing.Router, started chan struct{}, release chan struct{}) {
+	started, release = make(chan struct{}), make(chan struct{})
+	app = routing.New()
+	app.Use(New(cfg))
+	app.Get("/init", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("init", "1")
+		return nil
+	})
+	app.Get("/slow", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("a", "1")
+		d.Remove("init")
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	app.Get("/fast", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("b", d.GetString("a")+"2")
+		return nil
+	})
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		c.SetBodyString(d.GetString("init") + "|" + d.GetString("a") + "|" + d.GetString("b"))
+		return nil
+	})
+	return
+}
+
+// runConcurrent runs /slow and /fast with the same session, /fast committing while /slow is
+// running, and returns the status of /slow and the session data afterwards.
+func runConcurrent(t *testing.T, cfg *Config) (status int, body string) {
+	app, started, release := concurrentApp(cfg)
+	client := app.TestClient()
+	res, err := client.Get("/init").Do()
+	assert.Nil(t, err)
+	cookie := string(res.Cookie(cfg.CokName).Value())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res, err := app.TestClient().Get("/slow").Cookie(cfg.CokName, cookie).Do()
+		if assert.Nil(t, err) {
+			status = res.StatusCode()
+		}
+	}()
+	<-started
+	res, err = app.TestClient().Get("/fast").Cookie(cfg.CokName, cookie).Do()
+	assert.Nil(t, err)
+	close(release)
+	wg.Wait()
+
+	res, err = client.Get("/get").Do()
+	assert.Nil(t, err)
+	return status, string(res.Body())
+}
+
+func TestConflict(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name   string
+		policy ConflictPolicy
+		status int
+		body   string
+	}{
+		// the last commit wins, dropping b
+		{"Overwrite", ConflictOverwrite, 200, "|1|"},
+		// the changes of /slow are applied to the data committed by /fast
+		{"Merge", ConflictMerge, 200, "|1|2"},
+		{"Reject", ConflictReject, 500, "1||2"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := DefCfg
+			cfg.Store = NewMemoryStoreWithCleanup(0)
+			cfg.Conflict = tc.policy
+			status, body := runConcurrent(t, &cfg)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.body, body)
+		})
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewMemoryStoreWithCleanup(0)
+	cfg.LockSession = true
+	app, started, release := concurrentApp(&cfg)
+	client := app.TestClient()
+	res, _ := client.Get("/init").Do()
+	cookie := string(res.Cookie(cfg.CokName).Value())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = app.TestClient().Get("/slow").Cookie(cfg.CokName, cookie).Do()
+	}()
+	<-started
+	fastDone := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		defer close(fastDone)
+		_, _ = app.TestClient().Get("/fast").Cookie(cfg.CokName, cookie).Do()
+	}()
+	select {
+	case <-fastDone:
+		t.Fatal("want /fast to wait for the lock held by /slow")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	wg.Wait()
+
+	// /fast has loaded the session once /slow has committed it
+	res, _ = client.Get("/get").Do()
+	assert.Equal(t, "|1|12", string(res.Body()))
+}
+
+func TestLockSessionTimeout(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewMemoryStoreWithCleanup(0)
+	cfg.LockSession = true
+	cfg.LockTimeout = 50 * time.Millisecond
+	app, started, release := concurrentApp(&cfg)
+	res, _ := app.TestClient().Get("/init").Do()
+	cookie := string(res.Cookie(cfg.CokName).Value())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = app.TestClient().Get("/slow").Cookie(cfg.CokName, cookie).Do()
+	}()
+	<-started
+	res, err := app.TestClient().Get("/fast").Cookie(cfg.CokName, cookie).Do()
+	assert.Nil(t, err)
+	assert.Equal(t, 500, res.StatusCode())
+	close(release)
+	<-done
+
+	// the lock is released once /slow has committed
+	res, _ = app.TestClient().Get("/get").Cookie(cfg.CokName, cookie).Do()
+	assert.Equal(t, "|1|", string(res.Body()))
+	assert.Empty(t, cfg.manager.locker.locks)
+}
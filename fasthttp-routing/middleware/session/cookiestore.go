@@ -0,0 +1,248 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/rs/zerolog/log"
+	"helpers/utilcrypt"
+)
+
+const (
+	cookieVersion = 1
+	// cookieHeaderLen 版本号加 AES-GCM 的 nonce
+	cookieHeaderLen = 1 + 12
+	// DefaultCookieChunkSize keeps each cookie, with its name and attributes, under the 4KB limit of the browsers.
+	DefaultCookieChunkSize = 3800
+	// DefaultCookieMaxChunks keeps the Cookie header of the requests under the 16KB buffer of most servers.
+	// The ReadBufferSize of fasthttp.Server, 4KB by default, must be large enough as well.
+	DefaultCookieMaxChunks = 3
+)
+
+// CookieStore keeps the sessions in the cookies of the client, sealed with AES-GCM, so that no
+// server-side state is shared between the instances. It is set as Config.Store:
+//
+//	cfg := session.DefCfg
+//	cfg.Store = session.NewCookieStore(key, oldKeys...)
+//	cfg.AppendHash = utilcrypt.NewHMACHash(hashKey)
+//	session.New(&cfg)
+//
+// The session data, the session token and the expiry of the session are encrypted and authenticated
+// together, with the cookie name as additional data. The sealed value is split into the cookies
+// CokName, CokName.1, CokName.2 and so on when it is larger than ChunkSize.
+//
+// The methods of Store return ErrCookieStore: the session middleware reads the sessions from the
+// request cookies and writes them to the response cookies, also when the store is wrapped by
+// ObserveStore, so the sessions cannot be loaded outside of their requests. A session cannot be
+// revoked before its expiry, as its cookie remains valid: keep Lifetime short, and rotate the key
+// to revoke all the sessions.
+type CookieStore struct {
+	// aeads[0] 加密使用的密钥，其余为轮换前的旧密钥，仅用于解密
+	aeads []cipher.AEAD
+	// ChunkSize 每个 cookie 值的最大字节数，默认为 DefaultCookieChunkSize
+	ChunkSize int
+	// MaxChunks 会话最多拆分的 cookie 个数，默认为 DefaultCookieMaxChunks，超出时提交返回 EncodingError
+	MaxChunks int
+}
+
+// NewCookieStore creates a CookieStore sealing the sessions with key, and opening the sessions
+// sealed with key or one of oldKeys. It panics if a key is not 16, 24 or 32 bytes long.
+func NewCookieStore(key []byte, oldKeys ...[]byte) *CookieStore {
+	s := &CookieStore{}
+	for _, k := range append([][]byte{key}, oldKeys...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			panic("session: " + err.Error())
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic("session: " + err.Error())
+		}
+		s.aeads = append(s.aeads, aead)
+	}
+	return s
+}
+
+// cookieSessions is implemented by the stores whose sessions are handled by the middleware in
+// the cookies: CookieStore, and ObserveStore wrapping a CookieStore.
+type cookieSessions interface {
+	handleCookieSession(c *routing.Ctx, cfg *Config) error
+}
+
+func (s *CookieStore) Find(token []byte) (b []byte, found bool, err error) {
+	return nil, false, ErrCookieStore
+}
+
+func (s *CookieStore) Commit(token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	return ErrCookieStore
+}
+
+func (s *CookieStore) Delete(token []byte) (err error) {
+	return ErrCookieStore
+}
+
+func (s *CookieStore) chunkSize() int {
+	if s.ChunkSize > 0 {
+		return s.ChunkSize
+	}
+	return DefaultCookieChunkSize
+}
+
+func (s *CookieStore) maxChunks() int {
+	if s.MaxChunks > 0 {
+		return s.MaxChunks
+	}
+	return DefaultCookieMaxChunks
+}
+
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return name + "." + strconv.Itoa(i)
+}
+
+// seal encrypts the expiry, the token and b.
+func (s *CookieStore) seal(name string, token, b []byte, expiry time.Time) []byte {
+	aead := s.aeads[0]
+	plain := make([]byte, 9, 9+len(token)+len(b))
+	binary.BigEndian.PutUint64(plain, uint64(expiry.UnixMilli()))
+	plain[8] = byte(len(token))
+	plain = append(append(plain, token...), b...)
+
+	sealed := make([]byte, cookieHeaderLen, cookieHeaderLen+len(plain)+aead.Overhead())
+	sealed[0] = cookieVersion
+	utilcrypt.DefaultRandomBytesGenerator(sealed[1:cookieHeaderLen])
+	sealed = aead.Seal(sealed, sealed[1:cookieHeaderLen], plain, []byte(name))
+	return sealed
+}
+
+// open decrypts a value of seal, trying the current key then the old keys. found is false when
+// the value is malformed, was not sealed with one of the keys, or has expired.
+func (s *CookieStore) open(name string, sealed []byte, now time.Time) (token, b []byte, expiry time.Time, found bool) {
+	if len(sealed) < cookieHeaderLen || sealed[0] != cookieVersion {
+		return
+	}
+	nonce, ciphertext := sealed[1:cookieHeaderLen], sealed[cookieHeaderLen:]
+	for _, aead := range s.aeads {
+		plain, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil {
+			continue
+		}
+		if len(plain) < 9 || len(plain) < 9+int(plain[8]) {
+			return
+		}
+		expiry = time.UnixMilli(int64(binary.BigEndian.Uint64(plain)))
+		if !now.Before(expiry) {
+			return
+		}
+		n := 9 + int(plain[8])
+		return plain[9:n], plain[n:], expiry, true
+	}
+	return
+}
+
+// load reads the session sealed in the request cookies into data. It returns the number of
+// chunks sent by the client, and whether a valid session has been loaded.
+func (s *CookieStore) load(c *routing.Ctx, name string, data *Data) (chunks int, found bool) {
+	var value []byte
+	for ; chunks < s.maxChunks()+1; chunks++ {
+		v := c.Request.Header.Cookie(chunkName(name, chunks))
+		if len(v) == 0 {
+			break
+		}
+		value = append(value, v...)
+	}
+	if chunks == 0 {
+		return
+	}
+	sealed := make([]byte, base64.RawURLEncoding.DecodedLen(len(value)))
+	n, err := base64.RawURLEncoding.Decode(sealed, value)
+	if err != nil {
+		log.Info().Str("Err", err.Error()).Msg("decode session cookie occur error")
+		return
+	}
+	token, b, _, ok := s.open(name, sealed[:n], time.Now())
+	if !ok || len(token) != UrlEncodedTokenLen {
+		log.Info().Msg("invalid or expired session cookie")
+		return
+	}
+	deadline, csrfToken, values, err := data.manager.Codec.Decode(b, data.csrfToken[:0])
+	if err != nil {
+		log.Warn().Str("Err", err.Error()).Msg("decode session data occur error")
+		return
+	}
+	data.token = append(data.token[:0], token...)
+	data.deadline = deadline
+	data.csrfToken = csrfToken
+	data.values = values
+	return chunks, true
+}
+
+// save writes the session to the response cookies, and removes the chunks of the request
+// which are not used anymore.
+func (s *CookieStore) save(c *routing.Ctx, cfg *Config, data *Data, chunks int) (err error) {
+	b, err := data.manager.Codec.Encode(data.deadline, data.csrfToken, data.values)
+	if err != nil {
+		return NewEncodingError(err.Error())
+	}
+	expiry := data.expiry()
+	sealed := s.seal(cfg.CokName, data.token, b, expiry)
+	value := make([]byte, base64.RawURLEncoding.EncodedLen(len(sealed)))
+	base64.RawURLEncoding.Encode(value, sealed)
+
+	size := s.chunkSize()
+	n := (len(value) + size - 1) / size
+	if n > s.maxChunks() {
+		return NewEncodingError("session data too large for " + strconv.Itoa(s.maxChunks()) + " cookies: " +
+			strconv.Itoa(len(value)) + " bytes")
+	}
+	rememberMe := data.GetBool("__rememberMe")
+	for i := 0; i < n; i++ {
+		end := min((i+1)*size, len(value))
+		cfg.setCookie(c, chunkName(cfg.CokName, i), value[i*size:end], rememberMe, expiry)
+	}
+	s.deleteChunks(c, cfg, n, chunks)
+	return nil
+}
+
+// deleteChunks removes the cookies of the chunks from, from+1, ... to-1.
+func (s *CookieStore) deleteChunks(c *routing.Ctx, cfg *Config, from, to int) {
+	for i := from; i < to; i++ {
+		cfg.deleteCookie(c, chunkName(cfg.CokName, i))
+	}
+}
+
+// handleCookieSession is handleStatefulRequest for CookieStore.
+func (s *CookieStore) handleCookieSession(c *routing.Ctx, cfg *Config) (err error) {
+	data := cfg.manager.dataPool.Acquire()
+	chunks, found := s.load(c, cfg.CokName, data)
+	if !found {
+		data.token = data.GenerateSessionId()
+	}
+	if err = data.Start(true, nil); err != nil {
+		cfg.manager.dataPool.Release(data)
+		return
+	}
+	c.SetUserValue(ContextKey, data)
+	err = c.Next()
+	if c.TimedOut() {
+		// data may still be used by the handlers which did not finish in time
+		return
+	}
+	if data.status == Destroyed {
+		s.deleteChunks(c, cfg, 0, max(chunks, 1))
+	} else if err2 := s.save(c, cfg, data, chunks); err2 != nil {
+		log.Error().Str("Error", err2.Error()).Msg("sessionManager commit data occur error")
+		if err == nil {
+			err = err2
+		}
+	}
+	cfg.manager.dataPool.Release(data)
+	return
+}
@@ -0,0 +1,170 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/routingtest"
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+	"helpers/utilcrypt"
+)
+
+func TestCookieStore(t *testing.T) {
+	t.Parallel()
+	oldKey := utilcrypt.RandomKey(32)
+	cfg := DefCfg
+	cfg.Store = NewCookieStore(oldKey)
+	cfg.AppendHash = utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))
+	cfg.Lifetime = time.Hour
+	app := routing.New()
+	app.Use(New(&cfg))
+	app.Post("/put", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("foo", string(c.FormValue("v")))
+		return nil
+	})
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		c.SetBodyString(d.GetString("foo") + "|" + string(d.Token()))
+		return nil
+	})
+	// the Cookie header of a session in several cookies exceeds the default buffer
+	client := app.TestClient(&fasthttp.Server{ReadBufferSize: 16 << 10})
+	put := func(v string) *routing.TestResponse {
+		res, err := client.Post("/put").Form(map[string]string{"v": v}).Do()
+		assert.Nil(t, err)
+		return res
+	}
+
+	res := put("bar")
+	sealed := string(res.Cookie(cfg.CokName).Value())
+	assert.NotContains(t, sealed, "bar")
+	res, _ = client.Get("/get").Do()
+	body := strings.Split(string(res.Body()), "|")
+	assert.Equal(t, "bar", body[0])
+	token := body[1]
+	assert.Len(t, token, UrlEncodedTokenLen)
+
+	// tampered cookies start a new session
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+	res, _ = client.Get("/get").Cookie(cfg.CokName, string(tampered)).Do()
+	body = strings.Split(string(res.Body()), "|")
+	assert.Equal(t, "", body[0])
+	assert.NotEqual(t, token, body[1])
+	token = body[1]
+
+	// large sessions are split into several cookies, which are dropped when the session shrinks
+	res = put(strings.Repeat("x", 5000))
+	assert.NotNil(t, res.Cookie(cfg.CokName+".1"))
+	res, _ = client.Get("/get").Do()
+	assert.True(t, string(res.Body()) == strings.Repeat("x", 5000)+"|"+token)
+	res = put("small")
+	assert.Equal(t, 0, len(res.Cookie(cfg.CokName+".1").Value()))
+	res = put(strings.Repeat("x", 20000))
+	routingtest.Expect(t, res).Status(routing.StatusInternalServerError)
+
+	// sessions sealed with an old key are still opened after the rotation
+	cfg.Store.(*CookieStore).aeads = NewCookieStore(utilcrypt.RandomKey(32), oldKey).aeads
+	res, _ = client.Get("/get").Do()
+	assert.Equal(t, "small|"+token, string(res.Body()))
+}
+
+// TestCookieStorePath checks that the stale chunks are deleted with the Path and Domain they were
+// set with, otherwise the browser keeps them and the next session does not open.
+func TestCookieStorePath(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewCookieStore(utilcrypt.RandomKey(32))
+	cfg.AppendHash = utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))
+	cfg.CokPath = "/app"
+	cfg.CokDomain = "example.com"
+	app := routing.New()
+	app.Use(New(&cfg))
+	app.Post("/put", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("foo", string(c.FormValue("v")))
+		return nil
+	})
+	app.Post("/destroy", func(c *routing.Ctx) error {
+		return cfg.manager.Destroy(context.Background(), c)
+	})
+	client := app.TestClient(&fasthttp.Server{ReadBufferSize: 16 << 10})
+	_, err := client.Post("/put").Form(map[string]string{"v": strings.Repeat("x", 5000)}).Do()
+	assert.Nil(t, err)
+	res, err := client.Post("/put").Form(map[string]string{"v": "small"}).Do()
+	assert.Nil(t, err)
+	for _, name := range []string{cfg.CokName, cfg.CokName + ".1"} {
+		cok := res.Cookie(name)
+		assert.Equal(t, "/app", string(cok.Path()), name)
+		assert.Equal(t, "example.com", string(cok.Domain()), name)
+	}
+	assert.True(t, res.Cookie(cfg.CokName+".1").Expire().Before(time.Now()))
+
+	res, err = client.Post("/destroy").Do()
+	assert.Nil(t, err)
+	cok := res.Cookie(cfg.CokName)
+	assert.Equal(t, "/app", string(cok.Path()))
+	assert.True(t, cok.Expire().Before(time.Now()))
+}
+
+func TestCookieStoreExpiry(t *testing.T) {
+	s := NewCookieStore(utilcrypt.RandomKey(32))
+	now := time.Now()
+	sealed := s.seal("session", []byte("token"), []byte("data"), now.Add(time.Minute))
+	token, b, _, found := s.open("session", sealed, now)
+	assert.True(t, found)
+	assert.Equal(t, "token", string(token))
+	assert.Equal(t, "data", string(b))
+	_, _, _, found = s.open("session", sealed, now.Add(2*time.Minute))
+	assert.False(t, found)
+	// the cookie name is authenticated
+	_, _, _, found = s.open("other", sealed, now)
+	assert.False(t, found)
+}
+
+// TestCookieStoreObserved checks that a CookieStore wrapped by ObserveStore still keeps the
+// sessions in the cookies, and that they can be renewed and destroyed.
+func TestCookieStoreObserved(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	var ops []string
+	cfg.Store = ObserveStore(NewCookieStore(utilcrypt.RandomKey(32)), func(op string, d time.Duration, err error) {
+		ops = append(ops, op)
+	})
+	cfg.AppendHash = utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))
+	app := routing.New()
+	app.Use(New(&cfg))
+	app.Get("/put", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("foo", "bar")
+		return cfg.manager.RenewToken(c, c)
+	})
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		c.SetBodyString(d.GetString("foo"))
+		return nil
+	})
+	app.Get("/logout", func(c *routing.Ctx) error {
+		return cfg.manager.Destroy(c, c)
+	})
+	client := app.TestClient()
+
+	res, _ := client.Get("/put").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK)
+	res, _ = client.Get("/get").Do()
+	routingtest.Expect(t, res).Body("bar")
+	res, _ = client.Get("/logout").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK)
+	assert.True(t, res.Cookie(cfg.CokName).Expire().Before(time.Now()))
+	res, _ = client.Get("/get").Do()
+	routingtest.Expect(t, res).Body("")
+	assert.Empty(t, ops, "the store methods are not used")
+
+	_, _, err := cfg.Store.Find([]byte("token"))
+	assert.ErrorIs(t, err, ErrCookieStore)
+}
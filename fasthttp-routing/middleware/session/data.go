@@ -38,6 +38,21 @@ type Data struct {
 	values    map[string]interface{}
 	manager   *Manager
 	started   bool
+	// deadline 会话的绝对过期时间，创建会话或者更换 token 时设置
+	deadline time.Time
+	// idleDeadline 本次请求之后没有活动时会话的过期时间，未配置 IdleTimeout 时为零值
+	idleDeadline time.Time
+	// userID 存储中按用户索引此会话时使用的用户 ID，提交时与 UserID() 不同则更新索引
+	userID string
+	// version 加载时存储中数据的版本，仅在 Manager.Conflict 不为 ConflictOverwrite 时使用
+	version string
+	// changed 本次请求设置或者删除的键，cleared 本次请求清空了数据，csrfChanged 本次请求生成了 CSRF 令牌，
+	// 用于与并发请求提交的数据合并
+	changed     map[string]struct{}
+	cleared     bool
+	csrfChanged bool
+	// flashes 上一个请求设置的闪存消息，加载会话时从数据中取出
+	flashes []FlashMessage
 }
 
 func (d *Data) reset() {
@@ -46,15 +61,32 @@ func (d *Data) reset() {
 	clear(d.values)
 	d.status = Unmodified
 	d.started = false
+	d.deadline = time.Time{}
+	d.idleDeadline = time.Time{}
+	d.userID = ""
+	d.version = ""
+	clear(d.changed)
+	d.cleared = false
+	d.csrfChanged = false
+	d.flashes = nil
+}
+
+// markChanged records that key has been put or removed by the request.
+func (d *Data) markChanged(key string) {
+	if d.changed == nil {
+		d.changed = make(map[string]struct{})
+	}
+	d.changed[key] = struct{}{}
 }
 
 func (d *Data) Manager() *Manager {
 	return d.manager
 }
 
+// GenerateToken2 fills dstRaw with random bytes followed by the tag of appendHash, and encodes it to dst.
 func GenerateToken2(dstRaw []byte, dst []byte, appendHash utilcrypt.BytesWithHash) (token []byte) {
 
-	_, err := unsafefn.NoescapeRead(rand.Reader, dstRaw[:len(dstRaw)-2])
+	_, err := unsafefn.NoescapeRead(rand.Reader, dstRaw[:appendHash.DecodedLen(len(dstRaw))])
 	if err != nil {
 		err = NewTokenError("genToken:" + err.Error())
 		log.Panic().Str("Err", err.Error()).Msg("gen session token")
@@ -109,6 +141,7 @@ func GenerateToken(size int, dst []byte, appendHash utilcrypt.BytesWithHash, url
 func (d *Data) Put(key string, val any) {
 	d.values[key] = val
 	d.status = Modified
+	d.markChanged(key)
 }
 func (d *Data) SetToken(token []byte) (newToken bool) {
 	if len(token) > 0 && d.isValidToken(token, d.manager.AppendHash) {
@@ -130,15 +163,30 @@ func (d *Data) Start(newToken bool, ctx context.Context) (err error) {
 
 	if len(d.csrfToken) == 0 {
 		dstRaw := make([]byte, AppendHashCsrfTokenLen)
-		d.csrfToken = GenerateToken2(dstRaw, d.csrfToken[:UrlEncodedCsrfTokenLen], d.manager.AppendHash)
+		d.csrfToken = GenerateToken2(dstRaw, d.csrfTokenBuf(), d.manager.AppendHash)
+		d.csrfChanged = true
 		// d.RegenerateCsrfToken()
 	}
+	now := time.Now()
+	if d.deadline.IsZero() {
+		d.deadline = now.Add(d.manager.Lifetime)
+	}
+	if d.manager.IdleTimeout > 0 {
+		d.idleDeadline = now.Add(d.manager.IdleTimeout)
+	}
+	d.takeFlashes()
 	d.started = true
 	return
 }
 func (d *Data) LoadSession(ctx context.Context) (err error) {
 	// 根据token从存储中加载序列化的session数据，并解码到sessionData类型实例
-	dataBytes, found, err := d.manager.doStoreFind(ctx, (*routing.Ctx)(nil), d.token)
+	var dataBytes []byte
+	var found bool
+	if vs, ok := d.manager.versionedStore(); ok {
+		dataBytes, d.version, found, err = d.manager.doStoreFindVersion(ctx, vs, d.token)
+	} else {
+		dataBytes, found, err = d.manager.doStoreFind(ctx, (*routing.Ctx)(nil), d.token)
+	}
 	if err != nil {
 		err = NewStoreError("find session data from session store: " + err.Error())
 		// 从存储中索取数据时遇到错误，这类错误不生成新的Session
@@ -147,7 +195,7 @@ func (d *Data) LoadSession(ctx context.Context) (err error) {
 	if !found {
 		return
 	}
-	if d.csrfToken, d.values, err = d.manager.Codec.Decode(dataBytes, d.csrfToken[0:0]); err != nil {
+	if d.deadline, d.csrfToken, d.values, err = d.manager.Codec.Decode(dataBytes, d.csrfToken[0:0]); err != nil {
 		// 数据损坏，解码错误，删除对应的数据
 		if err != nil {
 			log.Warn().Str("Err", err.Error()).Msg("decode session data occur error")
@@ -159,13 +207,27 @@ func (d *Data) LoadSession(ctx context.Context) (err error) {
 		if err != nil {
 			log.Warn().Str("Error", err.Error()).Msg("session data corrupt->delete token from session store")
 		}
+		d.version = ""
 		err = nil
 		return
 	}
+	if !d.deadline.IsZero() && !time.Now().Before(d.deadline) {
+		// 超过绝对过期时间的会话，存储未按过期时间删除时在此丢弃
+		_ = d.manager.doStoreDelete(ctx, d.token)
+		d.reset()
+		d.token = d.GenerateSessionId()
+		return
+	}
+	d.userID = d.UserID()
 	return
 }
 func (d *Data) isValidToken(token []byte, appendHash utilcrypt.BytesWithHash) bool {
 	// token存在与cookie中
+	// d.token 的前面是存储键的前缀，长度不同的 token 会使 d.token 重新分配而丢失前缀
+	if len(token) != UrlEncodedTokenLen {
+		log.Info().Bytes("token", token).Msg("invalid session token length")
+		return false
+	}
 	urlDecodedToken := make([]byte, base64.RawURLEncoding.DecodedLen(len(token)))
 	n, err := base64.RawURLEncoding.Decode(urlDecodedToken, token)
 	urlDecodedToken = urlDecodedToken[:n]
@@ -192,7 +254,7 @@ func (d *Data) MergeSession(ctx context.Context, c *routing.Ctx, token []byte) (
 	if err != nil || !found {
 		return nil
 	}
-	_, values, err := d.manager.Codec.Decode(encodedData, nil)
+	_, _, values, err := d.manager.Codec.Decode(encodedData, nil)
 	if err != nil {
 		return
 	}
@@ -202,6 +264,7 @@ func (d *Data) MergeSession(ctx context.Context, c *routing.Ctx, token []byte) (
 		_, ok := d.values[k]
 		if !ok {
 			d.values[k] = v
+			d.markChanged(k)
 		}
 	}
 	d.status = Modified
@@ -222,6 +285,7 @@ func (d *Data) Pop(key string) interface{} {
 	}
 	delete(d.values, key)
 	d.status = Modified
+	d.markChanged(key)
 	return val
 }
 
@@ -232,6 +296,7 @@ func (d *Data) Remove(key string) {
 	}
 	delete(d.values, key)
 	d.status = Modified
+	d.markChanged(key)
 }
 
 func (d *Data) Clear() error {
@@ -240,6 +305,8 @@ func (d *Data) Clear() error {
 	}
 	clear(d.values)
 	d.status = Modified
+	d.cleared = true
+	clear(d.changed)
 	return nil
 }
 
@@ -260,12 +327,18 @@ func (d *Data) Keys() []string {
 
 func (d *Data) Flush() {
 	clear(d.values)
+	d.cleared = true
+	clear(d.changed)
 }
 
 //goland:noinspection GoDirectComparisonOfErrors
 func (d *Data) Migrate(destroy bool) {
 	if destroy {
-		if len(d.token) != 0 {
+		if len(d.token) != 0 && d.userID != "" {
+			_ = d.manager.doUserIndexDelete(context.Background(), d.userID, storeKey(d.token))
+			d.userID = ""
+		}
+		if len(d.token) != 0 && !d.manager.inCookies() {
 			tokenWithPrefix := unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(d.token)), -len(sessionPrefix))), UrlEncodedTokenWithPrefixLen)
 			err := d.manager.Store.Delete(tokenWithPrefix)
 			if err != nil {
@@ -274,6 +347,9 @@ func (d *Data) Migrate(destroy bool) {
 		}
 	}
 	d.token = d.GenerateSessionId()
+	d.deadline = time.Now().Add(d.manager.Lifetime)
+	// the new token is not in the store
+	d.version = ""
 	d.status = Modified
 }
 func (d *Data) GenerateSessionId() []byte {
@@ -289,10 +365,20 @@ func (d *Data) Regenerate(destroy bool) (err error) {
 func (d *Data) RegenerateCsrfToken() {
 	// csrfToken, _ := d.values["_token"].([]byte)
 	// d.csrfToken = GenerateToken(20, d.csrfToken[:0], d.manager.AppendHash, true)
-	dstRaw := make([]byte, CsrfTokenLen)
-	d.csrfToken = GenerateToken2(dstRaw, d.csrfToken[:0], d.manager.AppendHash)
+	dstRaw := make([]byte, AppendHashCsrfTokenLen)
+	d.csrfToken = GenerateToken2(dstRaw, d.csrfTokenBuf(), d.manager.AppendHash)
+	d.csrfChanged = true
 	return
 }
+
+// csrfTokenBuf returns the buffer of the CSRF token, which may have been replaced by a shorter
+// token decoded from the store, e.g. one issued with a shorter hash.
+func (d *Data) csrfTokenBuf() []byte {
+	if cap(d.csrfToken) < UrlEncodedCsrfTokenLen {
+		d.csrfToken = make([]byte, 0, UrlEncodedCsrfTokenLen)
+	}
+	return d.csrfToken[:UrlEncodedCsrfTokenLen]
+}
 func (d *Data) Invalidate() {
 	d.Flush()
 	d.Migrate(true)
@@ -302,122 +388,93 @@ func (d *Data) Status() Status {
 	return d.status
 }
 
-func (d *Data) GetString(key string) string {
-	val := d.Get(key)
-	str, ok := val.(string)
-	if !ok {
-		return ""
+// Deadline returns the absolute expiry of the session, Manager.Lifetime after its creation or
+// the last renewal of its token, whatever the activity.
+func (d *Data) Deadline() time.Time {
+	return d.deadline
+}
+
+// IdleDeadline returns the time when the session expires if no other request uses it,
+// Manager.IdleTimeout after the current request but never later than Deadline.
+// It is the zero time when Manager.IdleTimeout is not set.
+func (d *Data) IdleDeadline() time.Time {
+	if d.idleDeadline.After(d.deadline) {
+		return d.deadline
 	}
-	return str
+	return d.idleDeadline
 }
 
-func (d *Data) GetBool(key string) bool {
-	val := d.Get(key)
-	b, ok := val.(bool)
-	if !ok {
-		return false
+// expiry returns the expiry of the session in the store and of its cookie.
+func (d *Data) expiry() time.Time {
+	if d.idleDeadline.IsZero() {
+		return d.deadline
 	}
-	return b
+	return d.IdleDeadline()
+}
+
+func (d *Data) GetString(key string) string {
+	v, _ := Get[string](d, key)
+	return v
+}
+
+func (d *Data) GetBool(key string) bool {
+	v, _ := Get[bool](d, key)
+	return v
 }
 
 func (d *Data) GetInt(key string) int {
-	val := d.Get(key)
-	i, ok := val.(int)
-	if !ok {
-		return 0
-	}
-	return i
+	v, _ := Get[int](d, key)
+	return v
 }
 
 func (d *Data) GetInt64(key string) int64 {
-	val := d.Get(key)
-	i, ok := val.(int64)
-	if !ok {
-		return 0
-	}
-	return i
+	v, _ := Get[int64](d, key)
+	return v
 }
 
 func (d *Data) GetInt32(key string) int32 {
-	val := d.Get(key)
-	i, ok := val.(int32)
-	if !ok {
-		return 0
-	}
-	return i
+	v, _ := Get[int32](d, key)
+	return v
 }
 
 func (d *Data) GetFloat(key string) float64 {
-	val := d.Get(key)
-	f, ok := val.(float64)
-	if !ok {
-		return 0
-	}
-	return f
+	v, _ := Get[float64](d, key)
+	return v
 }
 
 func (d *Data) GetTime(key string) time.Time {
-	val := d.Get(key)
-	t, ok := val.(time.Time)
-	if !ok {
-		return time.Time{}
-	}
-	return t
+	v, _ := Get[time.Time](d, key)
+	return v
 }
 
 func (d *Data) PopString(key string) string {
-	val := d.Pop(key)
-	str, ok := val.(string)
-	if !ok {
-		return ""
-	}
-	return str
+	v, _ := Pop[string](d, key)
+	return v
 }
 
 func (d *Data) PopBool(key string) bool {
-	val := d.Pop(key)
-	b, ok := val.(bool)
-	if !ok {
-		return false
-	}
-	return b
-
+	v, _ := Pop[bool](d, key)
+	return v
 }
 
 func (d *Data) PopInt(key string) int {
-	val := d.Pop(key)
-	i, ok := val.(int)
-	if !ok {
-		return 0
-	}
-	return i
+	v, _ := Pop[int](d, key)
+	return v
 }
 
 func (d *Data) PopFloat(key string) float64 {
-	val := d.Pop(key)
-	f, ok := val.(float64)
-	if !ok {
-		return 0
-	}
-	return f
+	v, _ := Pop[float64](d, key)
+	return v
 }
 
 func (d *Data) PopBytes(key string) []byte {
-	val := d.Pop(key)
-	b, ok := val.([]byte)
-	if !ok {
-		return nil
-	}
-	return b
+	v, _ := Pop[[]byte](d, key)
+	return v
 }
 
 func (d *Data) PopTime(key string) time.Time {
-	val := d.Pop(key)
-	t, ok := val.(time.Time)
-	if !ok {
-		return time.Time{}
-	}
-	return t
+	v, _ := Pop[time.Time](d, key)
+	return v
 }
 
 func (d *Data) RememberMe(val bool) {
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"errors"
 	"reflect"
 )
 
@@ -41,3 +42,28 @@ func (s *StoreError) Error() string {
 func NewStoreError(err string) *StoreError {
 	return &StoreError{s: err}
 }
+
+// ConflictError is returned by the middleware when the session has been modified by a concurrent
+// request and Config.Conflict is ConflictReject.
+type ConflictError struct {
+	s string
+}
+
+func NewConflictError(err string) *ConflictError {
+	return &ConflictError{s: err}
+}
+func (c *ConflictError) Error() string {
+	return reflect.TypeOf(c).String() + c.s
+}
+
+// ErrUserIndexNotSupported is returned by the methods of Manager using the index of the sessions
+// by user when the store does not implement UserIndexStore.
+var ErrUserIndexNotSupported = errors.New("session: the store does not implement UserIndexStore")
+
+// ErrLockTimeout is returned by the middleware when the lock of the session has not been acquired
+// within Config.LockTimeout.
+var ErrLockTimeout = errors.New("session: timed out waiting for the session lock")
+
+// ErrCookieStore is returned by the methods of Store of CookieStore, whose sessions are only kept
+// in the cookies of the requests.
+var ErrCookieStore = errors.New("session: the sessions of a CookieStore are kept in the request cookies")
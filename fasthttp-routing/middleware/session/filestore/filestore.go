@@ -0,0 +1,545 @@
+// Package filestore provides a session.Store keeping each session in a file of a directory,
+// for single-node deployments which must keep the sessions across restarts without Redis.
+//
+// A file holds the expiry, the token and the data of a session. It is named after the SHA-256
+// of the token, so that tokens never reach the file system as paths, and is replaced atomically
+// by renaming a temporary file, so that a crash never leaves a partially written session.
+// The index of the sessions of a user is kept the same way, in a file of the users subdirectory.
+package filestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ext     = ".session"
+	userExt = ".user"
+	tmpExt  = ".tmp"
+	// usersDir 用户会话索引文件所在的子目录
+	usersDir = "users"
+	// headerLen 8 字节的过期时间（Unix 纳秒）加 2 字节的 token 长度
+	headerLen = 10
+	// userEntryHeaderLen 索引中每个会话的 8 字节过期时间、2 字节 token 长度与 4 字节信息长度
+	userEntryHeaderLen = 14
+)
+
+// DefaultCleanupInterval is the interval of the sweeping of the expired sessions of New.
+const DefaultCleanupInterval = 5 * time.Minute
+
+type FileStore struct {
+	dir string
+	// interval 清理过期会话的间隔，也是清理崩溃遗留的临时文件前等待的时间
+	interval time.Duration
+	// locks 按文件名的第一个字节串行化对同一文件的写入与清理
+	locks [256]sync.Mutex
+	now   func() time.Time
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// New creates a FileStore in dir, created if needed, sweeping the expired sessions every
+// DefaultCleanupInterval.
+func New(dir string) (*FileStore, error) {
+	return NewWithCleanup(dir, DefaultCleanupInterval)
+}
+
+// NewWithCleanup creates a FileStore in dir sweeping the expired sessions every interval.
+// The sweeper is not started when interval is not greater than 0.
+// The sweep also removes the unreadable files, and the temporary files older than interval
+// left by a crash during a write.
+func NewWithCleanup(dir string, interval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, interval: interval, now: time.Now, stop: make(chan struct{})}
+	if interval > 0 {
+		go s.sweep(interval)
+	}
+	return s, nil
+}
+
+// Close stops the sweeper. The store remains usable.
+func (s *FileStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *FileStore) sweep(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.deleteExpired(); err != nil {
+				log.Warn().Err(err).Str("dir", s.dir).Msg("filestore: sweep expired sessions")
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *FileStore) deleteExpired() error {
+	if err := s.deleteStaleTemp(); err != nil {
+		return err
+	}
+	if err := s.deleteExpiredUserSessions(); err != nil {
+		return err
+	}
+	return s.walk(true, func(path string, expiry time.Time, _, _ []byte) {
+		if s.now().Before(expiry) {
+			return
+		}
+		mu := s.lock(filepath.Base(path))
+		mu.Lock()
+		defer mu.Unlock()
+		// the session may have been committed again since it was read
+		if expiry, _, _, err := read(path); err == nil && !s.now().Before(expiry) {
+			_ = os.Remove(path)
+		}
+	})
+}
+
+// deleteStaleTemp removes the temporary files which have not been renamed within the sweep
+// interval, left by a crash during writeFile.
+func (s *FileStore) deleteStaleTemp() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	maxAge := s.interval
+	if maxAge <= 0 {
+		maxAge = DefaultCleanupInterval
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), tmpExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || s.now().Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err = os.Remove(filepath.Join(s.dir, e.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Str("file", e.Name()).Msg("filestore: remove stale temporary file")
+		}
+	}
+	return nil
+}
+
+// removeCorrupt removes the file at path if it is still corrupt once locked, so that a file
+// truncated by a crash does not make every request of its session fail.
+func (s *FileStore) removeCorrupt(path string, readFile func(path string) error, err error) {
+	log.Warn().Err(err).Str("file", path).Msg("filestore: skip unreadable file")
+	if !errors.Is(err, errCorrupt) {
+		return
+	}
+	mu := s.lock(filepath.Base(path))
+	mu.Lock()
+	defer mu.Unlock()
+	if errors.Is(readFile(path), errCorrupt) {
+		_ = os.Remove(path)
+	}
+}
+
+// path returns the path of the file of token.
+func (s *FileStore) path(token []byte) string {
+	sum := sha256.Sum256(token)
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// lock returns the lock of the file named name.
+func (s *FileStore) lock(name string) *sync.Mutex {
+	var b [1]byte
+	_, _ = hex.Decode(b[:], []byte(name[:2]))
+	return &s.locks[b[0]]
+}
+
+// errCorrupt is wrapped by the errors of the files which are truncated or not written by the store.
+var errCorrupt = errors.New("filestore: corrupt file")
+
+// read returns the expiry, the token and the data of the file at path.
+func read(path string) (expiry time.Time, token, b []byte, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if len(content) < headerLen {
+		err = fmt.Errorf("%w %s", errCorrupt, path)
+		return
+	}
+	expiry = time.Unix(0, int64(binary.BigEndian.Uint64(content)))
+	n := int(binary.BigEndian.Uint16(content[8:]))
+	if len(content) < headerLen+n {
+		err = fmt.Errorf("%w %s", errCorrupt, path)
+		return
+	}
+	token = content[headerLen : headerLen+n]
+	b = content[headerLen+n:]
+	return
+}
+
+// write replaces the file at path atomically.
+func (s *FileStore) write(path string, token []byte, b []byte, expiry time.Time) (err error) {
+	content := make([]byte, headerLen, headerLen+len(token)+len(b))
+	binary.BigEndian.PutUint64(content, uint64(expiry.UnixNano()))
+	binary.BigEndian.PutUint16(content[8:], uint16(len(token)))
+	content = append(append(content, token...), b...)
+	return s.writeFile(path, content)
+}
+
+// writeFile replaces the file at path, in dir or a subdirectory of dir, with content atomically.
+func (s *FileStore) writeFile(path string, content []byte) (err error) {
+	f, err := os.CreateTemp(s.dir, "*"+tmpExt)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(content); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s *FileStore) Find(token []byte) (b []byte, found bool, err error) {
+	expiry, _, b, err := read(s.path(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !s.now().Before(expiry) {
+		return nil, false, nil
+	}
+	return b, true, nil
+}
+
+// Commit writes the session. When the session is not modified and exists, the stored data is
+// kept and only its expiry is updated.
+func (s *FileStore) Commit(token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	if len(token) > 1<<16-1 {
+		return errors.New("filestore: token too long")
+	}
+	path := s.path(token)
+	mu := s.lock(filepath.Base(path))
+	mu.Lock()
+	defer mu.Unlock()
+	if !modified {
+		if oldExpiry, _, old, err := read(path); err == nil && s.now().Before(oldExpiry) {
+			b = old
+		}
+	}
+	return s.write(path, token, b, expiry)
+}
+
+func (s *FileStore) Delete(token []byte) (err error) {
+	path := s.path(token)
+	mu := s.lock(filepath.Base(path))
+	mu.Lock()
+	defer mu.Unlock()
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return
+}
+
+// walk calls fn with the sessions of the directory, expired or not. The unreadable files are
+// logged and skipped, and the corrupt ones are removed if remove is set.
+func (s *FileStore) walk(remove bool, fn func(path string, expiry time.Time, token, b []byte)) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ext) {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		expiry, token, b, err := read(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			// deleted since ReadDir
+			continue
+		}
+		if err != nil {
+			if remove {
+				s.removeCorrupt(path, func(path string) error {
+					_, _, _, err := read(path)
+					return err
+				}, err)
+			} else {
+				log.Warn().Err(err).Str("file", path).Msg("filestore: skip unreadable file")
+			}
+			continue
+		}
+		fn(path, expiry, token, b)
+	}
+	return nil
+}
+
+// All returns the active sessions, keyed by the tokens given to Commit.
+func (s *FileStore) All() (map[string][]byte, error) {
+	now := s.now()
+	all := make(map[string][]byte)
+	err := s.walk(false, func(_ string, expiry time.Time, token, b []byte) {
+		if now.Before(expiry) {
+			all[string(token)] = b
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+func (s *FileStore) FindCtx(ctx context.Context, token []byte) (b []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Find(token)
+}
+
+func (s *FileStore) CommitCtx(ctx context.Context, token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Commit(token, b, expiry, modified)
+}
+
+func (s *FileStore) DeleteCtx(ctx context.Context, token []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Delete(token)
+}
+
+func (s *FileStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.All()
+}
+
+// userEntry is a session in the index of a user.
+type userEntry struct {
+	expiry time.Time
+	info   []byte
+}
+
+// userPath returns the path of the index file of userID.
+func (s *FileStore) userPath(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return filepath.Join(s.dir, usersDir, hex.EncodeToString(sum[:])+userExt)
+}
+
+// readUser returns the sessions of the index file at path, keyed by token. A missing file is an
+// empty index.
+func readUser(path string) (map[string]userEntry, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]userEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]userEntry)
+	for len(content) > 0 {
+		if len(content) < userEntryHeaderLen {
+			return nil, fmt.Errorf("%w %s", errCorrupt, path)
+		}
+		expiry := time.Unix(0, int64(binary.BigEndian.Uint64(content)))
+		n := int(binary.BigEndian.Uint16(content[8:]))
+		m := int(binary.BigEndian.Uint32(content[10:]))
+		content = content[userEntryHeaderLen:]
+		if len(content) < n+m {
+			return nil, fmt.Errorf("%w %s", errCorrupt, path)
+		}
+		entries[string(content[:n])] = userEntry{expiry: expiry, info: content[n : n+m]}
+		content = content[n+m:]
+	}
+	return entries, nil
+}
+
+// writeUser replaces the index file at path with the active sessions of entries, or removes it
+// when there are none.
+func (s *FileStore) writeUser(path string, entries map[string]userEntry) error {
+	now := s.now()
+	var content []byte
+	for token, e := range entries {
+		if !now.Before(e.expiry) {
+			continue
+		}
+		var header [userEntryHeaderLen]byte
+		binary.BigEndian.PutUint64(header[:], uint64(e.expiry.UnixNano()))
+		binary.BigEndian.PutUint16(header[8:], uint16(len(token)))
+		binary.BigEndian.PutUint32(header[10:], uint32(len(e.info)))
+		content = append(append(append(content, header[:]...), token...), e.info...)
+	}
+	if len(content) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return s.writeFile(path, content)
+}
+
+func (s *FileStore) deleteExpiredUserSessions() error {
+	entries, err := os.ReadDir(filepath.Join(s.dir, usersDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), userExt) {
+			continue
+		}
+		path := filepath.Join(s.dir, usersDir, e.Name())
+		sessions, err := readUser(path)
+		if err != nil {
+			s.removeCorrupt(path, func(path string) error {
+				_, err := readUser(path)
+				return err
+			}, err)
+			continue
+		}
+		now := s.now()
+		for _, session := range sessions {
+			if !now.Before(session.expiry) {
+				// rewritten without the expired sessions
+				if err = s.updateUser(path, func(map[string]userEntry) {}); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// updateUser applies fn to the index file at path, dropping the expired sessions.
+func (s *FileStore) updateUser(path string, fn func(entries map[string]userEntry)) error {
+	mu := s.lock(filepath.Base(path))
+	mu.Lock()
+	defer mu.Unlock()
+	entries, err := readUser(path)
+	if err != nil {
+		return err
+	}
+	fn(entries)
+	return s.writeUser(path, entries)
+}
+
+func (s *FileStore) CommitUserSession(ctx context.Context, userID string, token []byte, info []byte, expiry time.Time) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(token) > 1<<16-1 {
+		return errors.New("filestore: token too long")
+	}
+	return s.updateUser(s.userPath(userID), func(entries map[string]userEntry) {
+		entries[string(token)] = userEntry{expiry: expiry, info: info}
+	})
+}
+
+func (s *FileStore) DeleteUserSession(ctx context.Context, userID string, token []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.updateUser(s.userPath(userID), func(entries map[string]userEntry) {
+		delete(entries, string(token))
+	})
+}
+
+func (s *FileStore) UserSessions(ctx context.Context, userID string) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := readUser(s.userPath(userID))
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	all := make(map[string][]byte, len(entries))
+	for token, e := range entries {
+		if now.Before(e.expiry) {
+			all[token] = e.info
+		}
+	}
+	return all, nil
+}
+
+// version returns the version of the data b of a session, its SHA-256, so that files written
+// before a restart keep their version.
+func version(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+func (s *FileStore) FindVersion(ctx context.Context, token []byte) (b []byte, v string, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	b, found, err = s.Find(token)
+	if found {
+		v = version(b)
+	}
+	return
+}
+
+// CommitVersion writes the session if the version of the stored data is still v.
+func (s *FileStore) CommitVersion(ctx context.Context, token []byte, b []byte, expiry time.Time, v string) (committed bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(token) > 1<<16-1 {
+		return false, errors.New("filestore: token too long")
+	}
+	path := s.path(token)
+	mu := s.lock(filepath.Base(path))
+	mu.Lock()
+	defer mu.Unlock()
+	current := ""
+	oldExpiry, _, old, err := read(path)
+	if err == nil && s.now().Before(oldExpiry) {
+		current = version(old)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if current != v {
+		return false, nil
+	}
+	if err = s.write(path, token, b, expiry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package filestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fasthttp-routing/middleware/session/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		s, err := NewWithCleanup(t.TempDir(), 0)
+		assert.Nil(t, err)
+		return s
+	})
+}
+
+func TestFileStoreSweep(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewWithCleanup(dir, 0)
+	assert.Nil(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	assert.Nil(t, s.Commit([]byte("scs:session:a"), []byte("a"), now.Add(time.Minute), true))
+	assert.Nil(t, s.Commit([]byte("scs:session:b"), []byte("b"), now.Add(time.Hour), true))
+
+	// the sessions survive a restart
+	s, err = NewWithCleanup(dir, 0)
+	assert.Nil(t, err)
+	s.now = func() time.Time { return now.Add(30 * time.Minute) }
+	b, found, err := s.Find([]byte("scs:session:b"))
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "b", string(b))
+
+	assert.Nil(t, s.deleteExpired())
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+	all, err := s.All()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"scs:session:b": []byte("b")}, all)
+}
+
+func TestFileStoreSweepBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewWithCleanup(dir, time.Minute)
+	assert.Nil(t, err)
+	s.Close()
+	assert.Nil(t, s.Commit([]byte("scs:session:a"), []byte("a"), time.Now().Add(time.Hour), true))
+	assert.Nil(t, s.CommitUserSession(context.Background(), "u1", []byte("scs:session:a"), nil, time.Now().Add(time.Hour)))
+	truncated := s.path([]byte("scs:session:b"))
+	assert.Nil(t, os.WriteFile(truncated, []byte("short"), 0o600))
+	corruptUser := s.userPath("u2")
+	assert.Nil(t, os.WriteFile(corruptUser, []byte("short"), 0o600))
+	stale := filepath.Join(dir, "1"+tmpExt)
+	assert.Nil(t, os.WriteFile(stale, nil, 0o600))
+	assert.Nil(t, os.Chtimes(stale, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	fresh := filepath.Join(dir, "2"+tmpExt)
+	assert.Nil(t, os.WriteFile(fresh, nil, 0o600))
+
+	// the bad files are skipped
+	all, err := s.All()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]byte{"scs:session:a": []byte("a")}, all)
+
+	// and removed by the sweep, with the temporary files left by a crash
+	assert.Nil(t, s.deleteExpired())
+	for _, path := range []string{truncated, corruptUser, stale} {
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	_, err = os.Stat(fresh)
+	assert.Nil(t, err)
+	_, found, err := s.Find([]byte("scs:session:a"))
+	assert.Nil(t, err)
+	assert.True(t, found)
+	sessions, err := s.UserSessions(context.Background(), "u1")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+}
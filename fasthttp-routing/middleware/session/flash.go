@@ -0,0 +1,47 @@
+package session
+
+import (
+	routing "fasthttp-routing"
+)
+
+// flashKey 下一个请求显示的闪存消息
+const flashKey = "__flash"
+
+// FlashMessage is a message set by a request for the next request of the session, see Data.Flash.
+type FlashMessage struct {
+	// Kind is the kind of the message chosen by the application, e.g. "success" or "error".
+	Kind    string `json:"k"`
+	Message string `json:"m"`
+}
+
+// Flash adds a message for the next request of the session, typically before redirecting after a
+// POST, which gets it with Flashes. The message is removed from the session by the next request,
+// whether or not it gets it. The session data status will be set to Modified.
+func (d *Data) Flash(kind, message string) {
+	flashes, _ := Get[[]FlashMessage](d, flashKey)
+	d.Put(flashKey, append(flashes[:len(flashes):len(flashes)], FlashMessage{Kind: kind, Message: message}))
+}
+
+// Flashes returns the messages added with Flash by the previous request of the session, in the
+// order they were added.
+func (d *Data) Flashes() []FlashMessage {
+	return d.flashes
+}
+
+// takeFlashes removes the messages of the previous request from the session data once loaded.
+func (d *Data) takeFlashes() {
+	d.flashes, _ = Pop[[]FlashMessage](d, flashKey)
+}
+
+// Flash adds a message for the next request of the session, see Data.Flash.
+func (s *Manager) Flash(c *routing.Ctx, kind, message string) {
+	sd := s.sessionDataFromCxt(c)
+	sd.Flash(kind, message)
+}
+
+// Flashes returns the messages added with Flash by the previous request of the session, see
+// Data.Flashes.
+func (s *Manager) Flashes(c *routing.Ctx) []FlashMessage {
+	sd := s.sessionDataFromCxt(c)
+	return sd.Flashes()
+}
@@ -1,33 +1,86 @@
 package session
 
 import (
+	"reflect"
+	"time"
+
 	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog/log"
 	"helpers/unsafefn"
 )
 
+// JSONCodec encodes the session data as JSON. The values of the types registered with
+// RegisterType are decoded as their type, the others as the generic JSON types: float64,
+// string, bool, []interface{} and map[string]interface{}. The integers are decoded from a
+// float64, so that their precision is limited to 53 bits.
 type JSONCodec struct{}
 type Aux struct {
 	V  map[string]interface{}
 	CR string
+	// DL 会话的绝对过期时间（Unix 毫秒），旧版本编码的数据中没有此字段
+	DL int64 `json:",omitempty"`
+	// T 类型已注册的值的键及其类型名，旧版本编码的数据中没有此字段，其值按通用的 JSON 类型解码
+	T map[string]string `json:",omitempty"`
 }
 
-func (J JSONCodec) Encode(csrfToken []byte, values map[string]interface{}) (encodedData []byte, err error) {
-	// TODO implement me
-	encodedData, err = sonic.Marshal(&Aux{
+func (J JSONCodec) Encode(deadline time.Time, csrfToken []byte, values map[string]interface{}) (encodedData []byte, err error) {
+	aux := &Aux{
 		V:  values,
 		CR: unsafefn.BtoS(csrfToken),
-	})
+	}
+	if !deadline.IsZero() {
+		aux.DL = deadline.UnixMilli()
+	}
+	for key, v := range values {
+		if name, ok := typeName(v); ok {
+			if aux.T == nil {
+				aux.T = make(map[string]string)
+			}
+			aux.T[key] = name
+		}
+	}
+	encodedData, err = sonic.Marshal(aux)
 	return
 }
 
 func (J JSONCodec) Decode(bytes []byte,
-	dstCsrfToken []byte) (csrfToken []byte, values map[string]interface{}, err error) {
+	dstCsrfToken []byte) (deadline time.Time, csrfToken []byte, values map[string]interface{}, err error) {
 	aux := Aux{}
 	err = sonic.Unmarshal(bytes, &aux)
 	if err != nil {
 		return
 	}
+	if aux.DL != 0 {
+		deadline = time.UnixMilli(aux.DL)
+	}
 	values = aux.V
+	for key, name := range aux.T {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+		t, ok := registeredType(name)
+		if !ok {
+			// registered by another instance only, Get converts it when it is requested
+			continue
+		}
+		p := reflect.New(t)
+		if err := J.ConvertValue(v, p.Interface()); err != nil {
+			log.Warn().Str("Err", err.Error()).Str("key", key).Str("type", name).Msg("decode session value occur error")
+			continue
+		}
+		values[key] = p.Elem().Interface()
+	}
 	csrfToken = append(dstCsrfToken, aux.CR...)
 	return
 }
+
+// ConvertValue converts v, as decoded by Decode, to the value pointed to by dst, as if v had been
+// decoded into dst from JSON.
+func (J JSONCodec) ConvertValue(v interface{}, dst interface{}) error {
+	b, err := sonic.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return sonic.Unmarshal(b, dst)
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"context"
+	"strings"
 	"time"
 	"unsafe"
 
@@ -37,14 +38,23 @@ func (s *Manager) doStoreFind(ctx context.Context, _ *routing.Ctx, token []byte)
 //
 // Most applications will use the LoadAndSave() middleware and will not need to
 // use this method.
-func (s *Manager) Commit(ctx context.Context, _ *routing.Ctx, data *Data) (err error) {
-	var serializedData []byte
-	serializedData, err = s.Codec.Encode(data.csrfToken, data.values)
+func (s *Manager) Commit(ctx context.Context, c *routing.Ctx, data *Data) (err error) {
+	if vs, ok := s.versionedStore(); ok && data.status == Modified {
+		err = s.commitVersion(ctx, vs, data)
+	} else {
+		var serializedData []byte
+		serializedData, err = s.Codec.Encode(data.deadline, data.csrfToken, data.values)
+		if err != nil {
+			err = NewEncodingError(err.Error())
+			return
+		}
+		// an unmodified session is not rewritten by the stores, only its expiry is extended
+		err = s.doStoreCommit(ctx, data.token, serializedData, data.expiry(), data.status == Modified)
+	}
 	if err != nil {
-		err = NewEncodingError(err.Error())
 		return
 	}
-	err = s.doStoreCommit(ctx, data.token, serializedData, time.Now().Add(s.Lifetime), data.status == Modified)
+	err = s.commitUserIndex(ctx, c, data)
 	return
 }
 func (s *Manager) sessionDataFromCxt(c *routing.Ctx) (data *Data) {
@@ -78,14 +88,27 @@ func (s *Manager) doStoreCommit(ctx context.Context, token []byte, data []byte,
 	return
 }
 
+// inCookies reports whether the sessions are kept in the cookies by the store, see CookieStore.
+func (s *Manager) inCookies() bool {
+	_, ok := storeAs[cookieSessions](s.Store)
+	return ok
+}
+
 // Destroy deletes the session data from the session store and sets the session
 // status to Destroyed. Any further operations in the same request cycle will
 // result in a new session being created.
 func (s *Manager) Destroy(ctx context.Context, c *routing.Ctx) error {
 	sd := s.sessionDataFromCxt(c)
-	err := s.doStoreDelete(ctx, sd.token)
-	if err != nil {
-		return err
+	// nothing is stored for a CookieStore, the middleware removes the cookies of a destroyed session
+	if !s.inCookies() {
+		if err := s.doStoreDelete(ctx, sd.token); err != nil {
+			return err
+		}
+	}
+	if sd.userID != "" {
+		if err := s.doUserIndexDelete(ctx, sd.userID, storeKey(sd.token)); err != nil {
+			return err
+		}
 	}
 	sd.status = Destroyed
 	sd.reset()
@@ -110,7 +133,8 @@ func (s *Manager) Put(c *routing.Ctx, key string, val interface{}) {
 //	}
 //
 // Also see the GetString(), GetInt(), GetBytes() and other helper methods which
-// wrap the type conversion for common types.
+// wrap the type conversion for common types, and the generic Get function which
+// converts the values decoded by codecs such as JSONCodec.
 func (s *Manager) Get(c *routing.Ctx, key string) interface{} {
 	sd := s.sessionDataFromCxt(c)
 	return sd.Get(key)
@@ -329,9 +353,10 @@ func (s *Manager) Iterate(ctx context.Context, _ *routing.Ctx, fn func(ctx conte
 		s.dataPool.Release(data)
 	}()
 	for token, b := range allSessions {
-		data.token = append(data.token, token...)
+		// the stores may or may not strip the key prefix from the tokens
+		data.token = append(data.token, strings.TrimPrefix(token, sessionPrefix)...)
 		data.manager = s
-		data.csrfToken, data.values, err = s.Codec.Decode(b, data.csrfToken[0:0])
+		data.deadline, data.csrfToken, data.values, err = s.Codec.Decode(b, data.csrfToken[0:0])
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,272 @@
+package session
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const memoryShardCount = 64
+
+// DefaultCleanupInterval is the interval of the sweeping of the expired sessions of NewMemoryStore.
+const DefaultCleanupInterval = time.Minute
+
+// MemoryStore keeps the sessions in the memory of the process, in shards locked separately.
+// Expired sessions are never returned, and are dropped by a background sweeper.
+// The sessions are lost when the process exits, use redisstore or filestore to keep them.
+type MemoryStore struct {
+	shards [memoryShardCount]memoryShard
+	// users 按用户索引的会话，用户 ID 到 token 到会话信息
+	usersMu sync.Mutex
+	users   map[string]map[string]memoryItem
+	// versions 为每次提交的新数据分配版本号
+	versions atomic.Uint64
+	now      func() time.Time
+	stop     chan struct{}
+	once     sync.Once
+}
+
+type memoryShard struct {
+	mu    sync.RWMutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	b       []byte
+	expiry  time.Time
+	version uint64
+}
+
+// NewMemoryStore creates a MemoryStore sweeping the expired sessions every DefaultCleanupInterval.
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithCleanup(DefaultCleanupInterval)
+}
+
+// NewMemoryStoreWithCleanup creates a MemoryStore sweeping the expired sessions every interval.
+// The sweeper is not started when interval is not greater than 0.
+func NewMemoryStoreWithCleanup(interval time.Duration) *MemoryStore {
+	s := &MemoryStore{users: make(map[string]map[string]memoryItem), now: time.Now, stop: make(chan struct{})}
+	for i := range s.shards {
+		s.shards[i].items = make(map[string]memoryItem)
+	}
+	if interval > 0 {
+		go s.sweep(interval)
+	}
+	return s
+}
+
+// Close stops the sweeper. The store remains usable.
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *MemoryStore) sweep(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.deleteExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) deleteExpired() {
+	now := s.now()
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for k, item := range shard.items {
+			if !now.Before(item.expiry) {
+				delete(shard.items, k)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	s.usersMu.Lock()
+	for userID, sessions := range s.users {
+		for k, item := range sessions {
+			if !now.Before(item.expiry) {
+				delete(sessions, k)
+			}
+		}
+		if len(sessions) == 0 {
+			delete(s.users, userID)
+		}
+	}
+	s.usersMu.Unlock()
+}
+
+func (s *MemoryStore) shard(token []byte) *memoryShard {
+	h := uint32(2166136261)
+	for _, c := range token {
+		h ^= uint32(c)
+		h *= 16777619
+	}
+	return &s.shards[h%memoryShardCount]
+}
+
+// Find returns the data of token. The returned slice must not be modified.
+func (s *MemoryStore) Find(token []byte) (b []byte, found bool, err error) {
+	shard := s.shard(token)
+	shard.mu.RLock()
+	item, ok := shard.items[string(token)]
+	shard.mu.RUnlock()
+	if !ok || !s.now().Before(item.expiry) {
+		return nil, false, nil
+	}
+	return item.b, true, nil
+}
+
+// Commit stores a copy of b. When the session is not modified and exists, only its expiry is updated.
+func (s *MemoryStore) Commit(token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	shard := s.shard(token)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if !modified {
+		if item, ok := shard.items[string(token)]; ok && s.now().Before(item.expiry) {
+			item.expiry = expiry
+			shard.items[string(token)] = item
+			return nil
+		}
+	}
+	shard.items[string(token)] = memoryItem{b: append([]byte(nil), b...), expiry: expiry, version: s.versions.Add(1)}
+	return nil
+}
+
+// FindVersion returns the data of token and its version. The returned slice must not be modified.
+func (s *MemoryStore) FindVersion(ctx context.Context, token []byte) (b []byte, version string, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	shard := s.shard(token)
+	shard.mu.RLock()
+	item, ok := shard.items[string(token)]
+	shard.mu.RUnlock()
+	if !ok || !s.now().Before(item.expiry) {
+		return nil, "", false, nil
+	}
+	return item.b, strconv.FormatUint(item.version, 10), true, nil
+}
+
+// CommitVersion stores a copy of b if the version of the data of token is still version.
+func (s *MemoryStore) CommitVersion(ctx context.Context, token []byte, b []byte, expiry time.Time, version string) (committed bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	shard := s.shard(token)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	current := ""
+	if item, ok := shard.items[string(token)]; ok && s.now().Before(item.expiry) {
+		current = strconv.FormatUint(item.version, 10)
+	}
+	if current != version {
+		return false, nil
+	}
+	shard.items[string(token)] = memoryItem{b: append([]byte(nil), b...), expiry: expiry, version: s.versions.Add(1)}
+	return true, nil
+}
+
+func (s *MemoryStore) Delete(token []byte) (err error) {
+	shard := s.shard(token)
+	shard.mu.Lock()
+	delete(shard.items, string(token))
+	shard.mu.Unlock()
+	return nil
+}
+
+// All returns the active sessions, keyed by the tokens given to Commit.
+func (s *MemoryStore) All() (map[string][]byte, error) {
+	now := s.now()
+	all := make(map[string][]byte)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		for k, item := range shard.items {
+			if now.Before(item.expiry) {
+				all[k] = item.b
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return all, nil
+}
+
+func (s *MemoryStore) FindCtx(ctx context.Context, token []byte) (b []byte, found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Find(token)
+}
+
+func (s *MemoryStore) CommitCtx(ctx context.Context, token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Commit(token, b, expiry, modified)
+}
+
+func (s *MemoryStore) DeleteCtx(ctx context.Context, token []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return s.Delete(token)
+}
+
+func (s *MemoryStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.All()
+}
+
+func (s *MemoryStore) CommitUserSession(ctx context.Context, userID string, token []byte, info []byte, expiry time.Time) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	sessions, ok := s.users[userID]
+	if !ok {
+		sessions = make(map[string]memoryItem)
+		s.users[userID] = sessions
+	}
+	sessions[string(token)] = memoryItem{b: append([]byte(nil), info...), expiry: expiry}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUserSession(ctx context.Context, userID string, token []byte) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	if sessions, ok := s.users[userID]; ok {
+		delete(sessions, string(token))
+		if len(sessions) == 0 {
+			delete(s.users, userID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) UserSessions(ctx context.Context, userID string) (map[string][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	all := make(map[string][]byte)
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	for k, item := range s.users[userID] {
+		if now.Before(item.expiry) {
+			all[k] = item.b
+		}
+	}
+	return all, nil
+}
@@ -0,0 +1,32 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"fasthttp-routing/middleware/session/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		s := NewMemoryStoreWithCleanup(0)
+		t.Cleanup(s.Close)
+		return s
+	})
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s := NewMemoryStoreWithCleanup(0)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	assert.Nil(t, s.Commit([]byte("a"), []byte("a"), now.Add(time.Minute), true))
+	assert.Nil(t, s.Commit([]byte("b"), []byte("b"), now.Add(time.Hour), true))
+	now = now.Add(30 * time.Minute)
+	s.deleteExpired()
+	n := 0
+	for i := range s.shards {
+		n += len(s.shards[i].items)
+	}
+	assert.Equal(t, 1, n)
+}
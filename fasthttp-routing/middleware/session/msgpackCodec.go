@@ -0,0 +1,609 @@
+package session
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"helpers/unsafefn"
+)
+
+const (
+	// msgpackMagic 编码数据的首字节，为 MessagePack 中未使用的 0xc1，不会是 JSON 或者 gob 编码数据的首字节
+	msgpackMagic = 0xc1
+	// msgpackVersion 编码格式的版本，紧随 msgpackMagic
+	msgpackVersion = 1
+	// msgpackExtTyped 不是 MessagePack 原生类型的值：类型名（未注册时为空），加上数值或者 JSON 编码的值
+	msgpackExtTyped = 1
+	// msgpackExtTimestamp MessagePack 规定的时间戳扩展类型
+	msgpackExtTimestamp = -1
+	// msgpackMaxDepth 嵌套的数组及映射的最大深度
+	msgpackMaxDepth = 64
+)
+
+// MsgpackCodec encodes the session data as MessagePack, preceded by a format version header. It
+// is more compact and faster than JSONCodec, and keeps the types of the values: int, float64,
+// float32, string, bool, []byte, time.Time, []interface{} and map[string]interface{} are encoded
+// natively. The values of the other types are encoded with their type name as an extension, the
+// numbers as such and the others as JSON, and decoded as their type when it is registered with
+// RegisterType, or as the generic types otherwise.
+//
+// Use MigrationCodec to switch a store written by another codec to MsgpackCodec.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Encode(deadline time.Time, csrfToken []byte, values map[string]interface{}) (b []byte, err error) {
+	b = make([]byte, 0, 64+len(csrfToken)+32*len(values))
+	b = append(b, msgpackMagic, msgpackVersion)
+	var dl int64
+	if !deadline.IsZero() {
+		dl = deadline.UnixMilli()
+	}
+	b = appendMsgpackInt(b, dl)
+	b = appendMsgpackStr(b, unsafefn.BtoS(csrfToken))
+	return appendMsgpackMap(b, values, 0)
+}
+
+func (MsgpackCodec) Decode(b []byte, dstCsrfToken []byte) (deadline time.Time, csrfToken []byte, values map[string]interface{}, err error) {
+	if len(b) < 2 || b[0] != msgpackMagic {
+		err = NewDataError("decode session data: not encoded by MsgpackCodec")
+		return
+	}
+	if b[1] != msgpackVersion {
+		err = NewDataError("decode session data: unsupported MsgpackCodec version " + strconv.Itoa(int(b[1])))
+		return
+	}
+	d := msgpackDecoder{b: b, pos: 2}
+	dl, err := d.value(0)
+	if err != nil {
+		return
+	}
+	ms, ok := dl.(int)
+	if !ok {
+		err = d.error("invalid deadline")
+		return
+	}
+	if ms != 0 {
+		deadline = time.UnixMilli(int64(ms))
+	}
+	raw, err := d.str()
+	if err != nil {
+		return
+	}
+	csrfToken = append(dstCsrfToken, raw...)
+	v, err := d.value(0)
+	if err != nil {
+		return
+	}
+	if values, ok = v.(map[string]interface{}); !ok && v != nil {
+		err = d.error("invalid values")
+		return
+	}
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	if d.pos != len(d.b) {
+		err = d.error("trailing data")
+	}
+	return
+}
+
+// ConvertValue converts v, as decoded by Decode, to the value pointed to by dst: the numbers are
+// converted to the other numeric types when they fit, the other values as if they had been
+// decoded into dst from JSON.
+func (MsgpackCodec) ConvertValue(v interface{}, dst interface{}) error {
+	rv := reflect.ValueOf(dst).Elem()
+	if src := reflect.ValueOf(v); isNumberKind(src.Kind()) && isNumberKind(rv.Kind()) {
+		return setNumber(rv, src)
+	}
+	return JSONCodec{}.ConvertValue(v, dst)
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64 && k != reflect.Uintptr
+}
+
+// setNumber sets dst to the number src, failing if it does not fit or is a fractional number
+// converted to an integer.
+func setNumber(dst, src reflect.Value) error {
+	fail := func() error {
+		return NewDataError("convert " + src.Type().String() + " to " + dst.Type().String() + ": out of range")
+	}
+	switch dst.Kind() {
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case src.CanInt():
+			dst.SetFloat(float64(src.Int()))
+		case src.CanUint():
+			dst.SetFloat(float64(src.Uint()))
+		default:
+			dst.SetFloat(src.Float())
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch {
+		case src.CanInt():
+			i = src.Int()
+		case src.CanUint():
+			if src.Uint() > math.MaxInt64 {
+				return fail()
+			}
+			i = int64(src.Uint())
+		default:
+			f := src.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return fail()
+			}
+			i = int64(f)
+		}
+		if dst.OverflowInt(i) {
+			return fail()
+		}
+		dst.SetInt(i)
+	default:
+		var u uint64
+		switch {
+		case src.CanInt():
+			if src.Int() < 0 {
+				return fail()
+			}
+			u = uint64(src.Int())
+		case src.CanUint():
+			u = src.Uint()
+		default:
+			f := src.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return fail()
+			}
+			u = uint64(f)
+		}
+		if dst.OverflowUint(u) {
+			return fail()
+		}
+		dst.SetUint(u)
+	}
+	return nil
+}
+
+func appendMsgpackValue(b []byte, v interface{}, depth int) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if x {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendMsgpackInt(b, int64(x)), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(x)), nil
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(x)), nil
+	case string:
+		return appendMsgpackStr(b, x), nil
+	case []byte:
+		return appendMsgpackBin(b, x), nil
+	case time.Time:
+		return appendMsgpackTime(b, x), nil
+	case map[string]interface{}:
+		return appendMsgpackMap(b, x, depth+1)
+	case []interface{}:
+		if depth >= msgpackMaxDepth {
+			return b, NewDataError("encode session data: max depth exceeded")
+		}
+		b = appendMsgpackLen(b, len(x), 0x90, 0xdc)
+		var err error
+		for _, e := range x {
+			if b, err = appendMsgpackValue(b, e, depth+1); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	return appendMsgpackTyped(b, v)
+}
+
+// appendMsgpackTyped appends the extension of a value which is not of a MessagePack type.
+func appendMsgpackTyped(b []byte, v interface{}) ([]byte, error) {
+	name, _ := typeName(v)
+	payload := appendMsgpackStr(nil, name)
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		payload = appendMsgpackInt(payload, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		payload = appendMsgpackUint(payload, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		payload = binary.BigEndian.AppendUint64(append(payload, 0xcb), math.Float64bits(rv.Float()))
+	case reflect.Bool:
+		payload, _ = appendMsgpackValue(payload, rv.Bool(), 0)
+	case reflect.String:
+		payload = appendMsgpackStr(payload, rv.String())
+	default:
+		j, err := sonic.Marshal(v)
+		if err != nil {
+			return b, NewDataError("encode session data: " + err.Error())
+		}
+		payload = appendMsgpackBin(payload, j)
+	}
+	return append(appendMsgpackExtHeader(b, len(payload), msgpackExtTyped), payload...), nil
+}
+
+func appendMsgpackMap(b []byte, m map[string]interface{}, depth int) ([]byte, error) {
+	if m == nil {
+		return append(b, 0xc0), nil
+	}
+	if depth >= msgpackMaxDepth {
+		return b, NewDataError("encode session data: max depth exceeded")
+	}
+	b = appendMsgpackLen(b, len(m), 0x80, 0xde)
+	var err error
+	for k, v := range m {
+		b = appendMsgpackStr(b, k)
+		if b, err = appendMsgpackValue(b, v, depth); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// appendMsgpackLen appends the header of an array or a map, fix being the fixarray or fixmap
+// format and code16 the 16 bits format, followed by the 32 bits format.
+func appendMsgpackLen(b []byte, n int, fix, code16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code16+1), uint32(n))
+	}
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgpackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackUint(b []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), u)
+	}
+}
+
+func appendMsgpackStr(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBin(b []byte, p []byte) []byte {
+	switch n := len(p); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, p...)
+}
+
+func appendMsgpackExtHeader(b []byte, n int, typ int8) []byte {
+	switch {
+	case n == 1:
+		b = append(b, 0xd4)
+	case n == 2:
+		b = append(b, 0xd5)
+	case n == 4:
+		b = append(b, 0xd6)
+	case n == 8:
+		b = append(b, 0xd7)
+	case n == 16:
+		b = append(b, 0xd8)
+	case n <= math.MaxUint8:
+		b = append(b, 0xc7, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc8), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc9), uint32(n))
+	}
+	return append(b, byte(typ))
+}
+
+// appendMsgpackTime appends t with the timestamp extension, in its smallest format.
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), t.Nanosecond()
+	switch {
+	case sec>>34 != 0:
+		b = appendMsgpackExtHeader(b, 12, msgpackExtTimestamp)
+		b = binary.BigEndian.AppendUint32(b, uint32(nsec))
+		return binary.BigEndian.AppendUint64(b, uint64(sec))
+	case nsec == 0 && sec <= math.MaxUint32:
+		b = appendMsgpackExtHeader(b, 4, msgpackExtTimestamp)
+		return binary.BigEndian.AppendUint32(b, uint32(sec))
+	default:
+		b = appendMsgpackExtHeader(b, 8, msgpackExtTimestamp)
+		return binary.BigEndian.AppendUint64(b, uint64(nsec)<<34|uint64(sec))
+	}
+}
+
+type msgpackDecoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *msgpackDecoder) error(msg string) error {
+	return NewDataError("decode session data: " + msg + " at offset " + strconv.Itoa(d.pos))
+}
+
+// next returns the next n bytes.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.b)-d.pos {
+		return nil, d.error("unexpected end of data")
+	}
+	p := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (d *msgpackDecoder) uint(n int) (u uint64, err error) {
+	p, err := d.next(n)
+	for _, c := range p {
+		u = u<<8 | uint64(c)
+	}
+	return
+}
+
+// length reads a length of n bytes, of a value taking at least min bytes per element.
+func (d *msgpackDecoder) length(n int, min int) (int, error) {
+	u, err := d.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.b)-d.pos)/uint64(min) {
+		return 0, d.error("unexpected end of data")
+	}
+	return int(u), nil
+}
+
+// str reads a string or nil, and returns its bytes.
+func (d *msgpackDecoder) str() ([]byte, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch c := p[0]; {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9, c == 0xda, c == 0xdb:
+		if n, err = d.length(1<<(c-0xd9), 1); err != nil {
+			return nil, err
+		}
+	case c == 0xc0:
+		return nil, nil
+	default:
+		d.pos--
+		return nil, d.error("want a string")
+	}
+	return d.next(n)
+}
+
+func (d *msgpackDecoder) value(depth int) (v interface{}, err error) {
+	if depth > msgpackMaxDepth {
+		return nil, d.error("max depth exceeded")
+	}
+	p, err := d.next(1)
+	if err != nil {
+		return
+	}
+	var u uint64
+	switch c := p[0]; {
+	case c <= 0x7f:
+		return int(c), nil
+	case c >= 0xe0:
+		return int(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.mapValue(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.array(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0, c == 0xd9, c == 0xda, c == 0xdb:
+		d.pos--
+		var s []byte
+		s, err = d.str()
+		return string(s), err
+	case c == 0xc0:
+		return nil, nil
+	case c == 0xc2:
+		return false, nil
+	case c == 0xc3:
+		return true, nil
+	case c >= 0xc4 && c <= 0xc6:
+		var n int
+		if n, err = d.length(1<<(c-0xc4), 1); err != nil {
+			return
+		}
+		if p, err = d.next(n); err != nil {
+			return
+		}
+		return append([]byte(nil), p...), nil
+	case c >= 0xc7 && c <= 0xc9:
+		var n int
+		if n, err = d.length(1<<(c-0xc7), 1); err != nil {
+			return
+		}
+		return d.ext(n)
+	case c == 0xca:
+		u, err = d.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case c == 0xcb:
+		u, err = d.uint(8)
+		return math.Float64frombits(u), err
+	case c >= 0xcc && c <= 0xcf:
+		if u, err = d.uint(1 << (c - 0xcc)); err != nil {
+			return
+		}
+		if u > math.MaxInt {
+			return u, nil
+		}
+		return int(u), nil
+	case c >= 0xd0 && c <= 0xd3:
+		n := 1 << (c - 0xd0)
+		if u, err = d.uint(n); err != nil {
+			return
+		}
+		// sign extension
+		i := int64(u<<(64-8*n)) >> (64 - 8*n)
+		if i < math.MinInt || i > math.MaxInt {
+			return i, nil
+		}
+		return int(i), nil
+	case c >= 0xd4 && c <= 0xd8:
+		return d.ext(1 << (c - 0xd4))
+	case c == 0xdc, c == 0xdd:
+		var n int
+		if n, err = d.length(2<<(c-0xdc), 1); err != nil {
+			return
+		}
+		return d.array(n, depth)
+	case c == 0xde, c == 0xdf:
+		var n int
+		if n, err = d.length(2<<(c-0xde), 2); err != nil {
+			return
+		}
+		return d.mapValue(n, depth)
+	}
+	d.pos--
+	return nil, d.error("invalid format 0x" + strconv.FormatUint(uint64(p[0]), 16))
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (v interface{}, err error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		if a[i], err = d.value(depth + 1); err != nil {
+			return
+		}
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) mapValue(n int, depth int) (v interface{}, err error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		var k []byte
+		if k, err = d.str(); err != nil {
+			return
+		}
+		if m[string(k)], err = d.value(depth + 1); err != nil {
+			return
+		}
+	}
+	return m, nil
+}
+
+// ext reads an extension of n bytes, after its type.
+func (d *msgpackDecoder) ext(n int) (v interface{}, err error) {
+	p, err := d.next(1)
+	if err != nil {
+		return
+	}
+	typ := int8(p[0])
+	if p, err = d.next(n); err != nil {
+		return
+	}
+	switch typ {
+	case msgpackExtTimestamp:
+		switch n {
+		case 4:
+			return time.Unix(int64(binary.BigEndian.Uint32(p)), 0), nil
+		case 8:
+			u := binary.BigEndian.Uint64(p)
+			return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+		case 12:
+			return time.Unix(int64(binary.BigEndian.Uint64(p[4:])), int64(binary.BigEndian.Uint32(p))), nil
+		}
+		return nil, d.error("invalid timestamp")
+	case msgpackExtTyped:
+		return d.typed(p)
+	}
+	return nil, d.error("unknown extension " + strconv.Itoa(int(typ)))
+}
+
+// typed decodes the payload of an extension written by appendMsgpackTyped.
+func (d *msgpackDecoder) typed(payload []byte) (v interface{}, err error) {
+	pd := msgpackDecoder{b: payload}
+	name, err := pd.str()
+	if err != nil {
+		return
+	}
+	if v, err = pd.value(msgpackMaxDepth); err != nil {
+		return
+	}
+	t, registered := registeredType(string(name))
+	j, isJSON := v.([]byte)
+	switch {
+	case isJSON && registered:
+		p := reflect.New(t)
+		if err = sonic.Unmarshal(j, p.Interface()); err != nil {
+			return nil, d.error("decode " + string(name) + ": " + err.Error())
+		}
+		return p.Elem().Interface(), nil
+	case isJSON:
+		v = nil
+		err = sonic.Unmarshal(j, &v)
+		return
+	case !registered:
+		return
+	}
+	rv := reflect.New(t).Elem()
+	src := reflect.ValueOf(v)
+	switch {
+	case !src.IsValid():
+		err = d.error("decode " + string(name) + " from nil")
+	case isNumberKind(src.Kind()) && isNumberKind(t.Kind()):
+		err = setNumber(rv, src)
+	case src.Kind() == t.Kind() && src.Type().ConvertibleTo(t):
+		rv.Set(src.Convert(t))
+	default:
+		err = d.error("decode " + string(name) + " from " + src.Type().String())
+	}
+	if err != nil {
+		return
+	}
+	return rv.Interface(), nil
+}
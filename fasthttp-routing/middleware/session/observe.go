@@ -0,0 +1,167 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	routing "fasthttp-routing"
+)
+
+var errNotIterable = errors.New("session: the observed store does not support iteration")
+
+// ObserveStore wraps store so that observe is called after every store operation with the
+// operation ("find", "commit", "delete", "all", "lock", "commit_user", "delete_user" or
+// "user_sessions"), its duration and its error, e.g. with metrics.StoreObserver to export the
+// latency of the store:
+//
+//	store = session.ObserveStore(store, metrics.StoreObserver(metrics.DefaultRegistry, "redis"))
+//
+// The wrapper implements CtxStore, IterableStore, IterableCtxStore, UserIndexStore,
+// VersionedStore and LockingStore, falling back to the methods without context when store does
+// not take a context. The methods of UserIndexStore return ErrUserIndexNotSupported when store
+// does not implement it, and the Manager uses VersionedStore and LockingStore only when store
+// implements them.
+func ObserveStore(store Store, observe func(op string, d time.Duration, err error)) Store {
+	return &observedStore{store: store, observe: observe}
+}
+
+type observedStore struct {
+	store   Store
+	observe func(op string, d time.Duration, err error)
+}
+
+// handleCookieSession lets the wrapped CookieStore handle the session, see storeAs.
+func (s *observedStore) handleCookieSession(c *routing.Ctx, cfg *Config) error {
+	return s.store.(cookieSessions).handleCookieSession(c, cfg)
+}
+
+func (s *observedStore) Find(token []byte) (b []byte, found bool, err error) {
+	start := time.Now()
+	b, found, err = s.store.Find(token)
+	s.observe("find", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) Commit(token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	start := time.Now()
+	err = s.store.Commit(token, b, expiry, modified)
+	s.observe("commit", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) Delete(token []byte) (err error) {
+	start := time.Now()
+	err = s.store.Delete(token)
+	s.observe("delete", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) FindCtx(ctx context.Context, token []byte) (b []byte, found bool, err error) {
+	cs, ok := s.store.(CtxStore)
+	if !ok {
+		return s.Find(token)
+	}
+	start := time.Now()
+	b, found, err = cs.FindCtx(ctx, token)
+	s.observe("find", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) CommitCtx(ctx context.Context, token []byte, b []byte, expiry time.Time, modified bool) (err error) {
+	cs, ok := s.store.(CtxStore)
+	if !ok {
+		return s.Commit(token, b, expiry, modified)
+	}
+	start := time.Now()
+	err = cs.CommitCtx(ctx, token, b, expiry, modified)
+	s.observe("commit", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) DeleteCtx(ctx context.Context, token []byte) (err error) {
+	cs, ok := s.store.(CtxStore)
+	if !ok {
+		return s.Delete(token)
+	}
+	start := time.Now()
+	err = cs.DeleteCtx(ctx, token)
+	s.observe("delete", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) All() (all map[string][]byte, err error) {
+	it, ok := s.store.(IterableStore)
+	if !ok {
+		return nil, errNotIterable
+	}
+	start := time.Now()
+	all, err = it.All()
+	s.observe("all", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) AllCtx(ctx context.Context) (all map[string][]byte, err error) {
+	it, ok := s.store.(IterableCtxStore)
+	if !ok {
+		return s.All()
+	}
+	start := time.Now()
+	all, err = it.AllCtx(ctx)
+	s.observe("all", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) CommitUserSession(ctx context.Context, userID string, token []byte, info []byte, expiry time.Time) (err error) {
+	us, ok := s.store.(UserIndexStore)
+	if !ok {
+		return ErrUserIndexNotSupported
+	}
+	start := time.Now()
+	err = us.CommitUserSession(ctx, userID, token, info, expiry)
+	s.observe("commit_user", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) DeleteUserSession(ctx context.Context, userID string, token []byte) (err error) {
+	us, ok := s.store.(UserIndexStore)
+	if !ok {
+		return ErrUserIndexNotSupported
+	}
+	start := time.Now()
+	err = us.DeleteUserSession(ctx, userID, token)
+	s.observe("delete_user", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) UserSessions(ctx context.Context, userID string) (all map[string][]byte, err error) {
+	us, ok := s.store.(UserIndexStore)
+	if !ok {
+		return nil, ErrUserIndexNotSupported
+	}
+	start := time.Now()
+	all, err = us.UserSessions(ctx, userID)
+	s.observe("user_sessions", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) FindVersion(ctx context.Context, token []byte) (b []byte, version string, found bool, err error) {
+	start := time.Now()
+	b, version, found, err = s.store.(VersionedStore).FindVersion(ctx, token)
+	s.observe("find", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) CommitVersion(ctx context.Context, token []byte, b []byte, expiry time.Time, version string) (committed bool, err error) {
+	start := time.Now()
+	committed, err = s.store.(VersionedStore).CommitVersion(ctx, token, b, expiry, version)
+	s.observe("commit", time.Since(start), err)
+	return
+}
+
+func (s *observedStore) Lock(ctx context.Context, token []byte, ttl time.Duration) (unlock func(), err error) {
+	start := time.Now()
+	unlock, err = s.store.(LockingStore).Lock(ctx, token, ttl)
+	s.observe("lock", time.Since(start), err)
+	return
+}
@@ -2,6 +2,11 @@ package redisstore
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
 	"time"
 	"unsafe"
 
@@ -9,6 +14,29 @@ import (
 	"helpers/unsafefn"
 )
 
+// commitVersionScript sets KEYS[1] to ARGV[2] until ARGV[3] (Unix ms) if the SHA-1 of its value is
+// still ARGV[1], "" for a missing key, and returns 1, or returns 0.
+var commitVersionScript = rueidis.NewLuaScript(`
+local current = redis.call('GET', KEYS[1])
+local version = ''
+if current then
+	version = redis.sha1hex(current)
+end
+if version ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PXAT', ARGV[3])
+return 1
+`)
+
+// unlockScript deletes the lock KEYS[1] if it is still held by ARGV[1].
+var unlockScript = rueidis.NewLuaScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
 type RedisStore struct {
 	cli    rueidis.Client
 	prefix string
@@ -155,6 +183,145 @@ func (r *RedisStore) AllCtx(ctx context.Context) (map[string][]byte, error) {
 	return nil, nil
 }
 
+// userKey returns the key of the set of the session tokens of userID. The hash tag keeps the keys
+// of a user in the same slot of a cluster.
+func userKey(userID string) string {
+	return "scs:user:{" + userID + "}"
+}
+
+// userSessionKey returns the key of the info of the session token of userID.
+func (r *RedisStore) userSessionKey(userID string, token string) string {
+	return userKey(userID) + ":" + strings.TrimPrefix(token, r.prefix)
+}
+
+func (r *RedisStore) CommitUserSession(ctx context.Context, userID string, tokenWithPrefix []byte, info []byte, expiry time.Time) (err error) {
+	key := userKey(userID)
+	for _, resp := range r.cli.DoMulti(ctx,
+		r.cli.B().Set().Key(r.userSessionKey(userID, string(tokenWithPrefix))).Value(unsafefn.BtoS(info)).Exat(expiry).Build(),
+		r.cli.B().Sadd().Key(key).Member(string(tokenWithPrefix)).Build(),
+		// the set lives as long as the last session of the user
+		r.cli.B().Expireat().Key(key).Timestamp(expiry.Unix()).Nx().Build(),
+		r.cli.B().Expireat().Key(key).Timestamp(expiry.Unix()).Gt().Build(),
+	) {
+		if err = resp.Error(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *RedisStore) DeleteUserSession(ctx context.Context, userID string, tokenWithPrefix []byte) (err error) {
+	for _, resp := range r.cli.DoMulti(ctx,
+		r.cli.B().Srem().Key(userKey(userID)).Member(string(tokenWithPrefix)).Build(),
+		r.cli.B().Del().Key(r.userSessionKey(userID, string(tokenWithPrefix))).Build(),
+	) {
+		if err = resp.Error(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r *RedisStore) UserSessions(ctx context.Context, userID string) (map[string][]byte, error) {
+	key := userKey(userID)
+	tokens, err := r.cli.Do(ctx, r.cli.B().Smembers().Key(key).Build()).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string][]byte, len(tokens))
+	if len(tokens) == 0 {
+		return all, nil
+	}
+	keys := make([]string, len(tokens))
+	for i := range tokens {
+		keys[i] = r.userSessionKey(userID, tokens[i])
+	}
+	infos, err := r.cli.Do(ctx, r.cli.B().Mget().Key(keys...).Build()).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	for i := range infos {
+		if infos[i] == "" {
+			expired = append(expired, tokens[i])
+			continue
+		}
+		all[tokens[i]] = unsafe.Slice(unsafe.StringData(infos[i]), len(infos[i]))
+	}
+	if len(expired) != 0 {
+		// the info of the expired sessions has expired with them
+		if err = r.cli.Do(ctx, r.cli.B().Srem().Key(key).Member(expired...).Build()).Error(); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// version returns the version of the data b of a session, as computed by commitVersionScript.
+func version(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *RedisStore) FindVersion(ctx context.Context, tokenWithPrefix []byte) (b []byte, v string, found bool, err error) {
+	resp := r.cli.Do(ctx, r.cli.B().Get().Key(unsafefn.BtoS(tokenWithPrefix)).Build())
+	if rueidis.IsRedisNil(resp.Error()) {
+		return nil, "", false, nil
+	}
+	if b, err = resp.AsBytes(); err != nil {
+		return nil, "", false, err
+	}
+	return b, version(b), true, nil
+}
+
+// CommitVersion sets the session with a Lua script, so that the version is compared and the data
+// set atomically.
+func (r *RedisStore) CommitVersion(ctx context.Context, tokenWithPrefix []byte, encodedData []byte, expiry time.Time, v string) (committed bool, err error) {
+	n, err := commitVersionScript.Exec(ctx, r.cli, []string{string(tokenWithPrefix)},
+		[]string{v, string(encodedData), strconv.FormatInt(expiry.UnixMilli(), 10)}).AsInt64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// lockKey returns the key of the lock of the session token.
+func (r *RedisStore) lockKey(token string) string {
+	return "scs:lock:" + strings.TrimPrefix(token, r.prefix)
+}
+
+// Lock acquires the lock of the session with SET NX, polling until ctx is done while it is held
+// by another request.
+func (r *RedisStore) Lock(ctx context.Context, tokenWithPrefix []byte, ttl time.Duration) (unlock func(), err error) {
+	key := r.lockKey(string(tokenWithPrefix))
+	var owner [16]byte
+	if _, err = rand.Read(owner[:]); err != nil {
+		return
+	}
+	value := hex.EncodeToString(owner[:])
+	wait := 5 * time.Millisecond
+	for {
+		err = r.cli.Do(ctx, r.cli.B().Set().Key(key).Value(value).Nx().Px(ttl).Build()).Error()
+		if err == nil {
+			return func() {
+				// the request may be past its deadline
+				_ = unlockScript.Exec(context.Background(), r.cli, []string{key}, []string{value}).Error()
+			}, nil
+		}
+		if !rueidis.IsRedisNil(err) {
+			return nil, err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		wait = min(2*wait, 100*time.Millisecond)
+	}
+}
+
 // func makeMillisecondTimestamp(t time.Time) int64 {
 // 	return t.UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
 // }
@@ -2,14 +2,13 @@ package session
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"sync"
 	"time"
 
 	routing "fasthttp-routing"
-	"fasthttp-routing/middleware/session/redisstore"
 	"github.com/newacorn/fasthttp"
-	"github.com/redis/rueidis"
 	"github.com/rs/zerolog/log"
 	"helpers/utilcrypt"
 )
@@ -18,12 +17,14 @@ type contextKey string
 
 var ContextKey contextKey = "session"
 
+// The token lengths include the tag of utilcrypt.HMACHash. Hashes with a shorter tag leave
+// more random bytes in the tokens, so that the lengths of the tokens do not depend on the hash.
 const CsrfTokenLen = 20
-const AppendHashCsrfTokenLen = CsrfTokenLen + 2
+const AppendHashCsrfTokenLen = CsrfTokenLen + utilcrypt.HMACTagLen
 const UrlEncodedCsrfTokenLen = (AppendHashCsrfTokenLen*8 + 5) / 6
 
 const TokenLen = 30
-const AppendHashTokenLen = TokenLen + 2
+const AppendHashTokenLen = TokenLen + utilcrypt.HMACTagLen
 const UrlEncodedTokenLen = (AppendHashTokenLen*8 + 5) / 6
 
 // UrlEncodedTokenWithPrefixLen comment
@@ -46,10 +47,33 @@ func (p *DataPool) Release(data *Data) {
 type Manager struct {
 	// Lifetime controls the maximum length of time that a session is valid for
 	// before it expires. The lifetime is an 'absolute expiry' which is set when
-	// the session is first created and **does not change**. The default value is 24
-	// hours.
+	// the session is first created and **does not change**, except when the
+	// session token is renewed. The default value is 7 days.
 	Lifetime time.Duration
 
+	// IdleTimeout controls the maximum length of time a session can be inactive
+	// before it expires. For example, some applications may wish to set this so
+	// there is a timeout after 20 minutes of inactivity. Each request using the
+	// session extends its expiry in the store and the Max-Age of its cookie,
+	// without rewriting unchanged data, but never past Lifetime. By default
+	// IdleTimeout is not set and there is no inactivity timeout.
+	IdleTimeout time.Duration
+
+	// Conflict controls how a session modified by concurrent requests is
+	// committed when the store implements VersionedStore. The default is
+	// ConflictOverwrite: the last commit wins.
+	Conflict ConflictPolicy
+
+	// MaxCommitRetries is the number of merges of ConflictMerge before a
+	// ConflictError is returned.
+	MaxCommitRetries int
+
+	// LockTimeout is the maximum time a request waits for the lock of its
+	// session, and LockTTL the maximum time a lock is held, see Config.LockSession.
+	LockTimeout time.Duration
+	LockTTL     time.Duration
+	locker      localLocker
+
 	// Store controls the session store where the session data is persisted.
 	Store   Store
 	CokName string
@@ -59,7 +83,9 @@ type Manager struct {
 
 	// Codec controls the encoder/decoder used to transform session data to a
 	// byte slice for use by the session store. By default session data is
-	// encoded/decoded using encoding/gob.
+	// encoded/decoded using JSONCodec, MsgpackCodec is more compact and keeps
+	// the types of the values. Use MigrationCodec to change the codec of a
+	// store holding sessions.
 	Codec Codec
 
 	// ErrorFunc allows you to control behavior when an error is encountered by
@@ -122,9 +148,25 @@ type Cookie struct {
 	Secure bool
 }
 type Config struct {
-	manager   *Manager
-	Skip      routing.Skipper
-	Lifetime  time.Duration
+	manager *Manager
+	// Deprecated: register the middleware with RouteGroup.UseExcept instead.
+	Skip routing.Skipper
+	// Lifetime 会话的绝对有效期，自创建或者更换 token 起计算，不因访问而延长
+	Lifetime time.Duration
+	// IdleTimeout 会话的空闲超时，每次访问都会延长会话的过期时间，但不超过 Lifetime；不大于 0 时不启用
+	IdleTimeout time.Duration
+	// Conflict 并发请求修改同一会话时的处理策略，默认为 ConflictOverwrite（后提交者覆盖），
+	// 其余策略需要 Store 实现 VersionedStore，否则同 ConflictOverwrite
+	Conflict ConflictPolicy
+	// MaxCommitRetries ConflictMerge 时合并后重新提交的最大次数，默认为 DefaultMaxCommitRetries
+	MaxCommitRetries int
+	// LockSession 为 true 时，同一会话的请求依次处理：从加载会话之前直到提交之后持有会话锁。
+	// Store 未实现 LockingStore 时仅在进程内加锁，多个实例共享会话时需使用实现了 LockingStore 的存储，例如 redisstore
+	LockSession bool
+	// LockTimeout 等待会话锁的最长时间，默认为 DefaultLockTimeout，超时返回 ErrLockTimeout
+	LockTimeout time.Duration
+	// LockTTL 会话锁的最长持有时间，持有者崩溃时锁在此之后自动释放，默认为 DefaultLockTTL
+	LockTTL   time.Duration
 	Store     Store
 	Codec     Codec
 	ErrorFunc func(ctx *routing.Ctx, err error)
@@ -138,7 +180,9 @@ type Config struct {
 	CokSecure              bool
 	disableCsrf            bool
 	//
-	IdSize     int
+	IdSize int
+	// AppendHash 为会话和 CSRF 令牌附加并验证标签，例如 utilcrypt.NewHMACHash(key, oldKeys...)，密钥需固定且在多个实例间相同。
+	// 使用 MemoryStore 以外的存储时必须配置；使用 MemoryStore 时会话不会在重启后保留，未配置时使用随机生成的密钥
 	AppendHash utilcrypt.BytesWithHash
 }
 
@@ -148,7 +192,6 @@ var DefCfg = Config{
 	CokName:     "new_fire_session",
 	Codec:       JSONCodec{},
 	CokSameSite: http.SameSiteLaxMode,
-	AppendHash:  utilcrypt.SimpleHash{},
 }
 
 func New(cfgs ...*Config) routing.Handler {
@@ -165,15 +208,32 @@ func New(cfgs ...*Config) routing.Handler {
 // Handle 此中间件可能返回的错误:
 // EncodingError (在序列化时遇到错误)
 // StoreError (在从Store中加载数据或者存储数据时遇到错误)
+// ConflictError (会话被并发请求修改，且 Conflict 策略未能提交)
+// ErrLockTimeout (LockSession 时等待会话锁超时)
 // 当遇到这两种错误时，此中间件不会像客户端发送session cookie
 func (cfg *Config) Handle(c *routing.Ctx) (err error) {
 	if cfg.Skip != nil && cfg.Skip(c) {
 		return c.Next()
 	}
-	// ctx := context.Background()
-	ctx := context.Context(nil)
+	if s, ok := storeAs[cookieSessions](cfg.Store); ok {
+		return s.handleCookieSession(c, cfg)
+	}
+	// the store calls are bound to the deadline of the timeout middleware, if any
+	ctx := c.Context()
 	data, newToken := cfg.getSession(c)
+	if cfg.LockSession && !newToken {
+		var unlock func()
+		if unlock, err = cfg.manager.lockSession(ctx, data.token); err != nil {
+			cfg.manager.dataPool.Release(data)
+			return
+		}
+		defer unlock()
+	}
 	err = cfg.handleStatefulRequest(c, ctx, data, newToken)
+	if c.TimedOut() {
+		// data may still be used by the handlers which did not finish in time
+		return
+	}
 	cfg.manager.dataPool.Release(data)
 	return
 }
@@ -188,6 +248,11 @@ func (cfg *Config) handleStatefulRequest(c *routing.Ctx, ctx context.Context, da
 	}
 	c.SetUserValue(ContextKey, data)
 	err = c.Next()
+	if c.TimedOut() {
+		// the timeout response has been sent, and the handlers which did not finish in time
+		// may still be modifying data, so it is not committed
+		return
+	}
 	err2 := cfg.manager.commit(ctx, c, data)
 	//
 	if err == nil {
@@ -198,17 +263,20 @@ func (cfg *Config) handleStatefulRequest(c *routing.Ctx, ctx context.Context, da
 		return
 	}
 	if data.status == Destroyed {
-		c.Response.Header.DelClientCookie(cfg.CokName)
+		cfg.deleteCookie(c, cfg.CokName)
 		return
 	}
-	cfg.addCookieToResponse(c, data.token, data.GetBool("__rememberMe"))
+	cfg.setCookie(c, cfg.CokName, data.token, data.GetBool("__rememberMe"), data.expiry())
 	return
 }
-func (cfg *Config) addCookieToResponse(c *routing.Ctx, token []byte, rememberMe bool) {
+
+// setCookie sets the session cookie name, with the attributes of cfg. A persistent cookie expires
+// with the session, at expiry.
+func (cfg *Config) setCookie(c *routing.Ctx, name string, value []byte, rememberMe bool, expiry time.Time) {
 	cok := fasthttp.AcquireCookie()
 	defer fasthttp.ReleaseCookie(cok)
-	cok.SetKey(cfg.CokName)
-	cok.SetValueBytes(token)
+	cok.SetKey(name)
+	cok.SetValueBytes(value)
 	if cfg.CokPath != "" {
 		cok.SetPath(cfg.CokPath)
 	}
@@ -224,11 +292,32 @@ func (cfg *Config) addCookieToResponse(c *routing.Ctx, token []byte, rememberMe
 	cok.SetSameSite(fasthttp.CookieSameSite(cfg.CokSameSite))
 
 	if !cfg.DisableCokPersist || rememberMe {
-		cok.SetMaxAge(int(cfg.Lifetime.Seconds())) // Round up to the nearest second.
+		cok.SetMaxAge(max(int(math.Ceil(time.Until(expiry).Seconds())), 1)) // Round up to the nearest second.
 	}
 	c.Response.Header.SetCookie(cok)
 	// c.Response.Header.Add("Cache-Control", `no-cache="Set-Cookie"`)
 }
+
+// deleteCookie removes the cookie name from the client. The cookie has the Path and Domain of
+// setCookie: a browser keeps a cookie whose deletion does not match them.
+func (cfg *Config) deleteCookie(c *routing.Ctx, name string) {
+	c.Response.Header.DelCookie(name)
+	cok := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cok)
+	cok.SetKey(name)
+	if cfg.CokPath != "" {
+		cok.SetPath(cfg.CokPath)
+	}
+	if cfg.CokDomain != "" {
+		cok.SetDomain(cfg.CokDomain)
+	}
+	if cfg.CokSecure {
+		cok.SetSecure(true)
+	}
+	cok.SetSameSite(fasthttp.CookieSameSite(cfg.CokSameSite))
+	cok.SetExpire(fasthttp.CookieExpireDelete)
+	c.Response.Header.SetCookie(cok)
+}
 func (cfg *Config) getSession(c *routing.Ctx) (data *Data, newToken bool) {
 	data = cfg.manager.dataPool.Acquire()
 	token := c.Request.Header.Cookie(cfg.CokName)
@@ -237,14 +326,15 @@ func (cfg *Config) getSession(c *routing.Ctx) (data *Data, newToken bool) {
 }
 func (cfg *Config) initSessionManager() {
 	if cfg.Store == nil {
-		c, err := rueidis.NewClient(rueidis.ClientOption{
-			ForceSingleClient: true,
-			InitAddress:       []string{"127.0.0.1:6379"},
-		})
-		if err != nil {
-			log.Fatal().Caller().Err(err).Send()
+		// 未配置存储时使用进程内存，多个实例或者需要在重启后保留会话时使用 redisstore 或 filestore
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.AppendHash == nil {
+		if _, ok := cfg.Store.(*MemoryStore); !ok {
+			// a random key would invalidate the sessions of the store on restart, and on the other instances
+			log.Fatal().Caller().Msg("session: AppendHash must be configured with a fixed key when the store is not a MemoryStore")
 		}
-		cfg.Store = redisstore.New(c)
+		cfg.AppendHash = utilcrypt.NewHMACHash(utilcrypt.RandomKey(utilcrypt.MinHMACKeyLen))
 	}
 	m := new(Manager)
 	m.AppendHash = cfg.AppendHash
@@ -253,6 +343,20 @@ func (cfg *Config) initSessionManager() {
 	m.CokName = cfg.CokName
 	m.Codec = cfg.Codec
 	m.Lifetime = cfg.Lifetime
+	m.IdleTimeout = cfg.IdleTimeout
+	m.Conflict = cfg.Conflict
+	m.MaxCommitRetries = cfg.MaxCommitRetries
+	if m.MaxCommitRetries <= 0 {
+		m.MaxCommitRetries = DefaultMaxCommitRetries
+	}
+	m.LockTimeout = cfg.LockTimeout
+	if m.LockTimeout <= 0 {
+		m.LockTimeout = DefaultLockTimeout
+	}
+	m.LockTTL = cfg.LockTTL
+	if m.LockTTL <= 0 {
+		m.LockTTL = DefaultLockTTL
+	}
 	m.ErrorFunc = cfg.ErrorFunc
 	// encodedTokenLen := base64.RawURLEncoding.EncodedLen(m.AppendHash.EncodedLen(cfg.IdSize))
 	// encodedCsrfTokenLen := base64.RawURLEncoding.EncodedLen(m.AppendHash.EncodedLen(CsrfTokenLen))
@@ -270,7 +374,6 @@ func (cfg *Config) initSessionManager() {
 				// data.csrfToken = make([]byte, 0, encodedCsrfTokenLen)
 			}
 			data.values = make(map[string]interface{})
-			// data.deadline = time.Now().Add(cfg.Lifetime).UTC()
 			data.manager = m
 			return data
 		},
@@ -3,10 +3,7 @@ package session
 import (
 	"context"
 	"errors"
-	"io/ioutil"
 	"math/rand"
-	"net/http"
-	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
@@ -14,39 +11,39 @@ import (
 
 	routing "fasthttp-routing"
 	"github.com/deckarep/golang-set/v2"
+	"github.com/newacorn/fasthttp"
 	"helpers/unsafefn"
 )
 
 type testServer struct {
-	*routing.Router
+	*routing.TestClient
 }
 
 func newTestServer(t *testing.T, app *routing.Router) *testServer {
-	return &testServer{app}
+	return &testServer{app.TestClient()}
 }
 
-func (ts *testServer) execute(t *testing.T, urlPath string, reqCookie *http.Cookie) (*http.Cookie, string) {
-	req := httptest.NewRequest("GET", urlPath, nil)
+func (ts *testServer) execute(t *testing.T, urlPath string, reqCookie *fasthttp.Cookie) (*fasthttp.Cookie, string) {
+	// cookies are passed explicitly by the tests rather than kept by the jar
+	clear(ts.Jar)
+	req := ts.Get(urlPath)
 	if reqCookie != nil {
-		req.AddCookie(reqCookie)
+		req.Cookie(string(reqCookie.Key()), string(reqCookie.Value()))
 	}
 
-	res, err := ts.Test(req)
+	res, err := req.Do()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	var resCookie *http.Cookie
-	if len(res.Cookies()) > 0 {
-		resCookie = res.Cookies()[0]
-	}
+	var resCookie *fasthttp.Cookie
+	res.Header.VisitAllCookie(func(key, value []byte) {
+		if resCookie == nil {
+			resCookie = res.Cookie(string(key))
+		}
+	})
 
-	return resCookie, string(body)
+	return resCookie, string(res.Body())
 }
 
 func TestEnable(t *testing.T) {
@@ -69,18 +66,18 @@ func TestEnable(t *testing.T) {
 	ts := newTestServer(t, app)
 
 	cookie1, _ := ts.execute(t, "/put", nil)
-	token1 := cookie1.Value
+	token1 := string(cookie1.Value())
 
 	cookie2, body := ts.execute(t, "/get", cookie1)
 	if body != "bar" {
 		t.Errorf("want %q; got %q", "bar", body)
 	}
-	if cookie2.Value != cookie1.Value {
-		t.Errorf("want %q; got %q", cookie1.Value, cookie2.Value)
+	if string(cookie2.Value()) != string(cookie1.Value()) {
+		t.Errorf("want %q; got %q", string(cookie1.Value()), string(cookie2.Value()))
 	}
 
 	cookie3, _ := ts.execute(t, "/put", cookie1)
-	token2 := cookie3.Value
+	token2 := string(cookie3.Value())
 	if token1 != token2 {
 		t.Error("want tokens to be the same")
 	}
@@ -128,12 +125,13 @@ func TestLifetime(t *testing.T) {
 	}
 }
 
-func TestLifetimeRefresh(t *testing.T) {
+func TestIdleTimeout(t *testing.T) {
 	t.Parallel()
 
 	app := routing.New()
 	cfg := DefCfg
-	cfg.Lifetime = 4 * time.Second
+	cfg.Lifetime = time.Hour
+	cfg.IdleTimeout = time.Second
 	app.Use(New(&cfg))
 
 	app.Get("/put", func(c *routing.Ctx) error {
@@ -155,20 +153,79 @@ func TestLifetimeRefresh(t *testing.T) {
 	ts := newTestServer(t, app)
 
 	cookie, _ := ts.execute(t, "/put", nil)
+	if cookie.MaxAge() != 1 {
+		t.Errorf("want Max-Age %d; got %d", 1, cookie.MaxAge())
+	}
 
-	time.Sleep(2 * time.Second)
+	// the unmodified session is extended by each request
+	time.Sleep(600 * time.Millisecond)
 	_, _ = ts.execute(t, "/get", cookie)
 
-	time.Sleep(2 * time.Second)
+	time.Sleep(600 * time.Millisecond)
 	_, body := ts.execute(t, "/get", cookie)
 	if body != "bar" {
 		t.Errorf("want %q; got %q", "bar", body)
 	}
 
-	time.Sleep(2 * time.Second)
+	time.Sleep(1200 * time.Millisecond)
 	_, body = ts.execute(t, "/get", cookie)
-	if body != "bar" {
-		t.Errorf("want %q; got %q", "bar", body)
+	if body != "foo does not exist in session" {
+		t.Errorf("want %q; got %q", "foo does not exist in session", body)
+	}
+}
+
+func TestLifetimeAbsolute(t *testing.T) {
+	t.Parallel()
+
+	app := routing.New()
+	cfg := DefCfg
+	cfg.Lifetime = time.Second
+	cfg.IdleTimeout = time.Hour
+	app.Use(New(&cfg))
+
+	var deadline, idleDeadline time.Time
+	app.Get("/put", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Put("foo", "bar")
+		deadline = d.Deadline()
+		return nil
+	})
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		idleDeadline = d.IdleDeadline()
+		v := d.Get("foo")
+		if v == nil {
+			c.SetBodyString("foo does not exist in session")
+			return nil
+		}
+		if !d.Deadline().Equal(deadline.Truncate(time.Millisecond)) {
+			c.SetBodyString("deadline changed")
+			return nil
+		}
+		c.SetBodyString(v.(string))
+		return nil
+	})
+
+	ts := newTestServer(t, app)
+
+	cookie, _ := ts.execute(t, "/put", nil)
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(400 * time.Millisecond)
+		_, body := ts.execute(t, "/get", cookie)
+		if body != "bar" {
+			t.Errorf("want %q; got %q", "bar", body)
+		}
+		// the idle deadline never passes the absolute deadline
+		if !idleDeadline.Equal(deadline.Truncate(time.Millisecond)) {
+			t.Errorf("want idle deadline %v; got %v", deadline, idleDeadline)
+		}
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	_, body := ts.execute(t, "/get", cookie)
+	if body != "foo does not exist in session" {
+		t.Errorf("want %q; got %q", "foo does not exist in session", body)
 	}
 }
 
@@ -210,7 +267,7 @@ func TestDestroy(t *testing.T) {
 	cookie1, _ := ts.execute(t, "/put", nil)
 	cookie, _ := ts.execute(t, "/destroy", cookie1)
 
-	if cookie1.Value == cookie.Value {
+	if string(cookie1.Value()) == string(cookie.Value()) {
 		t.Fatalf("cookie1 should be different from cookie")
 	}
 	/*
@@ -265,10 +322,10 @@ func TestRenewToken(t *testing.T) {
 	ts := newTestServer(t, app)
 
 	cookie, _ := ts.execute(t, "/put", nil)
-	originalToken := cookie.Value
+	originalToken := string(cookie.Value())
 
 	cookie, _ = ts.execute(t, "/renew", cookie)
-	newToken := cookie.Value
+	newToken := string(cookie.Value())
 
 	if newToken == originalToken {
 		t.Fatal("token has not changed")
@@ -373,3 +430,16 @@ func TestIterate(t *testing.T) {
 		t.Fatal("didn't get expected error")
 	}
 }
+
+func TestDefaultAppendHash(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	New(&cfg)
+	// only the sessions of a MemoryStore, which do not outlive the process, get a random key
+	if _, ok := cfg.Store.(*MemoryStore); !ok {
+		t.Fatalf("want a MemoryStore; got %T", cfg.Store)
+	}
+	if cfg.AppendHash == nil {
+		t.Error("want a random key; got nil")
+	}
+}
@@ -58,3 +58,49 @@ type IterableCtxStore interface {
 	// context.Context.
 	AllCtx(ctx context.Context) (map[string][]byte, error)
 }
+
+// UserIndexStore is the interface for session stores which index the sessions by user, see
+// Manager.BindUser. The index holds the tokens of the sessions of each user, each with an opaque
+// info encoded by the Manager, and forgets a session at the expiry given to CommitUserSession.
+type UserIndexStore interface {
+	// CommitUserSession should add the session token to the sessions of userID,
+	// with the given info and expiry time. If the session token is already
+	// indexed, then the info and expiry time should be overwritten.
+	CommitUserSession(ctx context.Context, userID string, token []byte, info []byte, expiry time.Time) (err error)
+
+	// DeleteUserSession should remove the session token from the sessions of
+	// userID. If the token is not indexed then DeleteUserSession should be a
+	// no-op and return nil (not an error).
+	DeleteUserSession(ctx context.Context, userID string, token []byte) (err error)
+
+	// UserSessions should return a map containing the info of all active
+	// sessions of userID, keyed by session token. If the user has no active
+	// sessions this should return an empty (not nil) map.
+	UserSessions(ctx context.Context, userID string) (map[string][]byte, error)
+}
+
+// VersionedStore is the interface for session stores which commit the data of a session only if
+// it has not been changed since it was found, see Config.Conflict. The version is an opaque stamp
+// of the data in the store, which changes whenever new data is committed.
+type VersionedStore interface {
+	// FindVersion is the same as Store.Find, except it also returns the version
+	// of the data. The version of a session which is not found should be "".
+	FindVersion(ctx context.Context, token []byte) (b []byte, version string, found bool, err error)
+
+	// CommitVersion should commit the data like Store.Commit with modified set
+	// to true, only if the version of the data in the store is still version,
+	// "" meaning that the session is not in the store. The committed return
+	// value should be false (and the err return value should be nil) when the
+	// version does not match.
+	CommitVersion(ctx context.Context, token []byte, b []byte, expiry time.Time, version string) (committed bool, err error)
+}
+
+// LockingStore is the interface for session stores which lock the sessions across the instances
+// sharing the store, see Config.LockSession. The sessions are locked in the process when the
+// store does not implement LockingStore.
+type LockingStore interface {
+	// Lock should acquire the lock of the session token, waiting until ctx is
+	// done, and return the function releasing it. The lock should be released
+	// after ttl if it is not released before, e.g. when the process crashes.
+	Lock(ctx context.Context, token []byte, ttl time.Duration) (unlock func(), err error)
+}
@@ -0,0 +1,316 @@
+// Package storetest provides a conformance test suite for the implementations of session.Store.
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storetest.Store {
+//			return New(t.TempDir())
+//		})
+//	}
+//
+// The optional CtxStore, IterableStore, IterableCtxStore, UserIndexStore and VersionedStore
+// methods are tested when implemented.
+// The suite waits for a session to expire, so it takes a bit more than one second.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Store is session.Store, declared again so that the tests of the session package can use the suite.
+type Store interface {
+	Delete(token []byte) (err error)
+	Find(token []byte) (b []byte, found bool, err error)
+	Commit(token []byte, b []byte, expiry time.Time, modified bool) (err error)
+}
+
+type ctxStore interface {
+	DeleteCtx(ctx context.Context, token []byte) (err error)
+	FindCtx(ctx context.Context, token []byte) (b []byte, found bool, err error)
+	CommitCtx(ctx context.Context, token []byte, b []byte, expiry time.Time, modified bool) (err error)
+}
+
+type iterableStore interface {
+	All() (map[string][]byte, error)
+}
+
+type iterableCtxStore interface {
+	AllCtx(ctx context.Context) (map[string][]byte, error)
+}
+
+type versionedStore interface {
+	FindVersion(ctx context.Context, token []byte) (b []byte, version string, found bool, err error)
+	CommitVersion(ctx context.Context, token []byte, b []byte, expiry time.Time, version string) (committed bool, err error)
+}
+
+type userIndexStore interface {
+	CommitUserSession(ctx context.Context, userID string, token []byte, info []byte, expiry time.Time) (err error)
+	DeleteUserSession(ctx context.Context, userID string, token []byte) (err error)
+	UserSessions(ctx context.Context, userID string) (map[string][]byte, error)
+}
+
+// newToken returns a token shaped like the tokens of the session package, with the store key prefix.
+func newToken() []byte {
+	raw := make([]byte, 46)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return []byte("scs:session:" + base64.RawURLEncoding.EncodeToString(raw))
+}
+
+// Run runs the suite against the stores returned by newStore, which is called once per test
+// and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("FindMissing", func(t *testing.T) {
+		s := newStore(t)
+		b, found, err := s.Find(newToken())
+		assert.Nil(t, err)
+		assert.False(t, found)
+		assert.Nil(t, b)
+	})
+	t.Run("CommitFind", func(t *testing.T) {
+		s := newStore(t)
+		token := newToken()
+		data := []byte(`{"foo":"bar"}`)
+		assert.Nil(t, s.Commit(token, data, time.Now().Add(time.Hour), true))
+		// the store must not keep the buffers of the caller
+		data[0] = 'x'
+		token2 := bytes.Clone(token)
+		token[len(token)-1] ^= 1
+		b, found, err := s.Find(token2)
+		assert.Nil(t, err)
+		assert.True(t, found)
+		assert.Equal(t, `{"foo":"bar"}`, string(b))
+
+		assert.Nil(t, s.Commit(token2, []byte("v2"), time.Now().Add(time.Hour), true))
+		b, _, _ = s.Find(token2)
+		assert.Equal(t, "v2", string(b))
+	})
+	t.Run("CommitUnmodified", func(t *testing.T) {
+		s := newStore(t)
+		token := newToken()
+		// an unmodified session which is not in the store is stored
+		assert.Nil(t, s.Commit(token, []byte("v1"), time.Now().Add(time.Hour), false))
+		b, found, _ := s.Find(token)
+		assert.True(t, found)
+		assert.Equal(t, "v1", string(b))
+		assert.Nil(t, s.Commit(token, []byte("v1"), time.Now().Add(2*time.Hour), false))
+		b, found, _ = s.Find(token)
+		assert.True(t, found)
+		assert.Equal(t, "v1", string(b))
+	})
+	t.Run("Delete", func(t *testing.T) {
+		s := newStore(t)
+		token := newToken()
+		assert.Nil(t, s.Commit(token, []byte("v"), time.Now().Add(time.Hour), true))
+		assert.Nil(t, s.Delete(token))
+		_, found, err := s.Find(token)
+		assert.Nil(t, err)
+		assert.False(t, found)
+		// deleting a missing session is a no-op
+		assert.Nil(t, s.Delete(token))
+	})
+	t.Run("Expiry", func(t *testing.T) {
+		s := newStore(t)
+		token, extended := newToken(), newToken()
+		expiry := time.Now().Add(time.Second)
+		assert.Nil(t, s.Commit(token, []byte("v"), expiry, true))
+		assert.Nil(t, s.Commit(extended, []byte("v"), expiry, true))
+		assert.Nil(t, s.Commit(extended, []byte("v"), time.Now().Add(time.Hour), false))
+		us, isUserIndex := s.(userIndexStore)
+		if isUserIndex {
+			ctx := context.Background()
+			assert.Nil(t, us.CommitUserSession(ctx, "u1", token, []byte("i"), expiry))
+			assert.Nil(t, us.CommitUserSession(ctx, "u1", extended, []byte("i"), time.Now().Add(time.Hour)))
+		}
+		_, found, _ := s.Find(token)
+		assert.True(t, found)
+		time.Sleep(time.Until(expiry) + 100*time.Millisecond)
+		b, found, err := s.Find(token)
+		assert.Nil(t, err)
+		assert.False(t, found)
+		assert.Nil(t, b)
+		_, found, _ = s.Find(extended)
+		assert.True(t, found)
+		if isUserIndex {
+			sessions, err := us.UserSessions(context.Background(), "u1")
+			assert.Nil(t, err)
+			assert.Equal(t, map[string][]byte{string(extended): []byte("i")}, sessions)
+		}
+		if it, ok := s.(iterableStore); ok {
+			all, err := it.All()
+			assert.Nil(t, err)
+			assert.Len(t, all, 1)
+		}
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		s := newStore(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				token := newToken()
+				for j := 0; j < 20; j++ {
+					v := []byte(strconv.Itoa(i) + "-" + strconv.Itoa(j))
+					assert.Nil(t, s.Commit(token, v, time.Now().Add(time.Hour), true))
+					b, found, err := s.Find(token)
+					assert.Nil(t, err)
+					assert.True(t, found)
+					assert.Equal(t, string(v), string(b))
+				}
+				assert.Nil(t, s.Delete(token))
+			}(i)
+		}
+		wg.Wait()
+	})
+	t.Run("All", func(t *testing.T) {
+		s := newStore(t)
+		it, ok := s.(iterableStore)
+		if !ok {
+			t.Skip("not an IterableStore")
+		}
+		all, err := it.All()
+		assert.Nil(t, err)
+		assert.Empty(t, all)
+		tokens := map[string]string{}
+		for i := 0; i < 3; i++ {
+			token := newToken()
+			tokens[string(token)] = strconv.Itoa(i)
+			assert.Nil(t, s.Commit(token, []byte(strconv.Itoa(i)), time.Now().Add(time.Hour), true))
+		}
+		all, err = it.All()
+		assert.Nil(t, err)
+		assert.Len(t, all, 3)
+		for k, v := range all {
+			// the keys may be returned without the key prefix
+			token := k
+			if _, ok := tokens[token]; !ok {
+				token = "scs:session:" + k
+			}
+			assert.Equal(t, tokens[token], string(v))
+		}
+	})
+	t.Run("Version", func(t *testing.T) {
+		s := newStore(t)
+		vs, ok := s.(versionedStore)
+		if !ok {
+			t.Skip("not a VersionedStore")
+		}
+		ctx := context.Background()
+		token := newToken()
+		expiry := time.Now().Add(time.Hour)
+		b, v, found, err := vs.FindVersion(ctx, token)
+		assert.Nil(t, err)
+		assert.False(t, found)
+		assert.Nil(t, b)
+		assert.Equal(t, "", v)
+
+		committed, err := vs.CommitVersion(ctx, token, []byte("v1"), expiry, "")
+		assert.Nil(t, err)
+		assert.True(t, committed)
+		// the session has been created by another request
+		committed, err = vs.CommitVersion(ctx, token, []byte("v1'"), expiry, "")
+		assert.Nil(t, err)
+		assert.False(t, committed)
+
+		b, v1, found, err := vs.FindVersion(ctx, token)
+		assert.Nil(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "v1", string(b))
+		assert.NotEqual(t, "", v1)
+		committed, _ = vs.CommitVersion(ctx, token, []byte("v2"), expiry, v1)
+		assert.True(t, committed)
+		committed, _ = vs.CommitVersion(ctx, token, []byte("v2'"), expiry, v1)
+		assert.False(t, committed)
+
+		// the commits of Store change the version too
+		_, v2, _, _ := vs.FindVersion(ctx, token)
+		assert.NotEqual(t, v1, v2)
+		assert.Nil(t, s.Commit(token, []byte("v3"), expiry, true))
+		committed, _ = vs.CommitVersion(ctx, token, []byte("v3'"), expiry, v2)
+		assert.False(t, committed)
+		b, _, _, _ = vs.FindVersion(ctx, token)
+		assert.Equal(t, "v3", string(b))
+
+		assert.Nil(t, s.Delete(token))
+		committed, _ = vs.CommitVersion(ctx, token, []byte("v4"), expiry, v2)
+		assert.False(t, committed)
+	})
+	t.Run("UserIndex", func(t *testing.T) {
+		s := newStore(t)
+		us, ok := s.(userIndexStore)
+		if !ok {
+			t.Skip("not a UserIndexStore")
+		}
+		ctx := context.Background()
+		sessions, err := us.UserSessions(ctx, "u1")
+		assert.Nil(t, err)
+		assert.NotNil(t, sessions)
+		assert.Empty(t, sessions)
+
+		t1, t2, t3 := newToken(), newToken(), newToken()
+		expiry := time.Now().Add(time.Hour)
+		assert.Nil(t, us.CommitUserSession(ctx, "u1", t1, []byte("a"), expiry))
+		assert.Nil(t, us.CommitUserSession(ctx, "u1", t2, []byte("b"), expiry))
+		assert.Nil(t, us.CommitUserSession(ctx, "u2", t3, []byte("c"), expiry))
+		// committing again overwrites the info
+		assert.Nil(t, us.CommitUserSession(ctx, "u1", t1, []byte("a2"), expiry))
+		sessions, err = us.UserSessions(ctx, "u1")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string][]byte{string(t1): []byte("a2"), string(t2): []byte("b")}, sessions)
+
+		assert.Nil(t, us.DeleteUserSession(ctx, "u1", t1))
+		// deleting a missing entry is a no-op
+		assert.Nil(t, us.DeleteUserSession(ctx, "u1", t3))
+		assert.Nil(t, us.DeleteUserSession(ctx, "u3", t3))
+		sessions, _ = us.UserSessions(ctx, "u1")
+		assert.Equal(t, map[string][]byte{string(t2): []byte("b")}, sessions)
+		sessions, _ = us.UserSessions(ctx, "u2")
+		assert.Equal(t, map[string][]byte{string(t3): []byte("c")}, sessions)
+
+		assert.Nil(t, us.DeleteUserSession(ctx, "u1", t2))
+		sessions, err = us.UserSessions(ctx, "u1")
+		assert.Nil(t, err)
+		assert.Empty(t, sessions)
+	})
+	t.Run("Ctx", func(t *testing.T) {
+		s := newStore(t)
+		cs, ok := s.(ctxStore)
+		if !ok {
+			t.Skip("not a CtxStore")
+		}
+		ctx := context.Background()
+		token := newToken()
+		assert.Nil(t, cs.CommitCtx(ctx, token, []byte("v"), time.Now().Add(time.Hour), true))
+		b, found, err := cs.FindCtx(ctx, token)
+		assert.Nil(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "v", string(b))
+		if it, ok := s.(iterableCtxStore); ok {
+			all, err := it.AllCtx(ctx)
+			assert.Nil(t, err)
+			assert.Len(t, all, 1)
+		}
+
+		// the operations fail once the context is done, e.g. past the deadline of the request
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, _, err = cs.FindCtx(cancelled, token)
+		assert.NotNil(t, err)
+		assert.NotNil(t, cs.CommitCtx(cancelled, token, []byte("v2"), time.Now().Add(time.Hour), true))
+		assert.NotNil(t, cs.DeleteCtx(cancelled, token))
+
+		assert.Nil(t, cs.DeleteCtx(ctx, token))
+		_, found, err = cs.FindCtx(ctx, token)
+		assert.Nil(t, err)
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ValueConverter is implemented by the codecs which do not keep the Go types of the values they
+// decode, e.g. JSONCodec decodes the numbers as float64 and time.Time as a string. Get and Pop use
+// it to convert such a value to the requested type.
+type ValueConverter interface {
+	// ConvertValue converts v, as decoded by the codec, to the value pointed to by dst.
+	ConvertValue(v interface{}, dst interface{}) error
+}
+
+// types 注册的值类型，供不保留 Go 类型的编解码器（如 JSONCodec）解码时还原
+var types = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	names  map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	names:  make(map[reflect.Type]string),
+}
+
+func init() {
+	for _, v := range []interface{}{
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), time.Time{}, time.Duration(0),
+		[]byte(nil), []string(nil), map[string]string(nil), []FlashMessage(nil),
+	} {
+		Register(v)
+	}
+}
+
+// RegisterType registers the type of value under name, so that the codecs which do not keep the
+// Go types of the values, such as JSONCodec, decode the values of this type as this type rather
+// than as the generic types of the encoding. The integers, time.Time, time.Duration, []byte,
+// []string and map[string]string are registered by default.
+//
+// Like gob.RegisterName, the types must be registered at init, under the same name in all the
+// instances sharing the store. It panics if name or the type is already registered differently.
+func RegisterType(name string, value interface{}) {
+	if name == "" {
+		panic("session: attempt to register empty name")
+	}
+	t := reflect.TypeOf(value)
+	types.Lock()
+	defer types.Unlock()
+	if old, ok := types.byName[name]; ok && old != t {
+		panic("session: registering duplicate types for " + name + ": " + old.String() + " != " + t.String())
+	}
+	if old, ok := types.names[t]; ok && old != name {
+		panic("session: registering duplicate names for " + t.String() + ": " + old + " != " + name)
+	}
+	types.byName[name] = t
+	types.names[t] = name
+}
+
+// Register registers the type of value under its name, such as "main.Cart", see RegisterType.
+func Register(value interface{}) {
+	RegisterType(reflect.TypeOf(value).String(), value)
+}
+
+// typeName returns the name of the type of v if it is registered.
+func typeName(v interface{}) (name string, ok bool) {
+	switch v.(type) {
+	case nil, string, bool, float64, map[string]interface{}, []interface{}:
+		// decoded as is
+		return "", false
+	}
+	types.RLock()
+	name, ok = types.names[reflect.TypeOf(v)]
+	types.RUnlock()
+	return
+}
+
+// registeredType returns the type registered under name.
+func registeredType(name string) (t reflect.Type, ok bool) {
+	types.RLock()
+	t, ok = types.byName[name]
+	types.RUnlock()
+	return
+}
+
+// Get returns the value of key as a T, and whether the session has such a value. The values
+// which have not been decoded as a T, e.g. the numbers of the data encoded by JSONCodec before
+// their type was registered, are converted by the codec when it implements ValueConverter.
+func Get[T any](d *Data, key string) (t T, ok bool) {
+	v, exists := d.values[key]
+	if !exists {
+		return
+	}
+	return convert[T](d.manager.Codec, v)
+}
+
+// Pop returns the value of key as a T, like Get, and then deletes it from the session data. The
+// session data status will be set to Modified if the key exists.
+func Pop[T any](d *Data, key string) (t T, ok bool) {
+	if _, exists := d.values[key]; !exists {
+		return
+	}
+	return convert[T](d.manager.Codec, d.Pop(key))
+}
+
+func convert[T any](codec Codec, v interface{}) (t T, ok bool) {
+	if t, ok = v.(T); ok || v == nil {
+		return
+	}
+	c, isConverter := codec.(ValueConverter)
+	if !isConverter {
+		return
+	}
+	if err := c.ConvertValue(v, &t); err != nil {
+		var zero T
+		return zero, false
+	}
+	return t, true
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/bytedance/sonic"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCart struct {
+	Items []string
+	Total int64
+}
+
+type testUnregistered struct {
+	Name string
+}
+
+// testTags and testCounts are registered with a kind for which a corrupt payload may hold a
+// msgpack value of the same kind, see TestMsgpackCodecCorruptTyped.
+type (
+	testTags   []string
+	testCounts map[string]int
+)
+
+func init() {
+	Register(testCart{})
+	Register(testTags{})
+	Register(testCounts{})
+}
+
+func TestJSONCodecTypes(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	codec := JSONCodec{}
+	b, err := codec.Encode(time.Time{}, nil, map[string]interface{}{
+		"int":          42,
+		"int64":        int64(1) << 40,
+		"time":         now,
+		"bytes":        []byte("raw"),
+		"cart":         testCart{Items: []string{"a", "b"}, Total: 3},
+		"unregistered": testUnregistered{Name: "x"},
+		"string":       "s",
+	})
+	assert.Nil(t, err)
+	_, _, values, err := codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, values["int"])
+	assert.Equal(t, int64(1)<<40, values["int64"])
+	assert.True(t, now.Equal(values["time"].(time.Time)))
+	assert.Equal(t, []byte("raw"), values["bytes"])
+	assert.Equal(t, testCart{Items: []string{"a", "b"}, Total: 3}, values["cart"])
+	assert.Equal(t, map[string]interface{}{"Name": "x"}, values["unregistered"])
+	assert.Equal(t, "s", values["string"])
+
+	d := &Data{manager: &Manager{Codec: codec}, values: values}
+	u, ok := Get[testUnregistered](d, "unregistered")
+	assert.True(t, ok)
+	assert.Equal(t, "x", u.Name)
+	_, ok = Get[int](d, "string")
+	assert.False(t, ok)
+	_, ok = Get[int](d, "missing")
+	assert.False(t, ok)
+}
+
+// TestJSONCodecUntyped decodes the data encoded before the types were recorded.
+func TestJSONCodecUntyped(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b, err := sonic.Marshal(&Aux{V: map[string]interface{}{"int": 42, "time": now, "float": 1.5}})
+	assert.Nil(t, err)
+	codec := JSONCodec{}
+	_, _, values, err := codec.Decode(b, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(42), values["int"])
+
+	d := &Data{manager: &Manager{Codec: codec}, values: values}
+	assert.Equal(t, 42, d.GetInt("int"))
+	assert.Equal(t, int64(42), d.GetInt64("int"))
+	assert.True(t, now.Equal(d.GetTime("time")))
+	_, ok := Get[int](d, "float")
+	assert.False(t, ok)
+	i, ok := Pop[int32](d, "int")
+	assert.True(t, ok)
+	assert.Equal(t, int32(42), i)
+	assert.False(t, d.Exists("int"))
+	assert.Equal(t, Modified, d.Status())
+}
+
+func TestRegisterTypeDuplicate(t *testing.T) {
+	t.Parallel()
+	assert.Panics(t, func() { RegisterType("int", int64(0)) })
+	assert.Panics(t, func() { RegisterType("cart", testCart{}) })
+	assert.NotPanics(t, func() { Register(testCart{}) })
+}
+
+func TestFlash(t *testing.T) {
+	t.Parallel()
+	app := routing.New()
+	app.Use(New())
+	app.Get("/post", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Flash("success", "saved")
+		d.Flash("warning", "slow")
+		return nil
+	})
+	app.Get("/get", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		var msgs []string
+		for _, f := range d.Flashes() {
+			msgs = append(msgs, f.Kind+":"+f.Message)
+		}
+		c.SetBodyString(strings.Join(msgs, ","))
+		return nil
+	})
+	app.Get("/noop", func(c *routing.Ctx) error {
+		return nil
+	})
+	client := app.TestClient()
+	get := func(uri string) string {
+		res, err := client.Get(uri).Do()
+		assert.Nil(t, err)
+		return string(res.Body())
+	}
+
+	get("/post")
+	assert.Equal(t, "success:saved,warning:slow", get("/get"))
+	assert.Equal(t, "", get("/get"))
+
+	// the messages are dropped by the next request even if it does not get them
+	get("/post")
+	get("/noop")
+	assert.Equal(t, "", get("/get"))
+}
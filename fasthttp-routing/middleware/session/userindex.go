@@ -0,0 +1,244 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"time"
+	"unsafe"
+
+	routing "fasthttp-routing"
+	"github.com/bytedance/sonic"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// userIDKey 会话绑定的用户 ID
+	userIDKey = "__userID"
+	// userSinceKey 会话绑定用户的时间（RFC 3339），即 SessionInfo.CreatedAt
+	userSinceKey = "__userSince"
+)
+
+// SessionInfo describes an active session of a user, see Manager.UserSessions.
+type SessionInfo struct {
+	// ID identifies the session without revealing its token, e.g. to revoke it with
+	// Manager.RevokeUserSession.
+	ID string `json:"-"`
+	// Current reports whether the session is the session of the request.
+	Current bool `json:"-"`
+	// CreatedAt is the time when the session has been bound to the user, usually at login.
+	CreatedAt time.Time
+	// LastSeen is the time of the last request using the session.
+	LastSeen time.Time
+	// Expiry is the expiry of the session after its last request.
+	Expiry time.Time
+	// IP is the client IP of the last request using the session.
+	IP string
+	// UserAgent is the User-Agent of the last request using the session.
+	UserAgent string
+}
+
+// sessionID returns the SessionInfo.ID of the session stored under token.
+func sessionID(token string) string {
+	sum := sha256.Sum256(unsafe.Slice(unsafe.StringData(token), len(token)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// BindUser binds the session to userID, so that it is listed by Manager.UserSessions and revoked
+// by Manager.RevokeUserSessions, when the store implements UserIndexStore. Renew the token
+// before binding the session on login. The session data status will be set to Modified.
+func (d *Data) BindUser(userID string) {
+	if d.GetString(userIDKey) == userID {
+		return
+	}
+	d.Put(userIDKey, userID)
+	d.Put(userSinceKey, time.Now().Format(time.RFC3339Nano))
+}
+
+// UnbindUser removes the session from the sessions of its user, e.g. on logout when the session
+// is not destroyed.
+func (d *Data) UnbindUser() {
+	d.Remove(userIDKey)
+	d.Remove(userSinceKey)
+}
+
+// UserID returns the user the session is bound to, or "" if the session is not bound.
+func (d *Data) UserID() string {
+	return d.GetString(userIDKey)
+}
+
+// BindUser binds the session to userID, see Data.BindUser.
+func (s *Manager) BindUser(c *routing.Ctx, userID string) {
+	sd := s.sessionDataFromCxt(c)
+	sd.BindUser(userID)
+}
+
+// UserSessions returns the active sessions of userID, the most recently used first. c may be
+// nil, otherwise the session of c is marked as Current. It returns ErrUserIndexNotSupported when
+// the store does not implement UserIndexStore.
+func (s *Manager) UserSessions(ctx context.Context, c *routing.Ctx, userID string) (sessions []SessionInfo, err error) {
+	all, err := s.doUserIndexAll(ctx, userID)
+	if err != nil {
+		return
+	}
+	current := s.currentSessionKey(c)
+	sessions = make([]SessionInfo, 0, len(all))
+	for token, b := range all {
+		var info SessionInfo
+		if err := sonic.Unmarshal(b, &info); err != nil {
+			log.Warn().Str("Err", err.Error()).Str("userID", userID).Msg("decode user session info occur error")
+			continue
+		}
+		info.ID = sessionID(token)
+		info.Current = token == current
+		sessions = append(sessions, info)
+	}
+	slices.SortFunc(sessions, func(a, b SessionInfo) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return
+}
+
+// RevokeUserSession deletes the session id of userID, as given by SessionInfo.ID, from the store.
+// Revoking a session which does not exist anymore is a no-op. c may be nil, otherwise the
+// session of c is destroyed when it is the revoked session.
+func (s *Manager) RevokeUserSession(ctx context.Context, c *routing.Ctx, userID string, id string) error {
+	all, err := s.doUserIndexAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for token := range all {
+		if sessionID(token) == id {
+			return s.revoke(ctx, c, userID, token)
+		}
+	}
+	return nil
+}
+
+// RevokeUserSessions deletes all the sessions of userID from the store, e.g. to log the user out
+// everywhere. c may be nil, otherwise the session of c is destroyed too, unless keepCurrent.
+func (s *Manager) RevokeUserSessions(ctx context.Context, c *routing.Ctx, userID string, keepCurrent bool) error {
+	all, err := s.doUserIndexAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+	current := s.currentSessionKey(c)
+	for token := range all {
+		if keepCurrent && token == current {
+			continue
+		}
+		if err = s.revoke(ctx, c, userID, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revoke deletes the session stored under token, and its entry in the index of userID.
+func (s *Manager) revoke(ctx context.Context, c *routing.Ctx, userID string, token string) (err error) {
+	if token == s.currentSessionKey(c) {
+		// the session of the request would be committed again otherwise
+		return s.Destroy(ctx, c)
+	}
+	if cs, ok := s.Store.(CtxStore); ok && ctx != nil {
+		err = cs.DeleteCtx(ctx, []byte(token))
+	} else {
+		err = s.Store.Delete([]byte(token))
+	}
+	if err != nil {
+		err = NewStoreError("revoke user session:" + err.Error())
+		log.Warn().Str("Err", err.Error()).Str("userID", userID).Msg("revoke user session occur error")
+		return
+	}
+	return s.doUserIndexDelete(ctx, userID, []byte(token))
+}
+
+// currentSessionKey returns the store key of the session of c, or "" if c has no session.
+func (s *Manager) currentSessionKey(c *routing.Ctx) string {
+	if c == nil {
+		return ""
+	}
+	data, ok := c.UserValue(ContextKey).(*Data)
+	if !ok || len(data.token) == 0 {
+		return ""
+	}
+	return sessionPrefix + string(data.token)
+}
+
+// commitUserIndex updates the index of the sessions by user once data has been committed.
+func (s *Manager) commitUserIndex(ctx context.Context, c *routing.Ctx, data *Data) (err error) {
+	userID := data.UserID()
+	if data.userID != "" && data.userID != userID {
+		if err = s.doUserIndexDelete(ctx, data.userID, storeKey(data.token)); err != nil {
+			return
+		}
+	}
+	data.userID = userID
+	store, ok := s.Store.(UserIndexStore)
+	if userID == "" || !ok {
+		return
+	}
+	info := SessionInfo{LastSeen: time.Now(), Expiry: data.expiry()}
+	info.CreatedAt, _ = time.Parse(time.RFC3339Nano, data.GetString(userSinceKey))
+	if c != nil {
+		info.IP = string(c.IP())
+		info.UserAgent = string(c.UserAgent())
+	}
+	b, err := sonic.Marshal(&info)
+	if err != nil {
+		return NewEncodingError(err.Error())
+	}
+	err = store.CommitUserSession(contextOrBackground(ctx), userID, storeKey(data.token), b, info.Expiry)
+	if errors.Is(err, ErrUserIndexNotSupported) {
+		return nil
+	}
+	if err != nil {
+		err = NewStoreError("commit user session:" + err.Error())
+		log.Error().Str("Err", err.Error()).Str("userID", userID).Msg("commit user session occur error")
+	}
+	return
+}
+
+// doUserIndexDelete removes the session stored under token from the index of userID.
+func (s *Manager) doUserIndexDelete(ctx context.Context, userID string, token []byte) (err error) {
+	store, ok := s.Store.(UserIndexStore)
+	if !ok {
+		return nil
+	}
+	err = store.DeleteUserSession(contextOrBackground(ctx), userID, token)
+	if errors.Is(err, ErrUserIndexNotSupported) {
+		return nil
+	}
+	if err != nil {
+		err = NewStoreError("delete user session:" + err.Error())
+		log.Warn().Str("Err", err.Error()).Str("userID", userID).Msg("delete user session occur error")
+	}
+	return
+}
+
+func (s *Manager) doUserIndexAll(ctx context.Context, userID string) (all map[string][]byte, err error) {
+	store, ok := s.Store.(UserIndexStore)
+	if !ok {
+		return nil, ErrUserIndexNotSupported
+	}
+	all, err = store.UserSessions(contextOrBackground(ctx), userID)
+	if err != nil && !errors.Is(err, ErrUserIndexNotSupported) {
+		err = NewStoreError("user sessions:" + err.Error())
+		log.Warn().Str("Err", err.Error()).Str("userID", userID).Msg("list user sessions occur error")
+	}
+	return
+}
+
+// storeKey returns the store key of Data.token, which is preceded by the key prefix in its buffer.
+func storeKey(token []byte) []byte {
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(unsafe.SliceData(token)), -len(sessionPrefix))), UrlEncodedTokenWithPrefixLen)
+}
+
+func contextOrBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	routing "fasthttp-routing"
+	"github.com/stretchr/testify/assert"
+	"helpers/utilcrypt"
+)
+
+func TestUserIndex(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewMemoryStoreWithCleanup(0)
+	app := routing.New()
+	app.Use(New(&cfg))
+	app.Get("/login", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		d.Migrate(true)
+		d.BindUser(string(c.QueryArgs().Peek("user")))
+		return nil
+	})
+	app.Get("/user", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		c.SetBodyString(d.UserID())
+		return nil
+	})
+	app.Get("/sessions", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		sessions, err := d.Manager().UserSessions(c.Context(), c, d.UserID())
+		if err != nil {
+			return err
+		}
+		body := strconv.Itoa(len(sessions))
+		for _, s := range sessions {
+			body += "|" + strconv.FormatBool(s.Current)
+		}
+		c.SetBodyString(body)
+		return nil
+	})
+	app.Get("/logout-others", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		return d.Manager().RevokeUserSessions(c.Context(), c, d.UserID(), true)
+	})
+	app.Get("/logout", func(c *routing.Ctx) error {
+		d, _ := c.UserValue(ContextKey).(*Data)
+		return d.Manager().Destroy(c.Context(), c)
+	})
+	get := func(client *routing.TestClient, uri string) string {
+		res, err := client.Get(uri).Do()
+		assert.Nil(t, err)
+		return string(res.Body())
+	}
+
+	laptop, phone, tablet := app.TestClient(), app.TestClient(), app.TestClient()
+	get(laptop, "/login?user=alice")
+	get(phone, "/login?user=alice")
+	get(tablet, "/login?user=bob")
+	assert.Equal(t, "alice", get(phone, "/user"))
+	// the most recently used session first, the current request is not committed yet
+	assert.Equal(t, "2|false|true", get(laptop, "/sessions"))
+
+	sessions, err := cfg.manager.UserSessions(context.Background(), nil, "alice")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 2)
+	for _, s := range sessions {
+		assert.False(t, s.Current)
+		assert.False(t, s.CreatedAt.IsZero())
+		assert.False(t, s.LastSeen.Before(s.CreatedAt))
+		assert.Equal(t, "0.0.0.0", s.IP)
+		assert.NotEmpty(t, s.ID)
+		assert.NotContains(t, s.ID, "scs:session:")
+	}
+
+	// logging in again renews the token and replaces the entry of the old session
+	get(phone, "/login?user=alice")
+	assert.Equal(t, "2|true|false", get(phone, "/sessions"))
+
+	assert.Equal(t, "", get(phone, "/logout-others"))
+	assert.Equal(t, "", get(laptop, "/user"))
+	assert.Equal(t, "1|true", get(phone, "/sessions"))
+	assert.Equal(t, "bob", get(tablet, "/user"))
+
+	// revoking one session of bob from an admin request
+	sessions, _ = cfg.manager.UserSessions(context.Background(), nil, "bob")
+	assert.Len(t, sessions, 1)
+	assert.Nil(t, cfg.manager.RevokeUserSession(context.Background(), nil, "bob", sessions[0].ID))
+	assert.Equal(t, "", get(tablet, "/user"))
+
+	get(phone, "/logout")
+	sessions, _ = cfg.manager.UserSessions(context.Background(), nil, "alice")
+	assert.Empty(t, sessions)
+}
+
+func TestUserIndexNotSupported(t *testing.T) {
+	t.Parallel()
+	cfg := DefCfg
+	cfg.Store = NewCookieStore(make([]byte, 32))
+	cfg.AppendHash = utilcrypt.NewHMACHash(make([]byte, utilcrypt.MinHMACKeyLen))
+	New(&cfg)
+	_, err := cfg.manager.UserSessions(context.Background(), nil, "alice")
+	assert.ErrorIs(t, err, ErrUserIndexNotSupported)
+}
@@ -0,0 +1,137 @@
+// Package timeout provides a middleware bounding the time spent by the handlers of a request.
+//
+//	router.Use(timeout.New(&timeout.Config{Timeout: 5 * time.Second}))
+//	// a longer deadline for a single route
+//	router.Post("/export", export).Meta(timeout.TimeoutKey, time.Minute)
+//
+// The rest of the handler chain runs in its own goroutine with a context bound to the deadline,
+// see routing.Ctx.Context, which handlers should pass to session stores and outbound clients.
+// When the deadline passes, the timeout response is sent right away and the response written
+// by the handlers later on is dropped.
+//
+// Middlewares registered before the timeout middleware run after Next returns while the late
+// handlers may still be running, so they must check routing.Ctx.TimedOut before touching the response.
+package timeout
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/recovery"
+	"github.com/newacorn/fasthttp"
+)
+
+// TimeoutKey is the route metadata key overriding Config.Timeout for a route, with a time.Duration
+// value. A value not greater than 0 disables the timeout of the route.
+const TimeoutKey = "timeout.timeout"
+
+type Config struct {
+	// Timeout 处理请求的最长时间，为 0 时使用 DefCfg.Timeout；可以通过路由元数据 TimeoutKey 为单个路由覆盖
+	Timeout time.Duration
+	// StatusCode 超时响应的状态码，默认为 503，网关类的服务可以使用 504
+	StatusCode int
+	// Body 超时响应的内容，默认为状态码对应的描述
+	Body string
+	// ContentType 超时响应的内容类型，默认为 text/plain; charset=utf-8
+	ContentType string
+}
+
+var DefCfg = Config{
+	Timeout:     10 * time.Second,
+	StatusCode:  routing.StatusServiceUnavailable,
+	ContentType: routing.MIMETextPlainCharsetUTF8,
+}
+
+type result struct {
+	err error
+	// p 非nil时为处理器goroutine中的panic，附带该goroutine的调用栈
+	p *recovery.PanicError
+}
+
+// unwrap returns the error of the handlers, or re-raises their panic.
+func (r result) unwrap() error {
+	if r.p != nil {
+		panic(r.p)
+	}
+	return r.err
+}
+
+// New creates a middleware sending the timeout response when the handlers do not finish in time.
+// Panics of the handlers finishing in time are re-raised as a *recovery.PanicError carrying the stack
+// of the handlers' goroutine, so that the recovery middleware handles and logs them.
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefCfg.Timeout
+	}
+	status := cfg.StatusCode
+	if status == 0 {
+		status = DefCfg.StatusCode
+	}
+	body := cfg.Body
+	if body == "" {
+		body = routing.StatusMessage(status)
+	}
+	contentType := cfg.ContentType
+	if contentType == "" {
+		contentType = DefCfg.ContentType
+	}
+	return func(c *routing.Ctx) error {
+		d := timeout
+		if v, ok := c.Meta(TimeoutKey).(time.Duration); ok {
+			d = v
+		}
+		if d <= 0 {
+			return c.Next()
+		}
+		ctx, cancel := context.WithTimeout(c.Context(), d)
+		defer cancel()
+		c.SetContext(ctx)
+		logger := c.Log()
+
+		done := make(chan result, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					done <- result{p: &recovery.PanicError{Value: p, Stack: debug.Stack()}}
+				}
+			}()
+			done <- result{err: c.Next()}
+		}()
+		select {
+		case r := <-done:
+			return r.unwrap()
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				// cancelled by the shutdown of the server, the handlers are expected to return soon
+				return (<-done).unwrap()
+			}
+		}
+
+		resp := fasthttp.AcquireResponse()
+		resp.SetStatusCode(status)
+		resp.Header.SetContentType(contentType)
+		resp.SetBodyString(body)
+		c.TimeoutErrorWithResponse(resp)
+		fasthttp.ReleaseResponse(resp)
+		logger.Warn().Dur("timeout", d).Msg("timeout: handlers did not finish in time")
+		go func() {
+			r := <-done
+			if r.p != nil {
+				logger.Error().Interface("panic", r.p.Value).Bytes("stack", r.p.Stack).
+					Msg("timeout: late handler panicked")
+			} else if r.err != nil {
+				logger.Warn().Err(r.err).Msg("timeout: late handler failed")
+			}
+		}()
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package timeout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/recovery"
+	"fasthttp-routing/routingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	router := routing.New()
+	var outerStatus int
+	var outerTimedOut bool
+	late := make(chan error, 1)
+	router.Use(func(c *routing.Ctx) error {
+		err := c.Next()
+		outerTimedOut = c.TimedOut()
+		outerStatus = c.FinalResponse().StatusCode()
+		return err
+	}, New(&Config{Timeout: 50 * time.Millisecond, Body: "too slow"}))
+	router.Get("/slow", func(c *routing.Ctx) error {
+		ctx := c.Context()
+		<-ctx.Done()
+		late <- ctx.Err()
+		// the response has been sent, the late writes must be dropped
+		c.SetStatusCode(routing.StatusOK)
+		_, err := c.WriteString("late")
+		return err
+	})
+	router.Get("/fast", func(c *routing.Ctx) error {
+		_, ok := c.Context().Deadline()
+		assert.True(t, ok)
+		_, err := c.WriteString("fast")
+		return err
+	})
+	router.Get("/fail", func(c *routing.Ctx) error {
+		return routing.ErrForbidden
+	})
+	router.Get("/export", func(c *routing.Ctx) error {
+		_, ok := c.Context().Deadline()
+		assert.False(t, ok)
+		time.Sleep(100 * time.Millisecond)
+		_, err := c.WriteString("exported")
+		return err
+	}).Meta(TimeoutKey, time.Duration(0))
+	client := router.TestClient()
+
+	res, err := client.Get("/slow").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusServiceUnavailable).
+		Header(routing.HeaderContentType, routing.MIMETextPlainCharsetUTF8).
+		Body("too slow")
+	assert.True(t, outerTimedOut)
+	assert.Equal(t, routing.StatusServiceUnavailable, outerStatus)
+	assert.Equal(t, context.DeadlineExceeded, <-late)
+
+	res, _ = client.Get("/fast").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK).Body("fast")
+	assert.False(t, outerTimedOut)
+	res, _ = client.Get("/fail").Do()
+	routingtest.Expect(t, res).Status(routing.StatusForbidden)
+	res, _ = client.Get("/export").Do()
+	routingtest.Expect(t, res).Status(routing.StatusOK).Body("exported")
+}
+
+func TestTimeoutConfig(t *testing.T) {
+	router := routing.New()
+	router.Use(recovery.New(&recovery.Config{DisableStack: true}),
+		New(&Config{Timeout: 20 * time.Millisecond, StatusCode: routing.StatusGatewayTimeout}))
+	router.Get("/panic", func(c *routing.Ctx) error {
+		panic("boom")
+	})
+	router.Get("/slow", func(c *routing.Ctx) error {
+		time.Sleep(100 * time.Millisecond)
+		panic("late")
+	}).Meta(TimeoutKey, 10*time.Millisecond)
+	client := router.TestClient()
+
+	// panics of the handlers finishing in time reach the recovery middleware
+	res, err := client.Get("/panic").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusInternalServerError)
+	res, _ = client.Get("/slow").Do()
+	routingtest.Expect(t, res).Status(routing.StatusGatewayTimeout).Body("Gateway Timeout")
+	// the late panic is logged, not raised
+	time.Sleep(150 * time.Millisecond)
+
+	// the recovery middleware gets the stack of the handler which panicked
+	var recovered *recovery.PanicError
+	router = routing.New()
+	router.Use(recovery.New(&recovery.Config{Handler: func(c *routing.Ctx, err *recovery.PanicError) {
+		recovered = err
+	}}), New())
+	router.Get("/panic", panicHandler)
+	res, _ = router.TestClient().Get("/panic").Do()
+	routingtest.Expect(t, res).Status(routing.StatusInternalServerError)
+	if assert.NotNil(t, recovered) {
+		assert.Equal(t, "boom", recovered.Value)
+		assert.Contains(t, string(recovered.Stack), "timeout.panicHandler")
+	}
+}
+
+func panicHandler(c *routing.Ctx) error {
+	panic("boom")
+}
@@ -0,0 +1,96 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SpanKind is the kind of a span, with the values of the OTLP SpanKind enum.
+type SpanKind int
+
+const (
+	SpanKindServer SpanKind = 2
+	SpanKindClient SpanKind = 3
+)
+
+// StatusCode is the status of a span, with the values of the OTLP Status.StatusCode enum.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Span is a finished span, with the fields of an OTLP span.
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	// Attributes 使用 OpenTelemetry 语义约定的属性名，例如 http.request.method
+	Attributes    map[string]any
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Exporter receives the finished sampled spans, e.g. to send them to an OTLP collector.
+// Its methods have the shape of the OpenTelemetry SpanExporter, so that an adapter is a thin wrapper.
+//
+// ExportSpans is called synchronously when a span ends, exporters sending spans over the network
+// should queue them and return immediately.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// MemoryExporter keeps the exported spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (m *MemoryExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func (m *MemoryExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (m *MemoryExporter) Spans() []*Span {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Span(nil), m.spans...)
+}
+
+// Reset drops the exported spans.
+func (m *MemoryExporter) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = nil
+}
+
+// export sends s to exporter if the span is sampled.
+// A failing exporter must not fail the request, its errors are only logged.
+func export(exporter Exporter, s *Span) {
+	if exporter == nil || !s.SpanContext.Sampled() {
+		return
+	}
+	if err := exporter.ExportSpans(context.Background(), []*Span{s}); err != nil {
+		log.Error().Err(err).Msg("trace: export spans")
+	}
+}
@@ -0,0 +1,277 @@
+// Package trace provides request IDs and W3C trace context propagation,
+// see https://www.w3.org/TR/trace-context/.
+//
+// The middleware reads the X-Request-ID header or generates a request ID, and continues the
+// trace of the traceparent header or starts a new one. Both are available from the Ctx, which
+// is a context.Context, and from the context returned by Context, which outlives the request:
+//
+//	router.Use(accesslog.New(), trace.New())
+//	client := &trace.Client{Client: &fasthttp.Client{}}
+//
+//	router.Post("/wx", func(c *routing.Ctx) error {
+//		// the outbound request carries the request ID and continues the trace
+//		return client.Do(c, req, resp)
+//	})
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	routing "fasthttp-routing"
+	"github.com/newacorn/fasthttp"
+)
+
+type Config struct {
+	// RequestIDHeader 请求ID所在的请求/响应头部，默认为 X-Request-ID
+	RequestIDHeader string
+	// RequestIDGenerator 请求未携带合法请求ID时用于生成请求ID，默认生成 32 位十六进制随机串
+	RequestIDGenerator func() string
+	// Sampler 决定新建的追踪是否采样，为 nil 时全部采样；延续的追踪沿用上游的采样标志
+	Sampler func(c *routing.Ctx) bool
+	// Exporter 不为 nil 时导出采样的服务端 span
+	Exporter Exporter
+	// SpanName 服务端 span 的名称，默认为请求方法加路由路径，例如 "GET /users/<id>"
+	SpanName func(c *routing.Ctx) string
+}
+
+var DefCfg = Config{
+	RequestIDHeader: routing.HeaderXRequestID,
+}
+
+// New creates a middleware that assigns a request ID and a span context to the request.
+// The request ID is echoed in the response header, and the request ID and trace ID are added
+// to the logger of the request, see routing.Ctx.Log.
+// Routes which need neither, like health checks, are left out by registering the middleware with
+// RouteGroup.UseExcept, e.g. router.UseExcept(routing.HasMeta("trace", false), trace.New()).
+func New(cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	header := cfg.RequestIDHeader
+	if header == "" {
+		header = DefCfg.RequestIDHeader
+	}
+	return func(c *routing.Ctx) error {
+		id := string(c.Request.Header.Peek(header))
+		if !validRequestID(id) {
+			if cfg.RequestIDGenerator != nil {
+				id = cfg.RequestIDGenerator()
+			} else {
+				id = newTraceID().String()
+			}
+		}
+		c.Response.Header.Set(header, id)
+
+		sc := SpanContext{SpanID: newSpanID()}
+		parent, err := ParseTraceparent(string(c.Request.Header.Peek(routing.HeaderTraceparent)))
+		if err == nil {
+			sc.TraceID = parent.TraceID
+			sc.Flags = parent.Flags
+			sc.TraceState = strings.Join(peekAll(&c.Request.Header, routing.HeaderTracestate), ",")
+		} else {
+			sc.TraceID = newTraceID()
+			if cfg.Sampler == nil || cfg.Sampler(c) {
+				sc.Flags = FlagSampled
+			}
+		}
+		c.SetUserValue(spanContextKey{}, sc)
+		c.SetUserValue(requestIDKey{}, id)
+		l := c.Log().With().Str("request_id", id).Str("trace_id", sc.TraceID.String()).Logger()
+		c.SetLog(&l)
+
+		start := time.Now()
+		err = c.Next()
+		if cfg.Exporter == nil || !sc.Sampled() {
+			return err
+		}
+		s := &Span{
+			Kind:         SpanKindServer,
+			SpanContext:  sc,
+			ParentSpanID: parent.SpanID,
+			Start:        start,
+			End:          time.Now(),
+			Attributes: map[string]any{
+				"http.request.method": string(c.Method()),
+				"url.path":            string(c.Path()),
+				"request.id":          id,
+			},
+		}
+		if route := c.Route(); route != nil {
+			s.Attributes["http.route"] = route.Path()
+		}
+		if cfg.SpanName != nil {
+			s.Name = cfg.SpanName(c)
+		} else if route := c.Route(); route != nil {
+			s.Name = string(c.Method()) + " " + route.Path()
+		} else {
+			s.Name = string(c.Method())
+		}
+		status := c.FinalResponse().StatusCode()
+		if err != nil && !c.TimedOut() {
+			status = http.StatusInternalServerError
+			var he routing.HTTPError
+			if errors.As(err, &he) {
+				status = he.StatusCode()
+			}
+			s.StatusMessage = err.Error()
+		}
+		s.Attributes["http.response.status_code"] = status
+		if status >= 500 {
+			s.Status = StatusError
+		}
+		export(cfg.Exporter, s)
+		return err
+	}
+}
+
+// Context returns a context carrying the span context and the request ID of the request.
+// Unlike the Ctx, which must not be used after the handler returns, the context may be passed
+// to goroutines outliving the request.
+func Context(c *routing.Ctx) context.Context {
+	ctx := context.Background()
+	if sc, ok := SpanContextFromContext(c); ok {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	if id := RequestIDFromContext(c); id != "" {
+		ctx = ContextWithRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// RequestID returns the request ID assigned by the middleware, empty if it did not handle the request.
+func RequestID(c *routing.Ctx) string {
+	return RequestIDFromContext(c)
+}
+
+// validRequestID accepts at most 128 visible ASCII characters, so that a request ID from the
+// client can be logged and echoed safely.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func peekAll(h *fasthttp.RequestHeader, key string) []string {
+	values := h.PeekAll(key)
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = string(v)
+	}
+	return s
+}
+
+// Doer sends HTTP requests, it is implemented by *fasthttp.Client and *fasthttp.HostClient.
+type Doer interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+}
+
+// Client sends requests with the trace context and the request ID of ctx, and records
+// a client span for each request of a sampled trace.
+type Client struct {
+	// Client 实际发送请求的客户端
+	Client Doer
+	// Exporter 不为 nil 时导出采样的客户端 span
+	Exporter Exporter
+	// RequestIDHeader 默认为 X-Request-ID
+	RequestIDHeader string
+}
+
+// deadlineDoer is implemented by *fasthttp.Client and *fasthttp.HostClient.
+type deadlineDoer interface {
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
+// Do sends req with the headers of Inject and waits for the response. The request is bounded by the
+// deadline of ctx when the client supports deadlines, e.g. with the routing.Ctx.Context of a request
+// handled by the timeout middleware, which also carries the span context and the request ID.
+func (c *Client) Do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	parent, ok := SpanContextFromContext(ctx)
+	if !ok || !parent.IsValid() {
+		InjectRequestID(ctx, req, c.RequestIDHeader)
+		return c.do(ctx, req, resp)
+	}
+	sc := parent
+	sc.SpanID = newSpanID()
+	ctx = ContextWithSpanContext(ctx, sc)
+	Inject(ctx, req)
+	InjectRequestID(ctx, req, c.RequestIDHeader)
+
+	start := time.Now()
+	err := c.do(ctx, req, resp)
+	if c.Exporter == nil || !sc.Sampled() {
+		return err
+	}
+	s := &Span{
+		Name:         string(req.Header.Method()),
+		Kind:         SpanKindClient,
+		SpanContext:  sc,
+		ParentSpanID: parent.SpanID,
+		Start:        start,
+		End:          time.Now(),
+		Attributes: map[string]any{
+			"http.request.method": string(req.Header.Method()),
+			"url.full":            req.URI().String(),
+		},
+	}
+	if err != nil {
+		s.Status = StatusError
+		s.StatusMessage = err.Error()
+	} else {
+		s.Attributes["http.response.status_code"] = resp.StatusCode()
+		if resp.StatusCode() >= 400 {
+			s.Status = StatusError
+		}
+	}
+	export(c.Exporter, s)
+	return err
+}
+
+func (c *Client) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if d, ok := c.Client.(deadlineDoer); ok {
+			return d.DoDeadline(req, resp, deadline)
+		}
+	}
+	return c.Client.Do(req, resp)
+}
+
+// Inject sets the traceparent and tracestate headers of req from the span context of ctx.
+func Inject(ctx context.Context, req *fasthttp.Request) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+	req.Header.Set(routing.HeaderTraceparent, sc.Traceparent())
+	if sc.TraceState != "" {
+		req.Header.Set(routing.HeaderTracestate, sc.TraceState)
+	} else {
+		req.Header.Del(routing.HeaderTracestate)
+	}
+}
+
+// InjectRequestID sets the request ID header of req from the request ID of ctx, if any.
+// header defaults to X-Request-ID.
+func InjectRequestID(ctx context.Context, req *fasthttp.Request, header string) {
+	if header == "" {
+		header = DefCfg.RequestIDHeader
+	}
+	if id := RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(header, id)
+	}
+}
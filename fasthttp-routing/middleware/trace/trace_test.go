@@ -0,0 +1,160 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/accesslog"
+	"fasthttp-routing/routingtest"
+	"github.com/newacorn/fasthttp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	// later versions may append fields
+	sc, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.Nil(t, err)
+	assert.False(t, sc.Sampled())
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01",
+	} {
+		_, err = ParseTraceparent(s)
+		assert.Equal(t, errInvalidTraceparent, err, s)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	exporter := NewMemoryExporter()
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf)
+
+	// the downstream service echoes the propagated headers
+	downstream := routing.New()
+	downstream.Get("/echo", func(c *routing.Ctx) error {
+		_, err := c.WriteString(string(c.Request.Header.Peek(routing.HeaderTraceparent)) + " " +
+			string(c.Request.Header.Peek(routing.HeaderTracestate)) + " " +
+			string(c.Request.Header.Peek(routing.HeaderXRequestID)))
+		return err
+	})
+	client := &Client{Client: doerFunc(func(req *fasthttp.Request, resp *fasthttp.Response) error {
+		res, err := downstream.TestClient().Request("GET", "/echo").
+			Header(routing.HeaderTraceparent, string(req.Header.Peek(routing.HeaderTraceparent))).
+			Header(routing.HeaderTracestate, string(req.Header.Peek(routing.HeaderTracestate))).
+			Header(routing.HeaderXRequestID, string(req.Header.Peek(routing.HeaderXRequestID))).Do()
+		if err == nil {
+			res.CopyTo(resp)
+		}
+		return err
+	}), Exporter: exporter}
+
+	router := routing.New()
+	router.App.Log = &logger
+	router.Use(accesslog.New(), New(&Config{Exporter: exporter}))
+	router.Get("/users/<id>", func(c *routing.Ctx) error {
+		c.Log().Info().Msg("calling")
+		req := fasthttp.AcquireRequest()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI("http://downstream/echo")
+		if err := client.Do(Context(c), req, resp); err != nil {
+			return err
+		}
+		_, err := c.Write(resp.Body())
+		return err
+	})
+
+	res, err := router.TestClient().Get("/users/1").
+		Header(routing.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").
+		Header(routing.HeaderTracestate, "congo=t61rcWkgMzE").
+		Header(routing.HeaderXRequestID, "req-1").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusOK).Header(routing.HeaderXRequestID, "req-1")
+	parts := strings.Split(string(res.Body()), " ")
+	outbound, err := ParseTraceparent(parts[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", outbound.TraceID.String())
+	assert.Equal(t, "congo=t61rcWkgMzE", parts[1])
+	assert.Equal(t, "req-1", parts[2])
+
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 2) {
+		clientSpan, serverSpan := spans[0], spans[1]
+		assert.Equal(t, SpanKindClient, clientSpan.Kind)
+		assert.Equal(t, outbound.SpanID, clientSpan.SpanContext.SpanID)
+		assert.Equal(t, serverSpan.SpanContext.SpanID, clientSpan.ParentSpanID)
+		assert.Equal(t, SpanKindServer, serverSpan.Kind)
+		assert.Equal(t, "GET /users/<id>", serverSpan.Name)
+		assert.Equal(t, "00f067aa0ba902b7", serverSpan.ParentSpanID.String())
+		assert.Equal(t, 200, serverSpan.Attributes["http.response.status_code"])
+	}
+
+	var line map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(strings.SplitN(buf.String(), "\n", 2)[0]), &line))
+	assert.Equal(t, "calling", line["message"])
+	assert.Equal(t, "req-1", line["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line["trace_id"])
+}
+
+func TestTraceNewTrace(t *testing.T) {
+	exporter := NewMemoryExporter()
+	router := routing.New()
+	router.Use(New(&Config{
+		Exporter: exporter,
+		Sampler: func(c *routing.Ctx) bool {
+			return c.QueryArgs().Has("sample")
+		},
+	}))
+	var sc SpanContext
+	router.Get("/", func(c *routing.Ctx) error {
+		sc, _ = SpanContextFromContext(c)
+		assert.Equal(t, string(c.Response.Header.Peek(routing.HeaderXRequestID)), RequestID(c))
+		return nil
+	})
+	router.Get("/fail", func(c *routing.Ctx) error {
+		return routing.ErrBadRequest
+	})
+	client := router.TestClient()
+
+	// an invalid request ID and an invalid traceparent are replaced
+	res, _ := client.Get("/").Header(routing.HeaderXRequestID, "bad id").
+		Header(routing.HeaderTraceparent, "00-bad").Do()
+	id := string(res.Header.Peek(routing.HeaderXRequestID))
+	assert.Len(t, id, 32)
+	assert.True(t, sc.IsValid())
+	assert.False(t, sc.Sampled())
+	assert.Empty(t, exporter.Spans(), "not sampled")
+
+	res, _ = client.Get("/fail?sample").Do()
+	routingtest.Expect(t, res).Status(routing.StatusBadRequest)
+	spans := exporter.Spans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, 400, spans[0].Attributes["http.response.status_code"])
+		assert.Equal(t, "Bad Request", spans[0].StatusMessage)
+		assert.False(t, spans[0].ParentSpanID.IsValid())
+	}
+}
+
+type doerFunc func(req *fasthttp.Request, resp *fasthttp.Response) error
+
+func (f doerFunc) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return f(req, resp)
+}
@@ -0,0 +1,140 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// TraceID identifies a trace, see https://www.w3.org/TR/trace-context/#trace-id.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace, see https://www.w3.org/TR/trace-context/#parent-id.
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether t is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether s is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// FlagSampled is the trace flag set when the caller may have recorded the trace.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Flags 追踪标志，目前只定义了 FlagSampled
+	Flags byte
+	// TraceState 原样传递的 tracestate 头部
+	TraceState string
+}
+
+// IsValid reports whether both the trace ID and the span ID are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled reports whether FlagSampled is set.
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats sc as the value of a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	var b [55]byte
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:], []byte{sc.Flags})
+	return string(b[:])
+}
+
+var errInvalidTraceparent = errors.New("trace: invalid traceparent")
+
+// ParseTraceparent parses the value of a traceparent header.
+// Versions later than 00 are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(s string) (sc SpanContext, err error) {
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, errInvalidTraceparent
+	}
+	var version [1]byte
+	if !decodeHex(version[:], s[:2]) || version[0] == 0xff ||
+		(version[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return sc, errInvalidTraceparent
+	}
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:], s[3:35]) || !decodeHex(sc.SpanID[:], s[36:52]) || !decodeHex(flags[:], s[53:55]) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex only, as required by the specification.
+func decodeHex(dst []byte, s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func newTraceID() (id TraceID) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	_, _ = rand.Read(id[:])
+	return
+}
+
+type spanContextKey struct{}
+
+type requestIDKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, which may be a *routing.Ctx
+// handled by the middleware or a context returned by Context.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, empty if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
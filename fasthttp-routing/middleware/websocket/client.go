@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+
+	routing "fasthttp-routing"
+	"github.com/newacorn/fasthttp"
+)
+
+// ErrBadHandshake is returned by Client when the server does not accept the upgrade.
+// The status code is carried by the returned *fasthttp.Response.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+type ClientConfig struct {
+	// Header 握手请求附加的头部
+	Header map[string]string
+	// Subprotocols 客户端请求的子协议
+	Subprotocols []string
+	// EnableCompression 请求 permessage-deflate
+	EnableCompression bool
+	// ReadLimit 单条消息的最大字节数，默认与 DefCfg 相同
+	ReadLimit int64
+}
+
+// Client performs the opening handshake over conn, which is usually dialed by the caller,
+// e.g. from fasthttputil.InmemoryListener.Dial in tests. uri is the request uri, such as
+// "http://example.com/ws/room1". The handshake response is returned as well, and is the only
+// result besides the error when the server does not switch protocols.
+func Client(conn net.Conn, uri string, cfg *ClientConfig) (*Conn, *fasthttp.Response, error) {
+	if cfg == nil {
+		cfg = &ClientConfig{}
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(uri)
+	req.Header.SetMethod(routing.MethodGet)
+	for k, v := range cfg.Header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(routing.HeaderUpgrade, "websocket")
+	req.Header.Set(routing.HeaderConnection, "Upgrade")
+	req.Header.Set(routing.HeaderSecWebSocketVersion, "13")
+	req.Header.Set(routing.HeaderSecWebSocketKey, key)
+	if len(cfg.Subprotocols) > 0 {
+		req.Header.Set(routing.HeaderSecWebSocketProtocol, strings.Join(cfg.Subprotocols, ", "))
+	}
+	if cfg.EnableCompression {
+		req.Header.Set(routing.HeaderSecWebSocketExtensions, "permessage-deflate; client_no_context_takeover; server_no_context_takeover")
+	}
+	if _, err := req.WriteTo(conn); err != nil {
+		return nil, nil, err
+	}
+
+	c := &Conn{readLimit: cfg.ReadLimit}
+	c.br = bufio.NewReaderSize(conn, DefCfg.ReadBufferSize)
+	res := &fasthttp.Response{}
+	res.SkipBody = true
+	if err := res.Read(c.br); err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode() != routing.StatusSwitchingProtocols ||
+		string(res.Header.Peek(routing.HeaderSecWebSocketAccept)) != acceptKey([]byte(key)) {
+		return nil, res, ErrBadHandshake
+	}
+	c.subprotocol = string(res.Header.Peek(routing.HeaderSecWebSocketProtocol))
+	c.compress = offersDeflate(res.Header.Peek(routing.HeaderSecWebSocketExtensions))
+	c.compressLevel = DefCfg.CompressionLevel
+	c.init(conn, 0)
+	return c, res, nil
+}
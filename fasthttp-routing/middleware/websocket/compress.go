@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+
+	"helpers/unsafefn"
+)
+
+// The server never keeps the compression context between messages (RFC 7692, section 7.1.1),
+// so every message is compressed and decompressed independently.
+const deflateResponse = "permessage-deflate; server_no_context_takeover; client_no_context_takeover"
+
+// deflateTail is appended to a message before decompressing it (RFC 7692, section 7.2.2);
+// the trailing empty final block makes the flate reader return io.EOF.
+const deflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+var (
+	// 按压缩级别缓存 flate.Writer，下标为 level - flate.HuffmanOnly
+	flateWriterPools [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+	flateReaderPool  = sync.Pool{New: func() any {
+		return flate.NewReader(nil)
+	}}
+)
+
+// offersDeflate reports whether the Sec-WebSocket-Extensions header offers permessage-deflate.
+// The parameters of the offer are not inspected, the server always answers with no context takeover,
+// which every client has to accept.
+func offersDeflate(header []byte) bool {
+	for _, ext := range strings.Split(unsafefn.BtoS(header), ",") {
+		name, _, _ := strings.Cut(ext, ";")
+		if strings.EqualFold(strings.TrimSpace(name), "permessage-deflate") {
+			return true
+		}
+	}
+	return false
+}
+
+func compress(p []byte, level int) ([]byte, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		level = flate.BestSpeed
+	}
+	var b bytes.Buffer
+	pool := &flateWriterPools[level-flate.HuffmanOnly]
+	w, _ := pool.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(&b, level)
+	} else {
+		w.Reset(&b)
+	}
+	defer pool.Put(w)
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	// strip the empty stored block written by Flush
+	return bytes.TrimSuffix(b.Bytes(), []byte(deflateTail[:4])), nil
+}
+
+func decompress(p []byte, limit int64) ([]byte, error) {
+	r := flateReaderPool.Get().(io.ReadCloser)
+	defer flateReaderPool.Put(r)
+	if err := r.(flate.Resetter).Reset(io.MultiReader(bytes.NewReader(p), strings.NewReader(deflateTail)), nil); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, &CloseError{Code: CloseInvalidFramePayloadData, Text: err.Error()}
+	}
+	if int64(len(b)) > limit {
+		return nil, ErrReadLimit
+	}
+	return b, nil
+}
@@ -0,0 +1,497 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types, the values are the opcodes of RFC 6455, section 5.2.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes defined in RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	maskBit = 0x80
+
+	maxControlPayload = 125
+	maxFrameHeader    = 14
+)
+
+var (
+	// ErrCloseSent is returned when writing to a connection after a close frame has been sent.
+	ErrCloseSent = errors.New("websocket: close sent")
+	// ErrReadLimit is returned by ReadMessage when a message is larger than the read limit.
+	ErrReadLimit = &CloseError{Code: CloseMessageTooBig, Text: "message too big"}
+
+	errInvalidControl = errors.New("websocket: invalid control frame")
+)
+
+// CloseError is returned by ReadMessage when the peer closes the connection, or when the
+// connection is closed because the peer violated the protocol. Code is the close code sent
+// by the peer, or the one sent to the peer in the latter case.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := "websocket: close " + strconv.Itoa(e.Code)
+	if e.Text != "" {
+		s += " " + e.Text
+	}
+	return s
+}
+
+// IsCloseError reports whether err is a *CloseError with one of the codes.
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func protocolError(text string) error {
+	return &CloseError{Code: CloseProtocolError, Text: text}
+}
+
+// Conn is a WebSocket connection.
+// ReadMessage must be called from a single goroutine, while the write methods are safe for concurrent use.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	server bool
+	// 握手时协商的子协议
+	subprotocol string
+	// 是否协商了 permessage-deflate
+	compress      bool
+	compressLevel int
+	readLimit     int64
+	fragmentSize  int
+	// 升级前复制的路由参数和 RequestCtx.UserValue
+	params map[string]string
+	values map[any]any
+
+	// 读取出错后，后续的 ReadMessage 均返回该错误
+	readErr     error
+	header      [8]byte
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+
+	wmu       sync.Mutex
+	wbuf      []byte
+	closeSent bool
+}
+
+func (c *Conn) init(conn net.Conn, bufSize int) {
+	c.conn = conn
+	if c.br == nil {
+		c.br = bufio.NewReaderSize(conn, bufSize)
+	}
+	if c.readLimit <= 0 {
+		c.readLimit = DefCfg.ReadLimit
+	}
+	c.pingHandler = c.defaultPingHandler
+}
+
+// Param returns the named route parameter of the upgrade request.
+func (c *Conn) Param(name string) string {
+	return c.params[name]
+}
+
+// UserValue returns the value stored with RequestCtx.SetUserValue before the upgrade, e.g. by a middleware.
+func (c *Conn) UserValue(key any) any {
+	return c.values[key]
+}
+
+// Subprotocol returns the negotiated subprotocol, empty if none.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from the peer.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetPingHandler sets the handler called with the payload of ping frames received by ReadMessage.
+// The default handler replies with a pong frame carrying the same payload.
+// An error returned by the handler is returned by ReadMessage.
+func (c *Conn) SetPingHandler(h func(data []byte) error) {
+	if h == nil {
+		h = c.defaultPingHandler
+	}
+	c.pingHandler = h
+}
+
+// SetPongHandler sets the handler called with the payload of pong frames received by ReadMessage.
+func (c *Conn) SetPongHandler(h func(data []byte) error) {
+	c.pongHandler = h
+}
+
+func (c *Conn) defaultPingHandler(data []byte) error {
+	err := c.WriteControl(PongMessage, data)
+	if errors.Is(err, ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
+// Close closes the underlying connection without sending a close frame.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ReadMessage reads the next data message, reassembling fragmented messages and decompressing
+// compressed ones. Control frames received in between are processed: pings and pongs are passed
+// to their handlers, and a close frame is answered and returned as a *CloseError.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	var compressed bool
+	for {
+		fin, rsv1, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+		switch op {
+		case PingMessage:
+			if err = c.pingHandler(payload); err != nil {
+				return 0, nil, c.fail(err)
+			}
+			continue
+		case PongMessage:
+			if c.pongHandler != nil {
+				if err = c.pongHandler(payload); err != nil {
+					return 0, nil, c.fail(err)
+				}
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, c.fail(c.handleClose(payload))
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(protocolError("continuation frame expected"))
+			}
+			if rsv1 && !c.compress {
+				return 0, nil, c.fail(protocolError("unexpected rsv1 bit"))
+			}
+			messageType, compressed = op, rsv1
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(protocolError("unexpected continuation frame"))
+			}
+			if rsv1 {
+				return 0, nil, c.fail(protocolError("unexpected rsv1 bit"))
+			}
+		}
+		if int64(len(p)+len(payload)) > c.readLimit {
+			return 0, nil, c.fail(ErrReadLimit)
+		}
+		p = append(p, payload...)
+		if fin {
+			break
+		}
+	}
+	if compressed {
+		if p, err = decompress(p, c.readLimit); err != nil {
+			return 0, nil, c.fail(err)
+		}
+	}
+	if messageType == TextMessage && !utf8.Valid(p) {
+		return 0, nil, c.fail(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf8"})
+	}
+	return messageType, p, nil
+}
+
+// readFrame reads a single frame and validates its header.
+func (c *Conn) readFrame() (fin, rsv1 bool, op int, payload []byte, err error) {
+	b := c.header[:2]
+	if _, err = io.ReadFull(c.br, b); err != nil {
+		return
+	}
+	fin, rsv1, op = b[0]&finBit != 0, b[0]&rsv1Bit != 0, int(b[0]&0x0f)
+	masked, n := b[1]&maskBit != 0, uint64(b[1]&0x7f)
+	if b[0]&0x30 != 0 {
+		err = protocolError("unexpected rsv2 or rsv3 bit")
+		return
+	}
+	switch op {
+	case continuationFrame, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !fin || rsv1 || n > maxControlPayload {
+			err = protocolError(errInvalidControl.Error())
+			return
+		}
+	default:
+		err = protocolError("unknown opcode " + strconv.Itoa(op))
+		return
+	}
+	// frames from the client must be masked, frames from the server must not
+	if masked != c.server {
+		err = protocolError("bad mask")
+		return
+	}
+	switch n {
+	case 126:
+		if _, err = io.ReadFull(c.br, c.header[:2]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(c.header[:2]))
+	case 127:
+		if _, err = io.ReadFull(c.br, c.header[:8]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(c.header[:8])
+	}
+	if n > uint64(c.readLimit) {
+		err = ErrReadLimit
+		return
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return
+}
+
+// handleClose answers a close frame and returns the *CloseError describing it.
+func (c *Conn) handleClose(payload []byte) error {
+	ce := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return protocolError("invalid close payload")
+	case len(payload) >= 2:
+		ce.Code = int(binary.BigEndian.Uint16(payload))
+		ce.Text = string(payload[2:])
+		if !validCloseCode(ce.Code) {
+			return protocolError("invalid close code " + strconv.Itoa(ce.Code))
+		}
+		if !utf8.ValidString(ce.Text) {
+			return &CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf8"}
+		}
+	}
+	var reply []byte
+	if ce.Code != CloseNoStatusReceived {
+		reply = FormatCloseMessage(ce.Code, "")
+	}
+	_ = c.WriteControl(CloseMessage, reply)
+	return ce
+}
+
+// fail records err as the sticky read error. If err is a *CloseError raised locally,
+// the peer is told with a close frame carrying its code.
+func (c *Conn) fail(err error) error {
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		_ = c.WriteControl(CloseMessage, FormatCloseMessage(ce.Code, ce.Text))
+	} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	c.readErr = err
+	return err
+}
+
+// validCloseCode reports whether the code may be sent in a close frame.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// FormatCloseMessage returns the payload of a close frame with the code and text.
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	b := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	copy(b[2:], text)
+	return b
+}
+
+// WriteMessage writes a data message. The message is compressed if permessage-deflate is
+// negotiated, and split into fragments of WriteFragmentSize bytes if it is set.
+// Control messages are written with WriteControl.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return c.WriteControl(messageType, data)
+	}
+	var rsv1 bool
+	if c.compress {
+		var err error
+		if data, err = compress(data, c.compressLevel); err != nil {
+			return err
+		}
+		rsv1 = true
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	op := messageType
+	for {
+		n := len(data)
+		if c.fragmentSize > 0 && n > c.fragmentSize {
+			n = c.fragmentSize
+		}
+		fin := n == len(data)
+		if err := c.writeFrame(fin, rsv1, op, data[:n]); err != nil {
+			return err
+		}
+		if fin {
+			return nil
+		}
+		data, op, rsv1 = data[n:], continuationFrame, false
+	}
+}
+
+// WriteControl writes a ping, pong or close frame. After a close frame is written,
+// any further write returns ErrCloseSent.
+func (c *Conn) WriteControl(messageType int, data []byte) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage ||
+		len(data) > maxControlPayload {
+		return errInvalidControl
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	return c.writeFrame(true, false, messageType, data)
+}
+
+// Ping writes a ping frame.
+func (c *Conn) Ping(data []byte) error {
+	return c.WriteControl(PingMessage, data)
+}
+
+// WriteClose writes a close frame with the code and text. The connection should be
+// closed once the peer answers, i.e. when ReadMessage returns the *CloseError.
+func (c *Conn) WriteClose(code int, text string) error {
+	return c.WriteControl(CloseMessage, FormatCloseMessage(code, text))
+}
+
+// writeFrame writes a single frame, c.wmu must be held.
+func (c *Conn) writeFrame(fin, rsv1 bool, op int, payload []byte) error {
+	b := c.wbuf[:0]
+	b0 := byte(op)
+	if fin {
+		b0 |= finBit
+	}
+	if rsv1 {
+		b0 |= rsv1Bit
+	}
+	b = append(b, b0)
+	var b1 byte
+	if !c.server {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, b1|byte(n))
+	case n <= 0xffff:
+		b = append(b, b1|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, b1|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if c.server {
+		b = append(b, payload...)
+	} else {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		b = append(b, key[:]...)
+		i := len(b)
+		b = append(b, payload...)
+		maskBytes(key, b[i:])
+	}
+	if cap(b) <= 64<<10 {
+		c.wbuf = b
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"sync"
+)
+
+// Hub keeps a set of connections and broadcasts messages to them.
+// It is safe for concurrent use.
+type Hub struct {
+	mu    sync.RWMutex
+	conns map[*Conn]struct{}
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{conns: make(map[*Conn]struct{})}
+}
+
+// Add adds the connection to the hub.
+func (h *Hub) Add(c *Conn) {
+	h.mu.Lock()
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+// Remove removes the connection from the hub.
+func (h *Hub) Remove(c *Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+}
+
+// Len returns the number of connections in the hub.
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Broadcast writes the message to every connection in the hub.
+// Connections failing to be written are removed from the hub and closed.
+func (h *Hub) Broadcast(messageType int, data []byte) {
+	h.BroadcastFilter(messageType, data, nil)
+}
+
+// BroadcastFilter writes the message to the connections for which filter returns true,
+// e.g. the connections whose "room" parameter matches. A nil filter selects every connection.
+// Connections failing to be written are removed from the hub and closed.
+func (h *Hub) BroadcastFilter(messageType int, data []byte, filter func(c *Conn) bool) {
+	h.mu.RLock()
+	conns := make([]*Conn, 0, len(h.conns))
+	for c := range h.conns {
+		if filter == nil || filter(c) {
+			conns = append(conns, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range conns {
+		if err := c.WriteMessage(messageType, data); err != nil {
+			h.Remove(c)
+			_ = c.Close()
+		}
+	}
+}
+
+// Close sends a close frame with the code and text to every connection and empties the hub.
+func (h *Hub) Close(code int, text string) {
+	h.mu.Lock()
+	conns := h.conns
+	h.conns = make(map[*Conn]struct{})
+	h.mu.Unlock()
+	for c := range conns {
+		_ = c.WriteClose(code, text)
+	}
+}
@@ -0,0 +1,178 @@
+// Package websocket implements the WebSocket protocol (RFC 6455) on top of routing.Ctx.
+//
+// The upgrade handler returned by New is registered like any other handler, so route
+// parameters and group middlewares apply before the connection is upgraded:
+//
+//	api.Get("/ws/<room>", auth, websocket.New(func(c *websocket.Conn) {
+//		hub.Add(c)
+//		defer hub.Remove(c)
+//		for {
+//			mt, p, err := c.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			hub.Broadcast(mt, p)
+//		}
+//	}))
+package websocket
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+	"strings"
+
+	routing "fasthttp-routing"
+	"helpers/unsafefn"
+)
+
+// Handler serves an upgraded connection. The connection is closed when the handler returns.
+type Handler func(c *Conn)
+
+type Config struct {
+	// CheckOrigin 返回 false 时以 403 拒绝升级
+	// 默认只允许 Origin 头部不存在或与 Host 头部一致的请求
+	CheckOrigin func(c *routing.Ctx) bool
+	// Subprotocols 服务端支持的子协议，按优先级排列
+	Subprotocols []string
+	// EnableCompression 客户端提供 permessage-deflate 时启用压缩
+	EnableCompression bool
+	// CompressionLevel flate 压缩级别，默认 flate.BestSpeed
+	CompressionLevel int
+	// ReadLimit 单条消息(解压后)的最大字节数，超过时以 1009 关闭连接，默认 1MB
+	ReadLimit int64
+	// ReadBufferSize 读缓冲区大小，默认 4KB
+	ReadBufferSize int
+	// WriteFragmentSize 大于 0 时，超过该大小的消息被拆分为多个帧发送
+	WriteFragmentSize int
+}
+
+var DefCfg = Config{
+	CompressionLevel: 1,
+	ReadLimit:        1 << 20,
+	ReadBufferSize:   4 << 10,
+}
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// comma joins the values of a header sent in several lines
+var comma = []byte(",")
+
+// New creates a handler that upgrades the request to a WebSocket connection served by handler.
+// Requests that are not valid upgrade requests are answered with an error:
+// 405 for methods other than GET, 426 for unsupported versions, 400 for malformed
+// handshakes and 403 when CheckOrigin rejects the request.
+// The handlers after it are skipped once the request is upgraded.
+func New(handler Handler, cfgs ...*Config) routing.Handler {
+	var cfg *Config
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	} else {
+		cfg = &DefCfg
+	}
+	checkOrigin := cfg.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	return func(c *routing.Ctx) error {
+		if !c.IsGet() {
+			return routing.ErrMethodNotAllowed
+		}
+		h := &c.Request.Header
+		if !tokenListContains(h.Peek(routing.HeaderConnection), "upgrade") ||
+			!tokenListContains(h.Peek(routing.HeaderUpgrade), "websocket") {
+			c.Response.Header.Set(routing.HeaderUpgrade, "websocket")
+			return routing.ErrUpgradeRequired
+		}
+		if string(h.Peek(routing.HeaderSecWebSocketVersion)) != "13" {
+			c.Response.Header.Set(routing.HeaderSecWebSocketVersion, "13")
+			return routing.ErrUpgradeRequired
+		}
+		key := h.Peek(routing.HeaderSecWebSocketKey)
+		if k, err := base64.StdEncoding.DecodeString(unsafefn.BtoS(key)); err != nil || len(k) != 16 {
+			return routing.ErrBadRequest
+		}
+		if !checkOrigin(c) {
+			return routing.ErrForbidden
+		}
+
+		c.SetStatusCode(routing.StatusSwitchingProtocols)
+		c.Response.Header.Set(routing.HeaderUpgrade, "websocket")
+		c.Response.Header.Set(routing.HeaderConnection, "Upgrade")
+		c.Response.Header.Set(routing.HeaderSecWebSocketAccept, acceptKey(key))
+		subprotocol := selectSubprotocol(bytes.Join(h.PeekAll(routing.HeaderSecWebSocketProtocol), comma), cfg.Subprotocols)
+		if subprotocol != "" {
+			c.Response.Header.Set(routing.HeaderSecWebSocketProtocol, subprotocol)
+		}
+		compress := cfg.EnableCompression && offersDeflate(bytes.Join(h.PeekAll(routing.HeaderSecWebSocketExtensions), comma))
+		if compress {
+			c.Response.Header.Set(routing.HeaderSecWebSocketExtensions, deflateResponse)
+		}
+
+		// the Ctx is released after the handler returns, copy what the connection needs
+		conn := &Conn{
+			server:        true,
+			subprotocol:   subprotocol,
+			compress:      compress,
+			compressLevel: cfg.CompressionLevel,
+			readLimit:     cfg.ReadLimit,
+			fragmentSize:  cfg.WriteFragmentSize,
+			params:        c.Params(),
+			values:        make(map[any]any),
+		}
+		c.VisitUserValuesAll(func(k, v any) {
+			conn.values[k] = v
+		})
+		bufSize := cfg.ReadBufferSize
+		if bufSize <= 0 {
+			bufSize = DefCfg.ReadBufferSize
+		}
+		c.Hijack(func(nc net.Conn) {
+			conn.init(nc, bufSize)
+			handler(conn)
+		})
+		c.Abort()
+		return nil
+	}
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value of the key.
+func acceptKey(key []byte) string {
+	h := sha1.New()
+	h.Write(key)
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin reports whether the Origin header is absent or its host equals the Host header.
+func sameOrigin(c *routing.Ctx) bool {
+	origin := unsafefn.BtoS(c.Request.Header.Peek(routing.HeaderOrigin))
+	if origin == "" {
+		return true
+	}
+	if i := strings.Index(origin, "://"); i >= 0 {
+		origin = origin[i+3:]
+	}
+	return strings.EqualFold(origin, unsafefn.BtoS(c.Request.Header.Host()))
+}
+
+// selectSubprotocol returns the first server protocol offered by the client.
+func selectSubprotocol(offered []byte, protocols []string) string {
+	for _, p := range protocols {
+		if tokenListContains(offered, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// tokenListContains reports whether the comma separated header value contains token, case-insensitively.
+func tokenListContains(value []byte, token string) bool {
+	for _, s := range strings.Split(unsafefn.BtoS(value), ",") {
+		if strings.EqualFold(strings.TrimSpace(s), token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package websocket
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/routingtest"
+	"github.com/newacorn/fasthttp"
+	"github.com/newacorn/fasthttp/fasthttputil"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve starts a server for the router on an in-memory listener.
+func serve(t *testing.T, router *routing.Router) *fasthttputil.InmemoryListener {
+	ln := fasthttputil.NewInmemoryListener()
+	server := &fasthttp.Server{Handler: router.HandleRequest}
+	go func() {
+		_ = server.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	return ln
+}
+
+func dial(t *testing.T, ln *fasthttputil.InmemoryListener, uri string, cfg *ClientConfig) *Conn {
+	nc, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := Client(nc, uri, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+func echo(c *Conn) {
+	for {
+		mt, p, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err = c.WriteMessage(mt, p); err != nil {
+			return
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	router := routing.New()
+	group := router.Group("/ws", func(c *routing.Ctx) error {
+		c.SetUserValue("user", "acorn")
+		return nil
+	})
+	cfg := DefCfg
+	cfg.EnableCompression = true
+	cfg.WriteFragmentSize = 100
+	cfg.Subprotocols = []string{"v2", "v1"}
+	closed := make(chan error, 1)
+	group.Get("/<room>", New(func(c *Conn) {
+		_ = c.WriteMessage(TextMessage, []byte(c.Param("room")+" "+c.UserValue("user").(string)+" "+c.Subprotocol()))
+		for {
+			mt, p, err := c.ReadMessage()
+			if err != nil {
+				closed <- err
+				return
+			}
+			if err = c.WriteMessage(mt, p); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}, &cfg))
+	ln := serve(t, router)
+
+	c := dial(t, ln, "http://example.com/ws/lobby", &ClientConfig{EnableCompression: true, Subprotocols: []string{"v1", "v2"}})
+	assert.True(t, c.compress)
+	assert.Equal(t, "v2", c.Subprotocol())
+	mt, p, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, TextMessage, mt)
+	assert.Equal(t, "lobby acorn v2", string(p))
+
+	// large messages are compressed and fragmented by the server
+	large := bytes.Repeat([]byte("websocket "), 10000)
+	for _, msg := range [][]byte{[]byte("hello"), {}, large} {
+		assert.Nil(t, c.WriteMessage(BinaryMessage, msg))
+		mt, p, err = c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, BinaryMessage, mt)
+		assert.Equal(t, msg, p)
+	}
+
+	// fragmented by the client, with a ping between the fragments
+	c.fragmentSize = 3
+	var pong string
+	c.SetPongHandler(func(data []byte) error {
+		pong = string(data)
+		return nil
+	})
+	assert.Nil(t, c.Ping([]byte("ping")))
+	assert.Nil(t, c.WriteMessage(TextMessage, []byte("fragmented")))
+	_, p, err = c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "fragmented", string(p))
+	assert.Equal(t, "ping", pong)
+
+	assert.Nil(t, c.WriteClose(CloseNormalClosure, "bye"))
+	assert.Equal(t, ErrCloseSent, c.WriteMessage(TextMessage, []byte("x")))
+	_, _, err = c.ReadMessage()
+	assert.True(t, IsCloseError(err, CloseNormalClosure))
+	err = <-closed
+	assert.Equal(t, &CloseError{Code: CloseNormalClosure, Text: "bye"}, err)
+}
+
+func TestHandshake(t *testing.T) {
+	router := routing.New()
+	router.To("GET,POST", "/ws", New(echo, &Config{
+		CheckOrigin: func(c *routing.Ctx) bool {
+			return string(c.Request.Header.Peek(routing.HeaderOrigin)) != "http://evil.com"
+		},
+	}))
+	client := router.TestClient()
+	upgrade := func(method string) *routing.TestRequest {
+		return client.Request(method, "/ws").
+			Header(routing.HeaderConnection, "keep-alive, Upgrade").
+			Header(routing.HeaderUpgrade, "WebSocket").
+			Header(routing.HeaderSecWebSocketVersion, "13").
+			Header(routing.HeaderSecWebSocketKey, "dGhlIHNhbXBsZSBub25jZQ==")
+	}
+
+	res, err := upgrade("GET").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusSwitchingProtocols).
+		Header(routing.HeaderSecWebSocketAccept, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=").
+		Header(routing.HeaderSecWebSocketExtensions, "")
+
+	res, _ = upgrade("POST").Do()
+	routingtest.Expect(t, res).Status(routing.StatusMethodNotAllowed)
+	res, _ = client.Get("/ws").Do()
+	routingtest.Expect(t, res).Status(routing.StatusUpgradeRequired).Header(routing.HeaderUpgrade, "websocket")
+	res, _ = upgrade("GET").Header(routing.HeaderSecWebSocketVersion, "8").Do()
+	routingtest.Expect(t, res).Status(routing.StatusUpgradeRequired).Header(routing.HeaderSecWebSocketVersion, "13")
+	res, _ = upgrade("GET").Header(routing.HeaderSecWebSocketKey, "short").Do()
+	routingtest.Expect(t, res).Status(routing.StatusBadRequest)
+	res, _ = upgrade("GET").Header(routing.HeaderOrigin, "http://evil.com").Do()
+	routingtest.Expect(t, res).Status(routing.StatusForbidden)
+
+	// the default origin check compares the origin with the host
+	router = routing.New()
+	router.Get("/ws", New(echo))
+	ln := serve(t, router)
+	nc, _ := ln.Dial()
+	_, res2, err := Client(nc, "http://example.com/ws", &ClientConfig{Header: map[string]string{routing.HeaderOrigin: "https://other.com"}})
+	assert.Equal(t, ErrBadHandshake, err)
+	assert.Equal(t, routing.StatusForbidden, res2.StatusCode())
+	dial(t, ln, "http://example.com/ws", &ClientConfig{Header: map[string]string{routing.HeaderOrigin: "https://example.com"}})
+}
+
+func TestProtocolErrors(t *testing.T) {
+	router := routing.New()
+	router.Get("/ws", New(echo, &Config{ReadLimit: 16}))
+	ln := serve(t, router)
+
+	tests := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"unmasked", []byte{finBit | TextMessage, 1, 'a'}, CloseProtocolError},
+		{"rsv1 without compression", []byte{finBit | rsv1Bit | TextMessage, maskBit | 1, 0, 0, 0, 0, 'a'}, CloseProtocolError},
+		{"unknown opcode", []byte{finBit | 3, maskBit, 0, 0, 0, 0}, CloseProtocolError},
+		{"fragmented ping", []byte{PingMessage, maskBit, 0, 0, 0, 0}, CloseProtocolError},
+		{"orphan continuation", []byte{finBit, maskBit | 1, 0, 0, 0, 0, 'a'}, CloseProtocolError},
+		{"invalid utf8", []byte{finBit | TextMessage, maskBit | 1, 0, 0, 0, 0, 0xff}, CloseInvalidFramePayloadData},
+		{"too big", append([]byte{finBit | BinaryMessage, maskBit | 17, 0, 0, 0, 0}, make([]byte, 17)...), CloseMessageTooBig},
+		{"invalid close code", []byte{finBit | CloseMessage, maskBit | 2, 0, 0, 0, 0, 0x03, 0xed}, CloseProtocolError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := dial(t, ln, "http://example.com/ws", nil)
+			_, err := c.conn.Write(test.frame)
+			assert.Nil(t, err)
+			_, _, err = c.ReadMessage()
+			assert.True(t, IsCloseError(err, test.code), err)
+		})
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	joined := make(chan struct{}, 3)
+	router := routing.New()
+	router.Get("/rooms/<room>", New(func(c *Conn) {
+		hub.Add(c)
+		defer hub.Remove(c)
+		joined <- struct{}{}
+		room := c.Param("room")
+		for {
+			_, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			hub.BroadcastFilter(TextMessage, p, func(c *Conn) bool {
+				return c.Param("room") == room
+			})
+		}
+	}))
+	ln := serve(t, router)
+
+	a := dial(t, ln, "http://example.com/rooms/go", nil)
+	b := dial(t, ln, "http://example.com/rooms/go", nil)
+	other := dial(t, ln, "http://example.com/rooms/rust", nil)
+	for i := 0; i < 3; i++ {
+		<-joined
+	}
+	assert.Equal(t, 3, hub.Len())
+
+	assert.Nil(t, a.WriteMessage(TextMessage, []byte("hi gophers")))
+	for _, c := range []*Conn{a, b} {
+		_, p, err := c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, "hi gophers", string(p))
+	}
+
+	hub.Broadcast(TextMessage, []byte("all"))
+	_, p, err := other.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "all", string(p))
+
+	hub.Close(CloseGoingAway, "shutdown")
+	assert.Equal(t, 0, hub.Len())
+	_, _, err = other.ReadMessage()
+	assert.True(t, IsCloseError(err, CloseGoingAway))
+}
+
+func TestCompress(t *testing.T) {
+	msg := []byte(strings.Repeat("compress me ", 100))
+	p, err := compress(msg, 1)
+	assert.Nil(t, err)
+	assert.Less(t, len(p), len(msg))
+	out, err := decompress(p, 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, msg, out)
+
+	_, err = decompress(p, 10)
+	assert.Equal(t, ErrReadLimit, err)
+
+	assert.True(t, offersDeflate([]byte("foo, permessage-deflate; client_max_window_bits")))
+	assert.False(t, offersDeflate([]byte("x-webkit-deflate-frame")))
+}
@@ -0,0 +1,213 @@
+package xff
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ErrInvalidForwarded is returned by ParseForwarded when the header does not follow RFC 7239.
+var ErrInvalidForwarded = errors.New("xff: invalid Forwarded header")
+
+// ForwardedElement is an element of the Forwarded header (RFC 7239), added by a proxy. The values
+// are unquoted, and empty when the parameter is absent.
+type ForwardedElement struct {
+	// For identifies the node which sent the request to the proxy: an IPv4 address, an IPv6
+	// address in brackets, "unknown" or an obfuscated identifier starting with "_", optionally
+	// followed by a port, e.g. "192.0.2.60", "[2001:db8:cafe::17]:4711" or "_hidden".
+	For string
+	// By identifies the interface of the proxy which received the request, like For.
+	By string
+	// Host is the Host header of the request received by the proxy.
+	Host string
+	// Proto is the scheme of the request received by the proxy, e.g. "https".
+	Proto string
+}
+
+// ParseForwarded parses the value of the Forwarded header, the elements being in the order of the
+// proxies: the first element is added by the proxy receiving the request from the client. The
+// parameters other than for, by, host and proto are ignored.
+func ParseForwarded(header string) (elements []ForwardedElement, err error) {
+	p := forwardedParser{s: header}
+	for {
+		p.skipSpace()
+		if p.done() {
+			return
+		}
+		var e ForwardedElement
+		if err = p.element(&e); err != nil {
+			return nil, err
+		}
+		elements = append(elements, e)
+		p.skipSpace()
+		if p.done() {
+			return
+		}
+		if p.s[p.i] != ',' {
+			return nil, ErrInvalidForwarded
+		}
+		p.i++
+	}
+}
+
+type forwardedParser struct {
+	s string
+	i int
+}
+
+func (p *forwardedParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *forwardedParser) skipSpace() {
+	for !p.done() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+// element parses the pairs of an element, up to the next comma.
+func (p *forwardedParser) element(e *ForwardedElement) error {
+	var seen [4]bool
+	for {
+		p.skipSpace()
+		if p.done() || p.s[p.i] == ',' {
+			return nil
+		}
+		if p.s[p.i] == ';' {
+			// empty pair
+			p.i++
+			continue
+		}
+		name := p.token()
+		if name == "" || p.done() || p.s[p.i] != '=' {
+			return ErrInvalidForwarded
+		}
+		p.i++
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		var k int
+		var dst *string
+		switch strings.ToLower(name) {
+		case "for":
+			k, dst = 0, &e.For
+		case "by":
+			k, dst = 1, &e.By
+		case "host":
+			k, dst = 2, &e.Host
+		case "proto":
+			k, dst = 3, &e.Proto
+		default:
+			k = -1
+		}
+		if k >= 0 {
+			if seen[k] {
+				// a parameter must not occur more than once per element
+				return ErrInvalidForwarded
+			}
+			seen[k] = true
+			*dst = value
+		}
+		p.skipSpace()
+		if p.done() || p.s[p.i] == ',' {
+			return nil
+		}
+		if p.s[p.i] != ';' {
+			return ErrInvalidForwarded
+		}
+		p.i++
+	}
+}
+
+func (p *forwardedParser) token() string {
+	start := p.i
+	for !p.done() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// value parses a token or a quoted string. Unquoted values may also contain the characters
+// which are not allowed in a token but commonly sent by proxies, like the colons and brackets
+// of "[2001:db8:cafe::17]:4711".
+func (p *forwardedParser) value() (string, error) {
+	if p.done() || p.s[p.i] != '"' {
+		start := p.i
+		for !p.done() && isValueChar(p.s[p.i]) {
+			p.i++
+		}
+		if p.i == start {
+			return "", ErrInvalidForwarded
+		}
+		return p.s[start:p.i], nil
+	}
+	p.i++
+	var b strings.Builder
+	for start := p.i; !p.done(); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '"':
+			if b.Len() == 0 {
+				v := p.s[start:p.i]
+				p.i++
+				return v, nil
+			}
+			b.WriteString(p.s[start:p.i])
+			p.i++
+			return b.String(), nil
+		case '\\':
+			if p.i+1 >= len(p.s) {
+				return "", ErrInvalidForwarded
+			}
+			b.WriteString(p.s[start:p.i])
+			p.i++
+			start = p.i
+		default:
+			if c < ' ' && c != '\t' || c == 0x7f {
+				return "", ErrInvalidForwarded
+			}
+		}
+	}
+	return "", ErrInvalidForwarded
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isValueChar(c byte) bool {
+	return c > ' ' && c < 0x7f && c != ',' && c != ';' && c != '"' && c != '\\'
+}
+
+// nodeIP returns the IP address of a node of the for or by parameter, or nil if the node is
+// "unknown" or obfuscated.
+func nodeIP(node string) net.IP {
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 || (end+1 < len(node) && node[end+1] != ':') {
+			return nil
+		}
+		ip := net.ParseIP(node[1:end])
+		if ip == nil || ip.To4() != nil {
+			return nil
+		}
+		return ip
+	}
+	if ip := net.ParseIP(node); ip != nil {
+		// an IPv6 address which has not been quoted and bracketed
+		return ip
+	}
+	host, _, ok := strings.Cut(node, ":")
+	if !ok {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() == nil {
+		return nil
+	}
+	return ip
+}
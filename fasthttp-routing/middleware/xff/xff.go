@@ -9,14 +9,17 @@ import (
 	routing "fasthttp-routing"
 	"github.com/rs/zerolog/log"
 	"helpers/unsafefn"
-	"helpers/utilconvert"
 	"helpers/utilnet"
 )
 
 type Config struct {
-	TrustProxies     []string
-	iPRanges         []net.IPNet
-	Skip             func(c *routing.Ctx) bool
+	TrustProxies []string
+	iPRanges     []net.IPNet
+	// Deprecated: register the middleware with RouteGroup.UseExcept instead.
+	Skip func(c *routing.Ctx) bool
+	// TrustedHeaderSet 信任的来自 TrustProxies 的头部，为 routing.HEADER_* 的组合，默认为 X-Forwarded-For/Host/Port/Proto。
+	// Forwarded 头（routing.HEADER_FORWARDED）及 X-Forwarded-Prefix 头（routing.HEADER_X_FORWARDED_PREFIX，
+	// 影响 Ctx.Prefix 及 Ctx.URL）需显式加入，例如 DefCfg.TrustedHeaderSet | routing.HEADER_FORWARDED
 	TrustedHeaderSet int
 }
 
@@ -33,6 +36,57 @@ const (
 type xffInfo struct {
 	cfg   *Config
 	trust int
+	// forwarded 解析 Forwarded 头得到的客户端信息，第一次使用时解析
+	forwarded *forwardedClient
+}
+
+// forwardedClient is the client found in the Forwarded header.
+type forwardedClient struct {
+	// ip 客户端 IP，客户端节点为 unknown、混淆标识或受信任代理时为空
+	ip string
+	// host、proto 客户端元素的 host 与 proto，没有时取其右侧最近的有该参数的元素
+	host  string
+	proto string
+}
+
+// forwardedClient parses the Forwarded header once. The elements are walked from the right,
+// skipping the trusted proxies, and the client is the first node which is not a trusted proxy,
+// or the leftmost one if all of them are trusted.
+func (x *xffInfo) forwardedClient(ctx *routing.Ctx) *forwardedClient {
+	if x.forwarded != nil {
+		return x.forwarded
+	}
+	x.forwarded = &forwardedClient{}
+	if x.cfg.TrustedHeaderSet&routing.HEADER_FORWARDED == 0 {
+		return x.forwarded
+	}
+	ff := ctx.Request.Header.Peek(routing.HeaderForwarded)
+	if len(ff) == 0 {
+		return x.forwarded
+	}
+	elements, err := ParseForwarded(string(ff))
+	if err != nil || len(elements) == 0 {
+		return x.forwarded
+	}
+	i := len(elements) - 1
+	for ; i > 0; i-- {
+		ip := nodeIP(elements[i].For)
+		if ip == nil || !checkIp2(ip, x.cfg.iPRanges) {
+			break
+		}
+	}
+	if ip := nodeIP(elements[i].For); ip != nil && !checkIp2(ip, x.cfg.iPRanges) {
+		x.forwarded.ip = ip.String()
+	}
+	for j := i; j < len(elements); j++ {
+		if x.forwarded.host == "" {
+			x.forwarded.host = elements[j].Host
+		}
+		if x.forwarded.proto == "" {
+			x.forwarded.proto = elements[j].Proto
+		}
+	}
+	return x.forwarded
 }
 
 func (x *xffInfo) isFromTrustedProxy(c *routing.Ctx) bool {
@@ -55,30 +109,8 @@ func (x *xffInfo) Host(ctx *routing.Ctx) {
 	if routing.HEADER_X_FORWARDED_HOST&x.cfg.TrustedHeaderSet != 0 {
 		forwardHost = ctx.Request.Header.Peek(routing.HeaderXForwardedHost)
 	}
-	if len(forwardHost) == 0 && x.cfg.TrustedHeaderSet&routing.HEADER_FORWARDED != 0 {
-		ff := ctx.Request.Header.Peek(routing.HeaderForwarded)
-	outer:
-		for i := range ff {
-			if ff[i] == 'h' || ff[i] == 'H' {
-				if len(ff)-i < 5 {
-					break
-				}
-				part := ff[i : i+5]
-				utilconvert.ToLower(part)
-				if unsafefn.BtoS(part) == "host=" {
-					after := ff[i+5:]
-					var j int
-					for j = range after {
-						if after[j] == ',' || after[j] == ';' {
-							forwardHost = after[:j]
-							break outer
-						}
-					}
-					forwardHost = after
-					break outer
-				}
-			}
-		}
+	if len(forwardHost) == 0 {
+		forwardHost = unsafefn.StoB(x.forwardedClient(ctx).host)
 	}
 	if len(forwardHost) != 0 {
 		ip, port, err := utilnet.SplitIpAndPort(unsafefn.BtoS(forwardHost))
@@ -122,44 +154,12 @@ func (x *xffInfo) IP(ctx *routing.Ctx) {
 	if routing.HEADER_X_FORWARDED_FOR&x.cfg.TrustedHeaderSet != 0 {
 		xff = ctx.Request.Header.Peek(routing.HeaderXForwardedFor)
 	}
-	var xffs []string
+	var realIp string
 	if len(xff) != 0 {
-		xffs = strings.Split(unsafefn.BtoS(xff), ",")
-	}
-	if len(xff) == 0 && x.cfg.TrustedHeaderSet&routing.HEADER_FORWARDED != 0 {
-		ff := ctx.Request.Header.Peek(routing.HeaderForwarded)
-		if len(ff) == 0 {
-			return
-		}
-	outer:
-		for i := range ff {
-			if ff[i] == 'f' || ff[i] == 'F' {
-				if len(ff)-i < 4 {
-					break
-				}
-				part := ff[i : i+4]
-				utilconvert.ToLower(part)
-				if unsafefn.BtoS(part) == "for=" {
-					after := ff[i+4:]
-					var j int
-					for j = range after {
-						if after[j] == ',' || after[j] == ';' {
-							xffs = append(xffs, unsafefn.BtoS(after[:j]))
-							i = i + j
-							continue outer
-						}
-					}
-					xffs = append(xffs, unsafefn.BtoS(after))
-					i = i + j
-				}
-			}
-
-		}
-	}
-	if len(xffs) == 0 {
-		return
+		realIp = normalizeAndFilterClientIps(strings.Split(unsafefn.BtoS(xff), ","), x.cfg.iPRanges)
+	} else {
+		realIp = x.forwardedClient(ctx).ip
 	}
-	realIp := normalizeAndFilterClientIps(xffs, x.cfg.iPRanges)
 	if len(realIp) == 0 {
 		return
 	}
@@ -174,30 +174,14 @@ func (x *xffInfo) Secure(ctx *routing.Ctx) {
 	if routing.HEADER_X_FORWARDED_PROTO&x.cfg.TrustedHeaderSet != 0 {
 		xfp = ctx.Request.Header.Peek(routing.HeaderXForwardedProto)
 	}
-	if len(xfp) == 0 && x.cfg.TrustedHeaderSet&routing.HEADER_FORWARDED != 0 {
-
-		ff := ctx.Request.Header.Peek(routing.HeaderForwarded)
-	outer:
-		for i := range ff {
-			if ff[i] == 'p' || ff[i] == 'P' {
-				if len(ff)-i < 6 {
-					break
-				}
-				part := ff[i : i+6]
-				utilconvert.ToLower(part)
-				if unsafefn.BtoS(part) == "proto=" {
-					after := ff[i+6:]
-					var j int
-					for j = range after {
-						if after[j] == ',' || after[j] == ';' {
-							xfp = after[:j]
-							break outer
-						}
-					}
-					xfp = after
-					break outer
-				}
+	if len(xfp) == 0 {
+		if proto := x.forwardedClient(ctx).proto; proto != "" {
+			if strings.EqualFold(proto, routing.HTTPS) {
+				ctx.RSecure = routing.PROTOSECURE
+				return
 			}
+			ctx.RSecure = routing.PROTOUNSECURE
+			return
 		}
 	}
 	if len(xfp) != 0 {
@@ -210,6 +194,27 @@ func (x *xffInfo) Secure(ctx *routing.Ctx) {
 	}
 }
 
+// Prefix sets the path prefix from the X-Forwarded-Prefix header. Only the first value is used,
+// and it is ignored unless it is an absolute path, so that it can not turn the URLs into
+// protocol-relative or external ones.
+func (x *xffInfo) Prefix(ctx *routing.Ctx) {
+	if !x.isFromTrustedProxy(ctx) || routing.HEADER_X_FORWARDED_PREFIX&x.cfg.TrustedHeaderSet == 0 {
+		return
+	}
+	prefix := unsafefn.BtoS(ctx.Request.Header.Peek(routing.HeaderXForwardedPrefix))
+	prefix, _, _ = strings.Cut(prefix, ",")
+	prefix = strings.TrimSpace(prefix)
+	if !strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "//") {
+		return
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := prefix[i]; c <= ' ' || c == 0x7f || c == '\\' || c == '?' || c == '#' {
+			return
+		}
+	}
+	ctx.RPrefix = append(ctx.RPrefix, strings.TrimRight(prefix, "/")...)
+}
+
 func New(cfgs ...Config) routing.Handler {
 	// var ipRanges []net.IPNet
 	var cfg *Config
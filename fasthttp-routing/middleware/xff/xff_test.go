@@ -2,10 +2,10 @@ package xff
 
 import (
 	"net"
+	"strconv"
 	"testing"
 
 	routing "fasthttp-routing"
-	"github.com/newacorn/fasthttp"
 	"github.com/stretchr/testify/assert"
 	"helpers/unsafefn"
 )
@@ -189,17 +189,142 @@ func getOut(in *input) (r *out) {
 		r.Port = ctx.Port()
 		return nil
 	})
-	ctx := &fasthttp.RequestCtx{}
-	req := &fasthttp.Request{}
-	req.Header.SetHost(in.HeaderHost)
-	req.Header.Set(routing.HeaderXForwardedHost, in.HeaderXFH)
-	req.Header.Set(routing.HeaderXForwardedPort, in.HeaderXFP)
-	req.Header.Set(routing.HeaderXForwardedProto, in.HeaderXFPRO)
-	req.Header.Set(routing.HeaderXForwardedFor, in.HeaderXFF)
-	req.Header.Set(routing.HeaderForwarded, in.FF)
-
-	addr := &net.TCPAddr{IP: net.ParseIP(in.remoteIp), Port: in.remotePort}
-	ctx.Init(req, addr, nil)
-	router.HandleRequest(ctx)
+	_, err := router.TestClient().Get("/").
+		RemoteIP(net.JoinHostPort(in.remoteIp, strconv.Itoa(in.remotePort))).
+		Header(routing.HeaderHost, in.HeaderHost).
+		Header(routing.HeaderXForwardedHost, in.HeaderXFH).
+		Header(routing.HeaderXForwardedPort, in.HeaderXFP).
+		Header(routing.HeaderXForwardedProto, in.HeaderXFPRO).
+		Header(routing.HeaderXForwardedFor, in.HeaderXFF).
+		Header(routing.HeaderForwarded, in.FF).
+		Do()
+	if err != nil {
+		panic(err)
+	}
 	return
 }
+
+func TestParseForwarded(t *testing.T) {
+	elements, err := ParseForwarded(`for="_gazonk"`)
+	assert.Nil(t, err)
+	assert.Equal(t, []ForwardedElement{{For: "_gazonk"}}, elements)
+
+	elements, err = ParseForwarded(`For="[2001:db8:cafe::17]:4711"`)
+	assert.Nil(t, err)
+	assert.Equal(t, []ForwardedElement{{For: "[2001:db8:cafe::17]:4711"}}, elements)
+
+	elements, err = ParseForwarded(`for=192.0.2.60;proto=http;by=203.0.113.43`)
+	assert.Nil(t, err)
+	assert.Equal(t, []ForwardedElement{{For: "192.0.2.60", By: "203.0.113.43", Proto: "http"}}, elements)
+
+	elements, err = ParseForwarded(`for=192.0.2.43 , for="[2001:db8:cafe::17]" ;host="a\"b.com", for=unknown;ext=1`)
+	assert.Nil(t, err)
+	assert.Equal(t, []ForwardedElement{{For: "192.0.2.43"}, {For: "[2001:db8:cafe::17]", Host: `a"b.com`},
+		{For: "unknown"}}, elements)
+
+	elements, err = ParseForwarded("")
+	assert.Nil(t, err)
+	assert.Empty(t, elements)
+
+	for _, header := range []string{
+		`for`, `for=`, `=a`, `for="a`, `for="a\`, `for=a b`, `for=a;for=b`, `for=a;;by="x"y`, "for=\"a\x01\"",
+	} {
+		_, err = ParseForwarded(header)
+		assert.ErrorIs(t, err, ErrInvalidForwarded, header)
+	}
+}
+
+func TestNodeIP(t *testing.T) {
+	for node, want := range map[string]string{
+		"192.0.2.60":               "192.0.2.60",
+		"192.0.2.60:8080":          "192.0.2.60",
+		"[2001:db8:cafe::17]":      "2001:db8:cafe::17",
+		"[2001:db8:cafe::17]:4711": "2001:db8:cafe::17",
+		"2001:db8:cafe::17":        "2001:db8:cafe::17",
+		"[192.0.2.60]":             "",
+		"[2001:db8:cafe::17]x":     "",
+		"unknown":                  "",
+		"_hidden":                  "",
+		"_hidden:_port":            "",
+	} {
+		ip := nodeIP(node)
+		if want == "" {
+			assert.Nil(t, ip, node)
+			continue
+		}
+		assert.Equal(t, want, ip.String(), node)
+	}
+}
+
+func TestForwardedWalk(t *testing.T) {
+	trust := []string{"127.0.0.1", "10.0.0.0/8"}
+	set := routing.HEADER_FORWARDED
+	for _, in := range []input{
+		{name: "skip trusted proxies", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF:           `for=198.51.100.17, for=10.0.0.2;proto=https, for="10.0.0.1:80";host=app.example.com`,
+			TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "198.51.100.17", Port: 443, Host: "app.example.com", Proto: routing.HTTPS}},
+		{name: "spoofed by client", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF:           `for=1.2.3.4;host=evil.com;proto=http, for=198.51.100.17;host=app.example.com;proto=https`,
+			TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "198.51.100.17", Port: 443, Host: "app.example.com", Proto: routing.HTTPS}},
+		{name: "obfuscated client", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF:           `for=1.2.3.4, for=_hidden;proto=https, for=10.0.0.1`,
+			TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "127.0.0.1", Port: 443, Host: "example.com", Proto: routing.HTTPS}},
+		{name: "unknown client", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF: `for=unknown;proto=HTTPS`, TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "127.0.0.1", Port: 443, Host: "example.com", Proto: routing.HTTPS}},
+		{name: "all trusted", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF: `for=10.0.0.2;host=app.example.com, for=10.0.0.1`, TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "127.0.0.1", Port: 80, Host: "app.example.com", Proto: routing.HTTP}},
+		{name: "not trusted by default", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF: `for=198.51.100.17;proto=https`, TrustProxies: trust, TrustHeadersSet: DefCfg.TrustedHeaderSet,
+			want: out{IP: "127.0.0.1", Port: 80, Host: "example.com", Proto: routing.HTTP}},
+		{name: "malformed", remoteIp: "127.0.0.1", HeaderHost: "example.com",
+			FF: `for=198.51.100.17;proto=https;proto=http`, TrustProxies: trust, TrustHeadersSet: set,
+			want: out{IP: "127.0.0.1", Port: 80, Host: "example.com", Proto: routing.HTTP}},
+	} {
+		t.Run(in.name, func(t *testing.T) {
+			in.remotePort = 3099
+			assert.Equal(t, &in.want, getOut(&in))
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	prefixSet := DefCfg.TrustedHeaderSet | routing.HEADER_X_FORWARDED_PREFIX
+	for _, tc := range []struct {
+		name, remoteIp, header, prefix string
+		set                            int
+	}{
+		{"trusted", "127.0.0.1", "/app/", "/app", prefixSet},
+		{"first value", "127.0.0.1", " /app , /other", "/app", prefixSet},
+		{"root", "127.0.0.1", "/", "", prefixSet},
+		{"untrusted proxy", "192.168.0.1", "/app", "", prefixSet},
+		{"untrusted header", "127.0.0.1", "/app", "", DefCfg.TrustedHeaderSet},
+		{"relative", "127.0.0.1", "app", "", prefixSet},
+		{"protocol relative", "127.0.0.1", "//evil.com", "", prefixSet},
+		{"backslash", "127.0.0.1", "/\\evil.com", "", prefixSet},
+		{"query", "127.0.0.1", "/app?a=b", "", prefixSet},
+		{"space", "127.0.0.1", "/a pp", "", prefixSet},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var prefix, url string
+			app := routing.New()
+			app.Use(New(Config{TrustedHeaderSet: tc.set, TrustProxies: []string{"127.0.0.1"}}))
+			app.Get("/users/<id>", func(c *routing.Ctx) error {
+				prefix = string(c.Prefix())
+				url = c.URL("user", "id", 1)
+				return nil
+			}).Name("user")
+			_, err := app.TestClient().Get("/users/1").
+				RemoteIP(net.JoinHostPort(tc.remoteIp, "3099")).
+				Header(routing.HeaderXForwardedPrefix, tc.header).
+				Do()
+			assert.Nil(t, err)
+			assert.Equal(t, tc.prefix, prefix)
+			assert.Equal(t, tc.prefix+"/users/1", url)
+		})
+	}
+}
@@ -25,17 +25,38 @@ type Route struct {
 	handlers [][]Handler
 	// 路径中正则模式的参数
 	regexps []*regexp.Regexp
+	// 路径中使用 ParamMatcher 的参数，与paramNames按索引对应，不是 ParamMatcher 的参数对应nil
+	matchers []ParamMatcher
 	// 路径片段按路由参数分隔，路由参数统一格式为 <paraName:>/<paraName:\d+> -> <paraName>
 	// /* -> /<*:.*> -> <*>
 	segments []string
 	// 路由参数的名称，与regexps按索引对应，如果参数不是正则模式则对应的regexp.Regexp是nil。
 	paramNames []string
+	// 路由元数据，创建时从所在组继承
+	meta map[string]any
+	// 此路由跳过的具名中间件
+	skips []string
+	// 随此路由设置名称、元数据和跳过的中间件的路由，如 Static 注册的前缀下的文件路由
+	aliases []*Route
 }
 
 func (r *Route) Path() string {
 	return r.path
 }
 
+// RouteName returns the name of the route, which is its path unless set by Name.
+func (r *Route) RouteName() string {
+	return r.name
+}
+
+// Host returns the host pattern of the route, empty if the route is not registered through Router.Host.
+func (r *Route) Host() string {
+	if r.group.host != nil {
+		return r.group.host.pattern
+	}
+	return ""
+}
+
 // newRoute creates a new Route with the given route path and route group.
 func newRoute(path string, group *RouteGroup) *Route {
 	path = group.prefix + path
@@ -51,9 +72,11 @@ func newRoute(path string, group *RouteGroup) *Route {
 		name:     name,
 		path:     path,
 		template: buildURLTemplate(path),
+		meta:     cloneMeta(group.meta),
 	}
-	route.segments, route.paramNames, route.regexps = buildURLTemplate2(path)
+	route.segments, route.paramNames, route.regexps, route.matchers = buildURLTemplate2(path)
 	group.router.routes[name] = route
+	group.router.routeList = append(group.router.routeList, route)
 
 	return route
 }
@@ -63,6 +86,35 @@ func newRoute(path string, group *RouteGroup) *Route {
 func (r *Route) Name(name string) *Route {
 	r.name = combineNames(r.group.name, name)
 	r.group.router.routes[r.name] = r
+	for _, alias := range r.aliases {
+		alias.name = r.name
+	}
+	return r
+}
+
+// Meta sets a metadata item of the route. Middlewares can read it with Ctx.Meta.
+func (r *Route) Meta(key string, value any) *Route {
+	if r.meta == nil {
+		r.meta = make(map[string]any)
+	}
+	r.meta[key] = value
+	for _, alias := range r.aliases {
+		alias.Meta(key, value)
+	}
+	return r
+}
+
+// MetaValue returns the named metadata item of the route, nil if it is not set.
+func (r *Route) MetaValue(key string) any {
+	return r.meta[key]
+}
+
+// Skip makes the route skip the group handlers registered with the given names by RouteGroup.UseNamed.
+func (r *Route) Skip(names ...string) *Route {
+	r.skips = append(r.skips, names...)
+	for _, alias := range r.aliases {
+		alias.Skip(names...)
+	}
 	return r
 }
 
@@ -158,7 +210,12 @@ func (r *Route) URLByNames(names []string) (url string, err error) {
 		if i%2 == 0 {
 			for i1, n1 := range r.paramNames {
 				if n == n1 {
-					if r.regexps[i1] == nil {
+					if m := r.matchers[i1]; m != nil {
+						if m(names[i+1]) != len(names[i+1]) {
+							err = errors.New("param: " + names[i+1] + " doesn't match " + n)
+							return
+						}
+					} else if r.regexps[i1] == nil {
 						if strings.Contains(names[i+1], "/") {
 							err = errors.New(names[i+1] + " contains " + "/")
 							return
@@ -200,6 +257,13 @@ func (r *Route) URLByIndex(params []string) (url string, err error) {
 		return
 	}
 	for i := range params {
+		if m := r.matchers[i]; m != nil {
+			if m(params[i]) != len(params[i]) {
+				err = errors.New("param: " + params[i] + " doesn't match " + r.paramNames[i])
+				return
+			}
+			continue
+		}
 		if r.regexps[i] == nil {
 			if strings.Contains(params[i], "/") {
 				err = errors.New(params[i] + " contains " + "/")
@@ -223,7 +287,7 @@ func (r *Route) URLByIndex(params []string) (url string, err error) {
 	}
 	return
 }
-func buildURLTemplate2(path string) (segments []string, paramNames []string, regexps []*regexp.Regexp) {
+func buildURLTemplate2(path string) (segments []string, paramNames []string, regexps []*regexp.Regexp, ms []ParamMatcher) {
 	start, end := -1, -1
 	for i := 0; i < len(path); i++ {
 		if path[i] == '<' && start < 0 {
@@ -231,10 +295,11 @@ func buildURLTemplate2(path string) (segments []string, paramNames []string, reg
 		} else if path[i] == '>' && start >= 0 {
 			name := path[start+1 : i]
 			var reg *regexp.Regexp
+			var m ParamMatcher
 			for j := start + 1; j < i; j++ {
 				if path[j] == ':' {
 					name = path[start+1 : j]
-					if path[j+1:i] != "" {
+					if m = matchers[path[j+1:i]]; m == nil && path[j+1:i] != "" {
 						reg = regexp.MustCompile(`^` + path[j+1:i])
 					}
 					break
@@ -242,6 +307,7 @@ func buildURLTemplate2(path string) (segments []string, paramNames []string, reg
 			}
 			paramNames = append(paramNames, name)
 			regexps = append(regexps, reg)
+			ms = append(ms, m)
 			segments = append(segments, path[end+1:start], "<"+name+">")
 			end = i
 			start = -1
@@ -7,6 +7,7 @@ package routing
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/newacorn/fasthttp"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"helpers/unsafefn"
 )
 
@@ -25,15 +27,35 @@ type (
 
 	// Router manages routes and dispatches HTTP requests to the handlers of the matching routes.
 	Router struct {
+		// ErrorHandler handles the errors returned by handlers. When it is nil the error message is written
+		// as plain text, with the status code of HTTPError errors or 500 otherwise. See RenderError.
+		ErrorHandler func(c *Ctx, err error)
+		// App 由所有请求的 Ctx.App 共享，默认使用 zerolog 的全局日志器
+		App    *App
 		server *fasthttp.Server
+		// 通过 OnStart/OnShutdown 注册的生命周期钩子
+		onStart    []func() error
+		onShutdown []func(ctx context.Context) error
+		// Shutdown 只执行一次，完成后关闭 shutdownDone
+		shutdownOnce sync.Once
+		shutdownDone chan struct{}
+		shutdownErr  error
 		// 路由组
 		RouteGroup
 		// *Ctx 缓存池
 		pool sync.Pool
 		// 路由路径或路由名称到路由的映射
 		routes map[string]*Route
+		// 按注册顺序保存的路由，供 Routes 列出路由表
+		routeList []*Route
+		// 请求方法 -> 按注册顺序保存的路由路径，用于检测被先注册的路由遮蔽的注册
+		registered map[string][]string
+		// 注册时检测到的冲突，由 Validate 返回
+		conflicts []error
 		// 请求方法 -> routeStore 的映射
 		stores map[string]routeStore
+		// 通过 Router.Host 注册的虚拟主机，按注册顺序匹配
+		hosts []*virtualHost
 		// 在从 Store 中操作路由时，会将 Ctx.pvalues 作为参数传递，变查找变填充。
 		// 而此 pvalues 切片大小就是 maxParams。
 		// 其值在将路由添加到 routeStore 中时进行更新，其值为已注册路径中那个参数数量最大的路由参数数量。
@@ -81,8 +103,11 @@ func New() *Router {
 			LogAllErrors: false,
 			// ErrorHandler: app.serverErrorHandler,
 		},
-		routes: make(map[string]*Route),
-		stores: make(map[string]routeStore),
+		routes:       make(map[string]*Route),
+		stores:       make(map[string]routeStore),
+		registered:   make(map[string][]string),
+		shutdownDone: make(chan struct{}),
+		App:          &App{Log: &log.Logger},
 	}
 	r.server.Handler = r.HandleRequest
 	r.RouteGroup = *newRouteGroup("", r, make([]Handler, 0))
@@ -101,8 +126,14 @@ func New() *Router {
 func (r *Router) HandleRequest(ctx *fasthttp.RequestCtx) {
 	c := r.pool.Get().(*Ctx)
 	c.init(ctx)
-	c.handlers, c.pnames, c.route = r.find(string(ctx.Method()), unsafefn.BtoS(ctx.Path()), c.pvalues)
-	if err := c.Next(); err != nil {
+	c.stores = r.matchHost(c)
+	c.handlers, c.pnames, c.route = r.find(c.stores, string(ctx.Method()), unsafefn.BtoS(ctx.Path()), c.pvalues)
+	err := c.Next()
+	if c.TimedOut() {
+		// the timeout response has been sent, and c may still be used by the handlers which did not finish in time
+		return
+	}
+	if err != nil {
 		r.handleError(c, err)
 	}
 	c.clear()
@@ -121,6 +152,31 @@ func (r *Router) Use(handlers ...Handler) {
 	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
 }
 
+// UseNamed registers a named handler to the router. See RouteGroup.UseNamed.
+func (r *Router) UseNamed(name string, handler Handler) {
+	r.RouteGroup.UseNamed(name, handler)
+	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
+}
+
+// UseExcept registers handlers that are skipped for the requests for which skip returns true.
+// See RouteGroup.UseExcept.
+func (r *Router) UseExcept(skip Skipper, handlers ...Handler) {
+	r.RouteGroup.UseExcept(skip, handlers...)
+	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
+}
+
+// Remove removes the named handlers from the router. See RouteGroup.Remove.
+func (r *Router) Remove(name string) {
+	r.RouteGroup.Remove(name)
+	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
+}
+
+// Replace replaces the named handlers of the router. See RouteGroup.Replace.
+func (r *Router) Replace(name string, handler Handler) {
+	r.RouteGroup.Replace(name, handler)
+	r.notFoundHandlers = combineHandlers(r.handlers, r.notFound)
+}
+
 // NotFound specifies the handlers that should be invoked when the router cannot find any route matching a request.
 // Note that the handlers registered via Use will be invoked first in this case.
 func (r *Router) NotFound(handlers ...Handler) {
@@ -130,7 +186,12 @@ func (r *Router) NotFound(handlers ...Handler) {
 
 // handleError is the error handler for handling any unhandled errors.
 func (r *Router) handleError(c *Ctx, err error) {
-	if httpError, ok := err.(HTTPError); ok {
+	if r.ErrorHandler != nil {
+		r.ErrorHandler(c, err)
+		return
+	}
+	var httpError HTTPError
+	if errors.As(err, &httpError) {
 		c.Error(httpError.Error(), httpError.StatusCode())
 	} else {
 		c.Error(err.Error(), http.StatusInternalServerError)
@@ -143,19 +204,24 @@ type routeData struct {
 }
 
 func (r *Router) add(method, path string, handlers []Handler, route *Route) {
-	store := r.stores[method]
+	r.checkConflict(method, path, route)
+	stores := r.stores
+	if route.group.host != nil {
+		stores = route.group.host.stores
+	}
+	store := stores[method]
 	if store == nil {
 		store = newStore()
-		r.stores[method] = store
+		stores[method] = store
 	}
 	if n := store.Add(path, &routeData{route: route, handlers: handlers}); n > r.maxParams {
 		r.maxParams = n
 	}
 }
 
-func (r *Router) find(method, path string, pvalues []string) (handlers []Handler, pnames []string, route *Route) {
+func (r *Router) find(stores map[string]routeStore, method, path string, pvalues []string) (handlers []Handler, pnames []string, route *Route) {
 	var hh interface{}
-	if store := r.stores[method]; store != nil {
+	if store := stores[method]; store != nil {
 		hh, pnames = store.Get(path, pvalues)
 	}
 	if hh != nil {
@@ -167,7 +233,11 @@ func (r *Router) find(method, path string, pvalues []string) (handlers []Handler
 
 func (r *Router) findAllowedMethods(path string, ctx *Ctx) {
 	// pvalues := make([]string, r.maxParams)
-	for m, store := range r.stores {
+	stores := ctx.stores
+	if stores == nil {
+		stores = r.stores
+	}
+	for m, store := range stores {
 		if handlers, _ := store.Get(path, ctx.pvalues); handlers != nil {
 			ctx.bytes = append(ctx.bytes, m...)
 			ctx.bytes = append(ctx.bytes, ',')
@@ -0,0 +1,269 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo describes a single registered method + path pair.
+type RouteInfo struct {
+	// Host is the pattern passed to Router.Host, empty for routes registered on the router itself.
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	// Params lists the route parameter names in the order they appear in Path.
+	Params []string `json:"params"`
+	// Handlers lists the names of all handlers of the route, group middlewares included.
+	Handlers []string `json:"handlers"`
+	// Meta holds the metadata of the route, see Route.Meta.
+	Meta map[string]any `json:"meta,omitempty"`
+}
+
+// RouteConflictError is reported when a registration can never be matched because an earlier
+// registration with the same method matches every path it matches, e.g. "/users/new" or
+// "/users/<id:int>" registered after "/users/<id>". Patterns which only overlap, like
+// "/users/<id:int>" and "/users/<name>" in this order, are not conflicts.
+type RouteConflictError struct {
+	Method string
+	Path   string
+	// Existing is the path of the route that shadows Path.
+	Existing string
+}
+
+func (e *RouteConflictError) Error() string {
+	return "routing: " + e.Method + " " + e.Path + " is shadowed by " + e.Existing
+}
+
+// Routes returns all registered routes in registration order.
+func (r *Router) Routes() []RouteInfo {
+	infos := make([]RouteInfo, 0, r.routeCount)
+	for _, route := range r.routeList {
+		for i, method := range route.methods {
+			info := RouteInfo{
+				Host:     route.Host(),
+				Method:   method,
+				Path:     route.path,
+				Name:     route.name,
+				Params:   append([]string(nil), route.paramNames...),
+				Handlers: make([]string, len(route.handlers[i])),
+				Meta:     route.meta,
+			}
+			for j, h := range route.handlers[i] {
+				info.Handlers[j] = HandlerName(h)
+			}
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// WriteRoutes writes the route table as aligned text columns.
+func (r *Router) WriteRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "METHOD\tPATH\tNAME\tHANDLERS")
+	for _, info := range r.Routes() {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Method, info.Host+info.Path, info.Name, strings.Join(info.Handlers, ","))
+	}
+	return tw.Flush()
+}
+
+// RoutesHandler responds with the route table encoded as JSON.
+// It is meant to be mounted on an admin endpoint, e.g. admin.Get("/routes", router.RoutesHandler).
+func (r *Router) RoutesHandler(c *Ctx) error {
+	b, err := json.Marshal(r.Routes())
+	if err != nil {
+		return err
+	}
+	c.SetContentType(MIMEApplicationJSONCharsetUTF8)
+	_, err = c.Write(b)
+	return err
+}
+
+// Tree dumps the radix tree of the given method.
+// An empty string is returned if no route is registered with the method.
+// Routes registered through Router.Host are dumped by passing the host pattern as well.
+func (r *Router) Tree(method string, host ...string) string {
+	stores := r.stores
+	if len(host) > 0 {
+		stores = nil
+		for _, h := range r.hosts {
+			if h.pattern == host[0] {
+				stores = h.stores
+			}
+		}
+	}
+	if store := stores[method]; store != nil {
+		return store.String()
+	}
+	return ""
+}
+
+// Validate returns the conflicts detected while registering routes, joined into a single error,
+// see RouteConflictError. Nil is returned if every registration is reachable.
+func (r *Router) Validate() error {
+	return errors.Join(r.conflicts...)
+}
+
+// HandlerName returns the fully qualified function name of the handler.
+func HandlerName(h Handler) string {
+	if h == nil {
+		return ""
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(h).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// checkConflict records a RouteConflictError if an earlier registration with the same method
+// matches every path the new one matches. The store resolves a path matched by several
+// registrations to the earliest one, so the new registration would never be reached.
+func (r *Router) checkConflict(method, path string, route *Route) {
+	key := method
+	if host := route.group.host; host != nil {
+		key = host.pattern + " " + key
+	}
+	for _, existing := range r.registered[key] {
+		if covers(existing, path) {
+			r.conflicts = append(r.conflicts, &RouteConflictError{Method: method, Path: path, Existing: existing})
+			return
+		}
+	}
+	r.registered[key] = append(r.registered[key], path)
+}
+
+// covers reports whether the route path earlier matches every request path matched by later.
+// A param token without pattern covers a static segment or a param token of a single segment,
+// a param token with a pattern covers the static segments it matches, and a trailing .* param
+// token covers the rest of the path. Other segments must be identical.
+func covers(earlier, later string) bool {
+	if routeSignature(earlier) == routeSignature(later) {
+		return true
+	}
+	es, ls := splitSegments(earlier), splitSegments(later)
+	for i, e := range es {
+		pattern, isParam := paramToken(e)
+		if isParam && pattern == ".*" {
+			// the store gives the rest of the path to a .* param token
+			return i == len(es)-1 && len(ls) >= len(es)
+		}
+		if i >= len(ls) {
+			return false
+		}
+		l := ls[i]
+		if !isParam {
+			if routeSignature(e) != routeSignature(l) {
+				return false
+			}
+			continue
+		}
+		lpattern, lIsParam := paramToken(l)
+		switch {
+		case lIsParam:
+			if lpattern != pattern && !(isAnySegment(pattern) && inSegment(lpattern)) {
+				return false
+			}
+		case strings.IndexByte(l, '<') >= 0:
+			// a static string and a param token in the same segment
+			return false
+		case !matchesSegment(pattern, l):
+			return false
+		}
+	}
+	return len(es) == len(ls)
+}
+
+// splitSegments splits a route path on the slashes which are not in param tokens.
+func splitSegments(path string) (segments []string) {
+	start, inToken := 0, false
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '<':
+			inToken = true
+		case '>':
+			inToken = false
+		case '/':
+			if !inToken {
+				segments = append(segments, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// paramToken returns the pattern of the segment if it is made of a single param token.
+func paramToken(segment string) (pattern string, ok bool) {
+	if len(segment) < 2 || segment[0] != '<' || segment[len(segment)-1] != '>' ||
+		strings.IndexByte(segment[1:], '<') >= 0 {
+		return "", false
+	}
+	if i := strings.IndexByte(segment, ':'); i >= 0 {
+		pattern = segment[i+1 : len(segment)-1]
+	}
+	if pattern == "[^/]*" {
+		pattern = ""
+	}
+	return pattern, true
+}
+
+// isAnySegment reports whether a param token with the pattern matches any segment.
+func isAnySegment(pattern string) bool {
+	return pattern == ""
+}
+
+// inSegment reports whether the matches of a param token with the pattern never contain a slash,
+// conservatively for regular expressions.
+func inSegment(pattern string) bool {
+	if _, ok := matchers[pattern]; ok || pattern == "" {
+		return true
+	}
+	return !strings.ContainsAny(pattern, "./") && !strings.Contains(pattern, "[^") &&
+		!strings.Contains(pattern, `\S`) && !strings.Contains(pattern, `\W`) && !strings.Contains(pattern, `\D`)
+}
+
+// matchesSegment reports whether a param token with the pattern matches the whole static segment.
+func matchesSegment(pattern, segment string) bool {
+	if pattern == "" {
+		return true
+	}
+	if m, ok := matchers[pattern]; ok {
+		return m(segment) == len(segment)
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	return err == nil && re.MatchString(segment)
+}
+
+// routeSignature strips parameter names from a route path: /users/<id:\d+>/<name:[^/]*> -> /users/<:\d+>/<>
+func routeSignature(path string) string {
+	var b strings.Builder
+	start := -1
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '<' && start < 0:
+			start = i
+		case path[i] == '>' && start >= 0:
+			b.WriteByte('<')
+			// [^/]* is what a param token without pattern matches
+			if j := strings.IndexByte(path[start:i], ':'); j >= 0 && path[start+j:i] != ":[^/]*" {
+				b.WriteString(path[start+j : i])
+			}
+			b.WriteByte('>')
+			start = -1
+		case start < 0:
+			b.WriteByte(path[i])
+		}
+	}
+	if start >= 0 {
+		b.WriteString(path[start:])
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package routing
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listUsers(*Ctx) error { return nil }
+
+func TestRouterRoutes(t *testing.T) {
+	router := New()
+	var buf bytes.Buffer
+	api := router.Group("/api", newHandler("m", &buf))
+	api.Get("/users", listUsers).Name("users")
+	api.To("GET,POST", `/users/<id:\d+>/<action>`, listUsers)
+
+	routes := router.Routes()
+	assert.Equal(t, 3, len(routes))
+	assert.Equal(t, RouteInfo{
+		Method:   "GET",
+		Path:     "/api/users",
+		Name:     "users",
+		Params:   nil,
+		Handlers: []string{HandlerName(newHandler("m", &buf)), "fasthttp-routing.listUsers"},
+	}, routes[0])
+	assert.Equal(t, "POST", routes[2].Method)
+	assert.Equal(t, `/api/users/<id:\d+>/<action>`, routes[2].Path)
+	assert.Equal(t, []string{"id", "action"}, routes[2].Params)
+
+	buf.Reset()
+	assert.Nil(t, router.WriteRoutes(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 4, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "METHOD"))
+
+	assert.NotEqual(t, "", router.Tree("GET"))
+	assert.Equal(t, "", router.Tree("PATCH"))
+}
+
+func TestRouterConflicts(t *testing.T) {
+	router := New()
+	router.Get("/users/<id>", listUsers)
+	router.Post("/users/<name>", listUsers)
+	router.Get(`/users/<id:\d+>`, listUsers)
+	router.Get("/users/new", listUsers)
+	router.Get("/users/<id:int>", listUsers)
+	conflicts := router.conflicts
+	if assert.Len(t, conflicts, 3) {
+		for i, path := range []string{`/users/<id:\d+>`, "/users/new", "/users/<id:int>"} {
+			var conflict *RouteConflictError
+			assert.True(t, errors.As(conflicts[i], &conflict))
+			assert.Equal(t, "GET", conflict.Method)
+			assert.Equal(t, path, conflict.Path)
+			assert.Equal(t, "/users/<id>", conflict.Existing)
+		}
+	}
+
+	router.Get("/users/<name>/profile", listUsers)
+	router.Get("/users/<id>/profile", listUsers)
+	err := router.Validate()
+	var conflict *RouteConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Len(t, router.conflicts, 4)
+	conflict = router.conflicts[3].(*RouteConflictError)
+	assert.Equal(t, "/users/<id>/profile", conflict.Path)
+	assert.Equal(t, "/users/<name>/profile", conflict.Existing)
+
+	// a param token with the default pattern spelled out
+	router = New()
+	router.Get("/items/<id>", listUsers)
+	router.Get("/items/<x:[^/]*>", listUsers)
+	assert.True(t, errors.As(router.Validate(), &conflict))
+	assert.Equal(t, "/items/<x:[^/]*>", conflict.Path)
+
+	// narrower routes first only overlap
+	router = New()
+	router.Get("/users/new", listUsers)
+	router.Get("/users/<id:int>", listUsers)
+	router.Get("/users/<name>", listUsers)
+	router.Get("/users/<name>/<path:.*>", listUsers)
+	router.Get("/files/<id:int>", listUsers)
+	router.Get("/files/readme", listUsers)
+	assert.Nil(t, router.Validate())
+
+	// a trailing .* param token covers the rest of the path
+	router = New()
+	router.Get("/static/*", listUsers)
+	router.Get("/static/css/<name>", listUsers)
+	router.Get("/static", listUsers)
+	assert.True(t, errors.As(router.Validate(), &conflict))
+	assert.Len(t, router.conflicts, 1)
+	assert.Equal(t, "/static/css/<name>", conflict.Path)
+	assert.Equal(t, "/static/<*:.*>", conflict.Existing)
+
+	// a constrained param token covers the static segments it matches
+	router = New()
+	router.Get("/files/<id:int>", listUsers)
+	router.Get("/files/42", listUsers)
+	router.Get(`/files/<name:[a-z]+>`, listUsers)
+	router.Get(`/pages/<n:\d+>`, listUsers)
+	router.Get("/pages/7", listUsers)
+	assert.Len(t, router.conflicts, 2)
+}
+
+func TestRouteSignature(t *testing.T) {
+	tests := []struct {
+		path, expected string
+	}{
+		{"", ""},
+		{"/users", "/users"},
+		{"/users/<id>", "/users/<>"},
+		{`/users/<id:\d+>/<name>`, `/users/<:\d+>/<>`},
+		{"/all/<*:.*>", "/all/<:.*>"},
+		{"/users/<id", "/users/<id"},
+		{"/users/<x:[^/]*>", "/users/<>"},
+		{"/users/<id:int>", "/users/<:int>"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, routeSignature(test.path), "routeSignature("+test.path+") =")
+	}
+}
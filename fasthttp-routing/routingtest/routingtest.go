@@ -0,0 +1,75 @@
+// Package routingtest provides assertions on the responses read by routing.TestClient.
+// It is kept apart from package routing so that applications do not link package testing.
+//
+//	res, err := router.TestClient().Get("/profile").Do()
+//	routingtest.Expect(t, res).Status(http.StatusOK).JSON(map[string]any{"name": "acorn"})
+package routingtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	routing "fasthttp-routing"
+)
+
+// Response checks a routing.TestResponse. Every assertion reports the failure with t.Errorf
+// and returns the Response for chaining.
+type Response struct {
+	t   testing.TB
+	res *routing.TestResponse
+}
+
+// Expect returns a Response reporting the failed assertions on res to t.
+func Expect(t testing.TB, res *routing.TestResponse) *Response {
+	return &Response{t: t, res: res}
+}
+
+// Status checks the status code of the response.
+func (r *Response) Status(status int) *Response {
+	r.t.Helper()
+	if r.res.StatusCode() != status {
+		r.t.Errorf("test: status code: want %d; got %d", status, r.res.StatusCode())
+	}
+	return r
+}
+
+// Header checks the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := string(r.res.Header.Peek(key)); got != value {
+		r.t.Errorf("test: header %s: want %q; got %q", key, value, got)
+	}
+	return r
+}
+
+// Body checks the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := string(r.res.Body()); got != body {
+		r.t.Errorf("test: body: want %q; got %q", body, got)
+	}
+	return r
+}
+
+// JSON checks that the response body and expected encode the same JSON value,
+// regardless of key order and white spaces.
+func (r *Response) JSON(expected any) *Response {
+	r.t.Helper()
+	b, err := json.Marshal(expected)
+	if err != nil {
+		r.t.Errorf("test: failed to encode expected json: %v", err)
+		return r
+	}
+	var want, got any
+	_ = json.Unmarshal(b, &want)
+	if err = json.Unmarshal(r.res.Body(), &got); err != nil {
+		r.t.Errorf("test: body is not json: %v: %q", err, r.res.Body())
+		return r
+	}
+	if !reflect.DeepEqual(want, got) {
+		r.t.Errorf("test: json body: want %s; got %s", b, bytes.TrimSpace(r.res.Body()))
+	}
+	return r
+}
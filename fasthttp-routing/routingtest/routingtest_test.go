@@ -0,0 +1,120 @@
+package routingtest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/routingtest"
+	"github.com/newacorn/fasthttp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestClient(t *testing.T) {
+	router := routing.New()
+	router.Post("/login", func(c *routing.Ctx) error {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(c.PostBody(), &body); err != nil {
+			return routing.NewHTTPError(http.StatusBadRequest)
+		}
+		c.Response.Header.SetCookie(newCookie("user", body.Name, 3600))
+		c.SetStatusCode(http.StatusCreated)
+		return nil
+	})
+	router.To("GET,HEAD", "/me", func(c *routing.Ctx) error {
+		c.Response.Header.Set("X-Remote", c.RemoteIP().String())
+		b, _ := json.Marshal(map[string]any{"user": string(c.Request.Header.Cookie("user")), "tls": c.IsTLS()})
+		c.SetContentType(routing.MIMEApplicationJSON)
+		_, err := c.Write(b)
+		return err
+	})
+	router.Post("/logout", func(c *routing.Ctx) error {
+		c.Response.Header.SetCookie(newCookie("user", "", -1))
+		return nil
+	})
+
+	// the server is supplied by the caller and keeps its own options
+	server := &fasthttp.Server{Name: "test"}
+	client := router.TestClient(server)
+
+	res, err := client.Post("/login").JSON(map[string]string{"name": "acorn"}).Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(http.StatusCreated).Header("Server", "test")
+	assert.Equal(t, "acorn", string(res.Cookie("user").Value()))
+	assert.Equal(t, "acorn", string(client.Jar["user"].Value()))
+
+	res, err = client.Get("/me").RemoteIP("10.0.0.1").TLS().Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(http.StatusOK).
+		Header("X-Remote", "10.0.0.1").
+		JSON(map[string]any{"tls": true, "user": "acorn"})
+
+	res, err = client.Get("/me").Cookie("user", "other").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).JSON(map[string]any{"user": "other", "tls": false})
+
+	res, err = client.Post("/logout").Do()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(client.Jar))
+	res, err = client.Get("/me").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).JSON(map[string]any{"user": "", "tls": false})
+
+	res, err = client.Head("/me").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(http.StatusOK).Body("")
+
+	res, err = client.Post("/login").Body([]byte("{")).Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(http.StatusBadRequest)
+
+	_, err = client.Get("/").RemoteIP("bad").Do()
+	assert.NotNil(t, err)
+}
+
+func newCookie(key, value string, maxAge int) *fasthttp.Cookie {
+	c := &fasthttp.Cookie{}
+	c.SetKey(key)
+	c.SetValue(value)
+	c.SetMaxAge(maxAge)
+	return c
+}
+
+// recorder is a testing.TB keeping the failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectFailures(t *testing.T) {
+	router := routing.New()
+	router.Get("/", func(c *routing.Ctx) error {
+		c.Response.Header.Set("X-Test", "a")
+		c.SetBodyString(`{"a":1}`)
+		return nil
+	})
+	res, err := router.TestClient().Get("/").Do()
+	assert.Nil(t, err)
+
+	rec := &recorder{TB: t}
+	routingtest.Expect(rec, res).Status(http.StatusOK).Header("X-Test", "a").JSON(map[string]int{"a": 1})
+	assert.Empty(t, rec.errors)
+
+	routingtest.Expect(rec, res).Status(http.StatusNotFound).Header("X-Test", "b").Body("").JSON(map[string]int{"a": 2})
+	assert.Equal(t, []string{
+		"test: status code: want 404; got 200",
+		`test: header X-Test: want "b"; got "a"`,
+		`test: body: want ""; got "{\"a\":1}"`,
+		`test: json body: want {"a":2}; got {"a":1}`,
+	}, rec.errors)
+}
@@ -0,0 +1,278 @@
+package routing
+
+import (
+	"bufio"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a server-sent event, see https://html.spec.whatwg.org/multipage/server-sent-events.html.
+type Event struct {
+	// ID 事件ID，客户端重连时通过 Last-Event-ID 头部带回
+	ID string
+	// Event 事件类型，为空时客户端触发 message 事件
+	Event string
+	// Data 事件数据，包含换行时被拆分为多个 data 行
+	Data string
+	// Retry 大于 0 时通知客户端断线后的重连间隔
+	Retry time.Duration
+}
+
+var (
+	// ErrStreamClosed is returned when writing to an EventStream whose client has disconnected.
+	ErrStreamClosed = errors.New("routing: event stream closed")
+
+	errInvalidEventField = errors.New("routing: event id and type must not contain line breaks")
+)
+
+// ReplayBuffer keeps recent events so that a reconnecting client can resume from the
+// Last-Event-ID it sends. Producers add events to the buffer, and Ctx.SSE replays the
+// events following the Last-Event-ID before calling the stream function.
+// Implementations must be safe for concurrent use.
+type ReplayBuffer interface {
+	// Add appends the event to the buffer.
+	Add(e *Event)
+	// Since returns the events added after the event with the given id.
+	// ok is false if the id is unknown, e.g. it has been evicted.
+	Since(id string) (events []*Event, ok bool)
+}
+
+// MemoryReplay is a ReplayBuffer keeping the last size events in memory.
+type MemoryReplay struct {
+	mu     sync.Mutex
+	events []*Event
+	size   int
+}
+
+// NewMemoryReplay creates a MemoryReplay keeping at most size events.
+// It panics if size is not positive.
+func NewMemoryReplay(size int) *MemoryReplay {
+	if size <= 0 {
+		panic("routing: replay size must be positive, got " + strconv.Itoa(size))
+	}
+	return &MemoryReplay{size: size, events: make([]*Event, 0, size)}
+}
+
+// Add appends the event and evicts the oldest one when the buffer is full.
+func (m *MemoryReplay) Add(e *Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) == m.size {
+		copy(m.events, m.events[1:])
+		m.events = m.events[:m.size-1]
+	}
+	m.events = append(m.events, e)
+}
+
+// Since returns the events added after the event with the given id.
+func (m *MemoryReplay) Since(id string) ([]*Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.events) - 1; i >= 0; i-- {
+		if m.events[i].ID == id {
+			return append([]*Event(nil), m.events[i+1:]...), true
+		}
+	}
+	return nil, false
+}
+
+type SSEConfig struct {
+	// Heartbeat 心跳注释的发送间隔，用于保持连接并检测客户端断开，默认 15 秒；小于 0 表示不发送
+	Heartbeat time.Duration
+	// Retry 大于 0 时在流的开头发送 retry 字段
+	Retry time.Duration
+	// Replay 不为 nil 时，根据请求的 Last-Event-ID 头部补发错过的事件；该 id 已不在缓冲中时不补发，见 EventStream.Resumed
+	Replay ReplayBuffer
+}
+
+var DefSSECfg = SSEConfig{
+	Heartbeat: 15 * time.Second,
+}
+
+// EventStream writes server-sent events to a client, see Ctx.SSE.
+// Its methods are safe for concurrent use.
+type EventStream struct {
+	mu          sync.Mutex
+	w           *bufio.Writer
+	lastEventID string
+	resumed     bool
+	done        chan struct{}
+	closed      bool
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client, empty for a new client.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Resumed reports whether the events following LastEventID have been replayed from
+// SSEConfig.Replay. It is false for a new client, and for a reconnecting client whose
+// Last-Event-ID is not in the buffer anymore: that client missed events which can not be
+// replayed, so the stream function should send it the full state instead.
+func (s *EventStream) Resumed() bool {
+	return s.resumed
+}
+
+// Done returns a channel that is closed when the client disconnects.
+// A disconnect is noticed when a write fails, at the latest with the next heartbeat.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send writes the event and flushes it to the client.
+func (s *EventStream) Send(e *Event) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return errInvalidEventField
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if e.ID != "" {
+		s.writeField("id", e.ID)
+	}
+	if e.Event != "" {
+		s.writeField("event", e.Event)
+	}
+	if e.Retry > 0 {
+		s.writeField("retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		s.writeField("data", line)
+	}
+	_ = s.w.WriteByte('\n')
+	return s.flush()
+}
+
+// Comment writes a comment line, which is ignored by clients, and flushes it.
+func (s *EventStream) Comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	for _, line := range strings.Split(text, "\n") {
+		_, _ = s.w.WriteString(":" + line + "\n")
+	}
+	_ = s.w.WriteByte('\n')
+	return s.flush()
+}
+
+func (s *EventStream) writeField(name, value string) {
+	_, _ = s.w.WriteString(name)
+	_, _ = s.w.WriteString(": ")
+	_, _ = s.w.WriteString(value)
+	_ = s.w.WriteByte('\n')
+}
+
+// flush flushes the buffered frames, s.mu must be held.
+// A failed flush means the client is gone and closes the stream.
+func (s *EventStream) flush() error {
+	if err := s.w.Flush(); err != nil {
+		s.close()
+		return ErrStreamClosed
+	}
+	return nil
+}
+
+// close closes the stream, s.mu must be held.
+func (s *EventStream) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
+
+// SSE responds with a stream of server-sent events written by fn.
+// fn is called after the handler chain returns, from the goroutine serving the connection,
+// so it must not access the Ctx; the stream ends when fn returns. Errors returned by fn are
+// logged, except ErrStreamClosed. A typical fn forwards events until the client disconnects:
+//
+//	return c.SSE(func(stream *routing.EventStream) error {
+//		for {
+//			select {
+//			case e := <-events:
+//				if err := stream.Send(e); err != nil {
+//					return err
+//				}
+//			case <-stream.Done():
+//				return nil
+//			}
+//		}
+//	})
+//
+// Responses with the text/event-stream content type are not compressed by the compress middleware.
+func (c *Ctx) SSE(fn func(stream *EventStream) error, cfgs ...*SSEConfig) error {
+	cfg := &DefSSECfg
+	if len(cfgs) > 0 && cfgs[0] != nil {
+		cfg = cfgs[0]
+	}
+	c.SetContentType(MIMETextEventStream)
+	c.Response.Header.Set(HeaderCacheControl, "no-cache")
+	// disable response buffering of nginx
+	c.Response.Header.Set("X-Accel-Buffering", "no")
+	lastEventID := string(c.Request.Header.Peek(HeaderLastEventID))
+	// the Ctx is released before the stream ends, keep the request logger
+	logger := c.Log()
+
+	c.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s := &EventStream{w: w, lastEventID: lastEventID, done: make(chan struct{})}
+		stop := make(chan struct{})
+		defer func() {
+			close(stop)
+			s.mu.Lock()
+			s.close()
+			s.mu.Unlock()
+		}()
+		if cfg.Retry > 0 {
+			s.mu.Lock()
+			s.writeField("retry", strconv.FormatInt(cfg.Retry.Milliseconds(), 10))
+			_ = s.w.WriteByte('\n')
+			_ = s.flush()
+			s.mu.Unlock()
+		}
+		if cfg.Replay != nil && lastEventID != "" {
+			var events []*Event
+			events, s.resumed = cfg.Replay.Since(lastEventID)
+			for _, e := range events {
+				if s.Send(e) != nil {
+					return
+				}
+			}
+		}
+		if cfg.Heartbeat >= 0 {
+			interval := cfg.Heartbeat
+			if interval == 0 {
+				interval = DefSSECfg.Heartbeat
+			}
+			go s.heartbeat(interval, stop)
+		}
+		if err := fn(s); err != nil && !errors.Is(err, ErrStreamClosed) {
+			logger.Error().Err(err).Msg("routing: event stream")
+		}
+	})
+	return nil
+}
+
+// heartbeat writes an empty comment every interval until stop is closed or the client disconnects.
+func (s *EventStream) heartbeat(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.Comment("") != nil {
+				return
+			}
+		case <-stop:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package routing_test
+
+import (
+	"strings"
+	"testing"
+
+	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/compress"
+	"fasthttp-routing/routingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSSECompress checks that event streams are not compressed, the compress middleware
+// buffering the whole body before writing it.
+func TestSSECompress(t *testing.T) {
+	data := strings.Repeat("compressible ", 1000)
+	router := routing.New()
+	router.Use(compress.New())
+	router.Get("/events", func(c *routing.Ctx) error {
+		return c.SSE(func(stream *routing.EventStream) error {
+			return stream.Send(&routing.Event{Data: data})
+		}, &routing.SSEConfig{Heartbeat: -1})
+	})
+	router.Get("/text", func(c *routing.Ctx) error {
+		c.SetContentType(routing.MIMETextPlainCharsetUTF8)
+		c.SetBodyString(data)
+		return nil
+	})
+
+	client := router.TestClient()
+	res, err := client.Get("/events").Header(routing.HeaderAcceptEncoding, "gzip").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusOK).
+		Header(routing.HeaderContentEncoding, "").
+		Header(routing.HeaderContentType, routing.MIMETextEventStream).
+		Body("data: " + data + "\n\n")
+
+	// the middleware is effective on other responses
+	res, err = client.Get("/text").Header(routing.HeaderAcceptEncoding, "gzip").Do()
+	assert.Nil(t, err)
+	routingtest.Expect(t, res).Status(routing.StatusOK).Header(routing.HeaderContentEncoding, "gzip")
+}
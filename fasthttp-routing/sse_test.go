@@ -0,0 +1,113 @@
+package routing
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/newacorn/fasthttp/fasthttputil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSE(t *testing.T) {
+	replay := NewMemoryReplay(2)
+	for i := 1; i <= 3; i++ {
+		replay.Add(&Event{ID: strconv.Itoa(i), Data: "replayed " + strconv.Itoa(i)})
+	}
+	router := New()
+	router.Get("/events", func(c *Ctx) error {
+		return c.SSE(func(stream *EventStream) error {
+			assert.True(t, stream.Resumed())
+			assert.Nil(t, stream.Comment("last "+stream.LastEventID()))
+			assert.Equal(t, errInvalidEventField, stream.Send(&Event{ID: "a\nb"}))
+			return stream.Send(&Event{ID: "4", Event: "update", Data: "line1\r\nline2\n", Retry: time.Second})
+		}, &SSEConfig{Retry: 3 * time.Second, Replay: replay, Heartbeat: -1})
+	})
+
+	res, err := router.TestClient().Get("/events").Header(HeaderLastEventID, "2").Do()
+	assert.Nil(t, err)
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, MIMETextEventStream, string(res.Header.Peek(HeaderContentType)))
+	assert.Equal(t, "no-cache", string(res.Header.Peek(HeaderCacheControl)))
+	assert.Equal(t, "retry: 3000\n\n"+
+		"id: 3\ndata: replayed 3\n\n"+
+		":last 2\n\n"+
+		"id: 4\nevent: update\nretry: 1000\ndata: line1\ndata: line2\ndata: \n\n", string(res.Body()))
+
+	events, ok := replay.Since("1")
+	assert.False(t, ok, "evicted")
+	assert.Nil(t, events)
+
+	assert.Panics(t, func() { NewMemoryReplay(0) })
+}
+
+func TestSSEResumed(t *testing.T) {
+	replay := NewMemoryReplay(1)
+	replay.Add(&Event{ID: "2", Data: "replayed"})
+	router := New()
+	router.Get("/events", func(c *Ctx) error {
+		return c.SSE(func(stream *EventStream) error {
+			if stream.Resumed() {
+				return stream.Send(&Event{Data: "resumed"})
+			}
+			return stream.Send(&Event{Data: "full state"})
+		}, &SSEConfig{Replay: replay, Heartbeat: -1})
+	})
+	client := router.TestClient()
+	for _, tc := range []struct{ lastEventID, body string }{
+		{"", "data: full state\n\n"},
+		{"1", "data: full state\n\n"},
+		{"2", "data: resumed\n\n"},
+	} {
+		res, err := client.Get("/events").Header(HeaderLastEventID, tc.lastEventID).Do()
+		assert.Nil(t, err)
+		assert.Equal(t, tc.body, string(res.Body()), tc.lastEventID)
+	}
+}
+
+func TestSSEDisconnect(t *testing.T) {
+	router := New()
+	sent := make(chan struct{})
+	done := make(chan error, 1)
+	router.Get("/events", func(c *Ctx) error {
+		return c.SSE(func(stream *EventStream) error {
+			_ = stream.Send(&Event{Data: "hello"})
+			close(sent)
+			<-stream.Done()
+			done <- stream.Send(&Event{Data: "gone"})
+			return nil
+		}, &SSEConfig{Heartbeat: 10 * time.Millisecond})
+	})
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go func() {
+		_ = (&fasthttp.Server{Handler: router.HandleRequest}).Serve(ln)
+	}()
+
+	conn, err := ln.Dial()
+	assert.Nil(t, err)
+	_, err = conn.Write([]byte("GET /events HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.Nil(t, err)
+	br := bufio.NewReader(conn)
+	var head strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		assert.Nil(t, err)
+		head.WriteString(line)
+		if strings.Contains(head.String(), "data: hello") {
+			break
+		}
+	}
+	<-sent
+	_ = conn.Close()
+
+	select {
+	case err = <-done:
+		assert.Equal(t, ErrStreamClosed, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("disconnect not detected")
+	}
+}
@@ -0,0 +1,137 @@
+package routing
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newacorn/fasthttp"
+)
+
+type StaticConfig struct {
+	// IndexNames 访问目录时依次尝试的索引文件，默认为 index.html
+	IndexNames []string
+	// Browse 目录下没有索引文件时生成目录列表，默认关闭(返回 403)
+	Browse bool
+	// ByteRange 支持 Range 请求
+	ByteRange bool
+	// Compress 根据 Accept-Encoding 返回 gzip/brotli 压缩版本
+	// 与文件同目录的 .gz/.br 文件作为预压缩版本优先使用
+	Compress bool
+	// SPA 未找到的非静态资源路径(最后一段不含扩展名)返回根目录的第一个索引文件，用于前端路由
+	SPA bool
+	// MaxAge 大于 0 时设置 Cache-Control: public, max-age
+	MaxAge time.Duration
+	// CacheDuration 打开的文件句柄的缓存时间，默认为 fasthttp.FSHandlerCacheDuration
+	CacheDuration time.Duration
+}
+
+var DefStaticCfg = StaticConfig{
+	IndexNames: []string{"index.html"},
+}
+
+// Static serves the files under the root directory for GET and HEAD requests under the given
+// path prefix, e.g. group.Static("/assets", "./public") serves "./public/app.js" for "/assets/app.js".
+// The handlers of the group, and the optional handlers given here, are executed before the file
+// is served, so group middlewares such as authentication apply to static files as well.
+// Missing files are reported with ErrNotFound and rendered like other routing errors.
+// The name, metadata and skipped handlers set on the returned Route apply to the file requests too.
+func (r *RouteGroup) Static(prefix, root string, cfg *StaticConfig, handlers ...Handler) *Route {
+	return r.static(prefix, &fasthttp.FS{Root: root}, cfg, handlers)
+}
+
+// StaticFS is like Static, but serves the files of fsys, e.g. an embed.FS for single-binary deploys:
+//
+//	//go:embed dist
+//	var dist embed.FS
+//
+//	sub, _ := fs.Sub(dist, "dist")
+//	router.StaticFS("/", sub, &routing.StaticConfig{SPA: true})
+func (r *RouteGroup) StaticFS(prefix string, fsys fs.FS, cfg *StaticConfig, handlers ...Handler) *Route {
+	return r.static(prefix, &fasthttp.FS{FS: rootFS{fsys}}, cfg, handlers)
+}
+
+// rootFS fixes up the names fasthttp.FS asks for when the root of the prefix is requested:
+// the root directory is asked for with the empty name, and its index files with a leading slash.
+type rootFS struct {
+	fs.FS
+}
+
+func (f rootFS) Open(name string) (fs.File, error) {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "."
+	}
+	return f.FS.Open(name)
+}
+
+func (r *RouteGroup) static(prefix string, fsys *fasthttp.FS, cfg *StaticConfig, handlers []Handler) *Route {
+	if cfg == nil {
+		cfg = &DefStaticCfg
+	}
+	prefix = strings.TrimRight(prefix, "/")
+	strip := len(r.prefix + prefix)
+	rewrite := func(ctx *fasthttp.RequestCtx) []byte {
+		p := ctx.Path()
+		if len(p) > strip {
+			return p[strip:]
+		}
+		return []byte{'/'}
+	}
+	indexNames := cfg.IndexNames
+	if len(indexNames) == 0 {
+		indexNames = DefStaticCfg.IndexNames
+	}
+	fsys.IndexNames = indexNames
+	fsys.GenerateIndexPages = cfg.Browse
+	fsys.AcceptByteRange = cfg.ByteRange
+	fsys.Compress = cfg.Compress
+	fsys.CompressBrotli = cfg.Compress
+	fsys.CacheDuration = cfg.CacheDuration
+	fsys.PathRewrite = rewrite
+	fsys.PathNotFound = func(ctx *fasthttp.RequestCtx) {}
+	h := fsys.NewRequestHandler()
+
+	var cacheControl string
+	if cfg.MaxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	index := []byte("/" + indexNames[0])
+	hh := append(handlers[:len(handlers):len(handlers)], func(c *Ctx) error {
+		h(c.RequestCtx)
+		if c.Response.StatusCode() == StatusNotFound {
+			p := rewrite(c.RequestCtx)
+			if !cfg.SPA || bytes.Equal(p, index) || path.Ext(string(p)) != "" {
+				c.Response.ResetBody()
+				return ErrNotFound
+			}
+			// serve the index file of the root for the paths handled by the frontend router
+			uri := c.Request.URI()
+			original := append([]byte(nil), uri.Path()...)
+			uri.SetPath(r.prefix + prefix + string(index))
+			c.Response.SetStatusCode(StatusOK)
+			h(c.RequestCtx)
+			uri.SetPathBytes(original)
+			if c.Response.StatusCode() == StatusNotFound {
+				c.Response.ResetBody()
+				return ErrNotFound
+			}
+			return nil
+		}
+		if cacheControl != "" && c.Response.StatusCode() == StatusOK {
+			c.Response.Header.Set(HeaderCacheControl, cacheControl)
+		}
+		return nil
+	})
+	files := r.To("GET,HEAD", prefix+"/*", hh...)
+	root := prefix
+	if root == "" {
+		root = "/"
+	}
+	route := r.To("GET,HEAD", root, hh...)
+	route.aliases = append(route.aliases, files)
+	return route
+}
@@ -0,0 +1,132 @@
+package routing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteGroupStatic(t *testing.T) {
+	root := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "sub"), 0o755))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>index</h1>"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "app.js"), []byte(strings.Repeat("console.log('app');", 100)), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0o644))
+
+	router := New()
+	admin := router.Group("/admin", func(c *Ctx) error {
+		if len(c.Request.Header.Peek(HeaderAuthorization)) == 0 {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	admin.Static("/assets/", root, &StaticConfig{ByteRange: true, Compress: true, MaxAge: time.Hour})
+	router.Static("/files", root, &StaticConfig{Browse: true})
+	client := router.TestClient()
+	get := func(uri string) *TestRequest {
+		return client.Get(uri).Header(HeaderAuthorization, "Bearer token")
+	}
+
+	res, _ := client.Get("/admin/assets/app.js").Do()
+	assert.Equal(t, StatusUnauthorized, res.StatusCode())
+
+	res, _ = get("/admin/assets/app.js").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, strings.Repeat("console.log('app');", 100), string(res.Body()))
+	assert.Equal(t, "public, max-age=3600", string(res.Header.Peek(HeaderCacheControl)))
+	res, _ = get("/admin/assets").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "<h1>index</h1>", string(res.Body()))
+	res, _ = get("/admin/assets/").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "<h1>index</h1>", string(res.Body()))
+	res, _ = get("/admin/assets/sub/").Do()
+	assert.Equal(t, StatusForbidden, res.StatusCode())
+	res, _ = get("/admin/assets/missing.js").Do()
+	assert.Equal(t, StatusNotFound, res.StatusCode())
+	assert.Equal(t, "Not Found", string(res.Body()))
+	res, _ = get("/admin/assets/app.js").Header(HeaderRange, "bytes=0-6").Do()
+	assert.Equal(t, StatusPartialContent, res.StatusCode())
+	assert.Equal(t, "console", string(res.Body()))
+	res, _ = get("/admin/assets/app.js").Header(HeaderAcceptEncoding, "gzip").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "gzip", string(res.Header.Peek(HeaderContentEncoding)))
+	body, err := res.BodyGunzip()
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("console.log('app');", 100), string(body))
+
+	res, _ = client.Get("/files/sub/").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Contains(t, string(res.Body()), "a.txt")
+	res, _ = client.Head("/files/sub/a.txt").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "", string(res.Body()))
+}
+
+func TestRouteGroupStaticMeta(t *testing.T) {
+	root := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>index</h1>"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "app.js"), []byte("app"), 0o644))
+
+	router := New()
+	router.UseNamed("auth", func(c *Ctx) error {
+		return ErrUnauthorized
+	})
+	router.Use(func(c *Ctx) error {
+		c.Response.Header.Set("X-Meta", fmt.Sprint(c.Meta("public")))
+		c.Response.Header.Set("X-Route", c.Route().RouteName())
+		return nil
+	})
+	router.Static("/assets", root, nil).Name("assets").Meta("public", true).Skip("auth")
+	client := router.TestClient()
+
+	for _, uri := range []string{"/assets", "/assets/app.js"} {
+		res, _ := client.Get(uri).Do()
+		assert.Equal(t, StatusOK, res.StatusCode(), uri)
+		assert.Equal(t, "true", string(res.Header.Peek("X-Meta")), uri)
+		assert.Equal(t, "assets", string(res.Header.Peek("X-Route")), uri)
+	}
+	assert.Equal(t, "/assets", router.Route("assets").Path())
+}
+
+func TestRouteGroupStaticFS(t *testing.T) {
+	dist := fstest.MapFS{
+		"index.html":     {Data: []byte("spa")},
+		"assets/app.css": {Data: []byte("body{}")},
+	}
+	router := New()
+	router.Get("/api/users", func(c *Ctx) error {
+		_, err := c.WriteString("users")
+		return err
+	})
+	router.StaticFS("/", dist, &StaticConfig{SPA: true})
+	client := router.TestClient()
+
+	res, _ := client.Get("/").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "spa", string(res.Body()))
+	res, _ = client.Get("/assets/app.css").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "body{}", string(res.Body()))
+	res, _ = client.Get("/api/users").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "users", string(res.Body()))
+
+	// paths of the frontend router fall back to index.html, unknown assets do not
+	router = New()
+	router.StaticFS("/", dist, nil)
+	res, _ = router.TestClient().Get("/").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "spa", string(res.Body()))
+	res, _ = client.Get("/users/1").Do()
+	assert.Equal(t, StatusOK, res.StatusCode())
+	assert.Equal(t, "spa", string(res.Body()))
+	res, _ = client.Get("/assets/missing.css").Do()
+	assert.Equal(t, StatusNotFound, res.StatusCode())
+}
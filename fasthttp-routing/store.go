@@ -14,7 +14,8 @@ import (
 // store is a radix tree that supports storing data with parametric keys and retrieving them back with concrete keys.
 // When retrieving a data item with a concrete key, the matching parameter names and values will be returned as well.
 // A parametric key is a string containing tokens in the format of "<name>", "<name:pattern>", or "<:pattern>".
-// Each token represents a single parameter.
+// Each token represents a single parameter. A pattern that is the name of a registered ParamMatcher
+// (e.g. "<id:int>") is matched by the matcher instead of a regular expression.
 type store struct {
 	root  *node // the root node of the radix tree
 	count int   // the number of data nodes in the tree
@@ -67,9 +68,10 @@ type node struct {
 	children  []*node // child static nodes, indexed by the first byte of each child key
 	pchildren []*node // child param nodes
 
-	regex  *regexp.Regexp // regular expression for a param node containing regular expression key
-	pindex int            // the parameter index, meaningful only for param node
-	pnames []string       // the parameter names collected from the root till this node
+	regex   *regexp.Regexp // regular expression for a param node containing regular expression key
+	matcher ParamMatcher   // matcher for a param node whose pattern is the name of a registered ParamMatcher
+	pindex  int            // the parameter index, meaningful only for param node
+	pnames  []string       // the parameter names collected from the root till this node
 }
 
 // ! fdf [[node]] [[type node struct]]
@@ -199,7 +201,10 @@ func (n *node) addChild(key string, data interface{}, order int) int {
 			break
 		}
 	}
-	if pattern != "" {
+	if m, ok := matchers[pattern]; ok {
+		// the param token names a ParamMatcher
+		child.matcher = m
+	} else if pattern != "" {
 		// the param token contains a regular expression
 		child.regex = regexp.MustCompile("^" + pattern)
 	}
@@ -239,6 +244,14 @@ repeat:
 			}
 		}
 		key = key[nkl:]
+	} else if n.matcher != nil {
+		// param node with ParamMatcher
+		l := n.matcher(key)
+		if l < 0 {
+			return
+		}
+		pvalues[n.pindex] = key[:l]
+		key = key[l:]
 	} else if n.regex != nil {
 		// param node with regular expression
 		if n.regex.String() == "^.*" {
@@ -162,3 +162,33 @@ func TestStoreGet(t *testing.T) {
 		assert.Equal(t, test.params, params, "store.Get("+test.key+").params =")
 	}
 }
+
+func benchmarkStoreGet(b *testing.B, key, path string) {
+	h := newStore()
+	h.Add("/users/<id>/profile", "1")
+	h.Add(key, "2")
+	pvalues := make([]string, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if data, _ := h.Get(path, pvalues); data == nil {
+			b.Fatal("no match for " + path)
+		}
+	}
+}
+
+func BenchmarkStoreGetIntRegexp(b *testing.B) {
+	benchmarkStoreGet(b, `/users/<id:\d+>/orders/<order:\d+>`, "/users/12345/orders/678901")
+}
+
+func BenchmarkStoreGetIntMatcher(b *testing.B) {
+	benchmarkStoreGet(b, "/users/<id:int>/orders/<order:int>", "/users/12345/orders/678901")
+}
+
+func BenchmarkStoreGetUUIDRegexp(b *testing.B) {
+	benchmarkStoreGet(b, `/objects/<id:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}>`, "/objects/123e4567-e89b-12d3-a456-426614174000")
+}
+
+func BenchmarkStoreGetUUIDMatcher(b *testing.B) {
+	benchmarkStoreGet(b, "/objects/<id:uuid>", "/objects/123e4567-e89b-12d3-a456-426614174000")
+}
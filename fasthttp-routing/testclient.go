@@ -0,0 +1,260 @@
+package routing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/newacorn/fasthttp"
+	"github.com/pkg/errors"
+)
+
+// TestClient sends requests to a fasthttp.Server over an in-memory connection.
+// Cookies set by responses are kept in Jar and sent with the following requests,
+// so a sequence of calls behaves like a browser session against a single host.
+//
+//	client := router.TestClient()
+//	client.Post("/login").JSON(credentials).Do()
+//	res, err := client.Get("/profile").Do()
+//	routingtest.Expect(t, res).Status(http.StatusOK).JSON(map[string]any{"name": "acorn"})
+type TestClient struct {
+	server *fasthttp.Server
+	// Jar 保存响应设置的 cookie，按名称索引
+	// 过期或被清空的 cookie 会被移除
+	Jar map[string]*fasthttp.Cookie
+	// Timeout 单个请求的超时时间，默认为 1 秒；小于 0 表示不超时
+	Timeout time.Duration
+}
+
+// NewTestClient returns a TestClient serving requests with the given server.
+// The server is used as is: its Handler, ErrorHandler, limits and other options all take effect.
+func NewTestClient(server *fasthttp.Server) *TestClient {
+	return &TestClient{
+		server:  server,
+		Jar:     make(map[string]*fasthttp.Cookie),
+		Timeout: time.Second,
+	}
+}
+
+// TestClient returns a TestClient that serves requests with the router.
+// If a server is provided, its Handler is set to the router when it is nil,
+// otherwise a server with default options is used.
+func (r *Router) TestClient(server ...*fasthttp.Server) *TestClient {
+	s := &fasthttp.Server{}
+	if len(server) > 0 {
+		s = server[0]
+	}
+	if s.Handler == nil {
+		s.Handler = r.HandleRequest
+	}
+	return NewTestClient(s)
+}
+
+// Get starts a GET request.
+func (tc *TestClient) Get(uri string) *TestRequest { return tc.Request(MethodGet, uri) }
+
+// Head starts a HEAD request.
+func (tc *TestClient) Head(uri string) *TestRequest { return tc.Request(MethodHead, uri) }
+
+// Post starts a POST request.
+func (tc *TestClient) Post(uri string) *TestRequest { return tc.Request(MethodPost, uri) }
+
+// Put starts a PUT request.
+func (tc *TestClient) Put(uri string) *TestRequest { return tc.Request(MethodPut, uri) }
+
+// Patch starts a PATCH request.
+func (tc *TestClient) Patch(uri string) *TestRequest { return tc.Request(MethodPatch, uri) }
+
+// Delete starts a DELETE request.
+func (tc *TestClient) Delete(uri string) *TestRequest { return tc.Request(MethodDelete, uri) }
+
+// Request starts a request with the given method and uri.
+// The uri may be a path with query string, or an absolute url whose host is used as the Host header.
+func (tc *TestClient) Request(method, uri string) *TestRequest {
+	req := &TestRequest{client: tc, cookies: make(map[string]string)}
+	req.req.Header.SetMethod(method)
+	req.req.SetRequestURI(uri)
+	// a Host header set with TestRequest.Header must not be overwritten by the host of the uri
+	req.req.UseHostHeader = true
+	if host := req.req.Host(); len(host) > 0 {
+		req.req.Header.SetHostBytes(host)
+	} else {
+		req.req.Header.SetHost("localhost")
+	}
+	return req
+}
+
+// TestRequest is a request under construction, see TestClient.
+type TestRequest struct {
+	client  *TestClient
+	req     fasthttp.Request
+	cookies map[string]string
+	raddr   net.Addr
+	tls     bool
+	// 构建请求过程中的第一个错误，由 Do 返回
+	err error
+}
+
+// Header sets a request header.
+func (r *TestRequest) Header(key, value string) *TestRequest {
+	r.req.Header.Set(key, value)
+	return r
+}
+
+// Cookie sets a request cookie. It takes precedence over the cookie with the same name in the jar.
+func (r *TestRequest) Cookie(key, value string) *TestRequest {
+	r.cookies[key] = value
+	return r
+}
+
+// Body sets the request body.
+func (r *TestRequest) Body(body []byte) *TestRequest {
+	r.req.SetBody(body)
+	return r
+}
+
+// Form sets the request body to the url encoded form and the Content-Type accordingly.
+func (r *TestRequest) Form(values map[string]string) *TestRequest {
+	args := fasthttp.AcquireArgs()
+	defer fasthttp.ReleaseArgs(args)
+	for k, v := range values {
+		args.Add(k, v)
+	}
+	r.req.Header.SetContentType(MIMEApplicationForm)
+	r.req.SetBody(args.QueryString())
+	return r
+}
+
+// JSON sets the request body to the JSON encoding of v and the Content-Type accordingly.
+func (r *TestRequest) JSON(v any) *TestRequest {
+	b, err := json.Marshal(v)
+	if err != nil && r.err == nil {
+		r.err = errors.WithMessage(err, "test: failed to encode json body:")
+	}
+	r.req.Header.SetContentType(MIMEApplicationJSON)
+	r.req.SetBody(b)
+	return r
+}
+
+// RemoteIP sets the address of the connection the request is sent over.
+// The ip may carry a port, as in "10.0.0.1:8080" or "[::1]:8080".
+func (r *TestRequest) RemoteIP(ip string) *TestRequest {
+	port := 1024
+	if host, p, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+		port, _ = strconv.Atoi(p)
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+	if addr.IP == nil && r.err == nil {
+		r.err = fmt.Errorf("test: invalid remote ip %q", ip)
+	}
+	r.raddr = addr
+	return r
+}
+
+// TLS makes the request be sent over a connection recognized as TLS by fasthttp.RequestCtx.IsTLS.
+func (r *TestRequest) TLS() *TestRequest {
+	r.tls = true
+	return r
+}
+
+// Do sends the request and reads the response.
+func (r *TestRequest) Do() (*TestResponse, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	tc := r.client
+	for k, c := range tc.Jar {
+		if _, ok := r.cookies[k]; !ok {
+			r.req.Header.SetCookieBytesKV(c.Key(), c.Value())
+		}
+	}
+	for k, v := range r.cookies {
+		r.req.Header.SetCookie(k, v)
+	}
+
+	conn := &testConn{raddr: r.raddr}
+	if _, err := r.req.WriteTo(&conn.r); err != nil {
+		return nil, errors.WithMessage(err, "test: failed to write request:")
+	}
+	var c net.Conn = conn
+	if r.tls {
+		c = testTLSConn{conn}
+	}
+
+	channel := make(chan error, 1)
+	go func() {
+		var returned bool
+		defer func() {
+			if !returned {
+				channel <- fmt.Errorf("runtime.Goexit() called in handler or server panic")
+			}
+		}()
+		channel <- tc.server.ServeConn(c)
+		returned = true
+	}()
+	var err error
+	if tc.Timeout >= 0 {
+		select {
+		case err = <-channel:
+		case <-time.After(tc.Timeout):
+			return nil, fmt.Errorf("test: timeout error %v", tc.Timeout)
+		}
+	} else {
+		err = <-channel
+	}
+	if err != nil && !errors.Is(err, fasthttp.ErrGetOnly) {
+		return nil, err
+	}
+
+	res := &TestResponse{}
+	res.SkipBody = r.req.Header.IsHead()
+	// the whole response is buffered, so its headers are read however large they are
+	if err = res.Read(bufio.NewReaderSize(&conn.w, conn.w.Len())); err != nil {
+		return nil, errors.WithMessage(err, "test: failed to read response:")
+	}
+	tc.storeCookies(&res.Response)
+	return res, nil
+}
+
+// storeCookies updates the jar with the cookies set by the response.
+func (tc *TestClient) storeCookies(res *fasthttp.Response) {
+	now := time.Now()
+	res.Header.VisitAllCookie(func(key, value []byte) {
+		c := &fasthttp.Cookie{}
+		if c.ParseBytes(value) != nil {
+			return
+		}
+		expire := c.Expire()
+		if len(c.Value()) == 0 || c.MaxAge() < 0 ||
+			expire != fasthttp.CookieExpireUnlimited && expire.Before(now) {
+			delete(tc.Jar, string(key))
+			return
+		}
+		tc.Jar[string(key)] = c
+	})
+}
+
+// TestResponse is the response read by TestRequest.Do.
+// See package routingtest for assertions on it.
+type TestResponse struct {
+	fasthttp.Response
+}
+
+// Cookie returns the cookie with the given name set by the response, nil if there is none.
+func (r *TestResponse) Cookie(key string) *fasthttp.Cookie {
+	c := &fasthttp.Cookie{}
+	c.SetKey(key)
+	if !r.Header.Cookie(c) {
+		return nil
+	}
+	return c
+}
+
+// DecodeJSON decodes the response body into v.
+func (r *TestResponse) DecodeJSON(v any) error {
+	return json.Unmarshal(r.Body(), v)
+}
@@ -416,6 +416,10 @@ type Server struct {
 	concurrencyCh    chan struct{}
 	perIPConnCounter perIPConnCounter
 
+	// connections rejected because of Concurrency and MaxConnsPerIP.
+	concurrencyRejected uint64
+	perIPRejected       uint64
+
 	ctxPool        sync.Pool
 	readerPool     sync.Pool
 	writerPool     sync.Pool
@@ -1828,6 +1832,7 @@ func (s *Server) Serve(ln net.Listener) error {
 		atomic.AddInt32(&s.open, 1)
 		if !wp.Serve(c) {
 			atomic.AddInt32(&s.open, -1)
+			atomic.AddUint64(&s.concurrencyRejected, 1)
 			s.writeFastError(c, StatusServiceUnavailable,
 				"The connection cannot be served because Server.Concurrency limit exceeded")
 			c.Close()
@@ -1977,6 +1982,7 @@ func wrapPerIPConn(s *Server, c net.Conn) net.Conn {
 	n := s.perIPConnCounter.Register(ip)
 	if n > s.MaxConnsPerIP {
 		s.perIPConnCounter.Unregister(ip)
+		atomic.AddUint64(&s.perIPRejected, 1)
 		s.writeFastError(c, StatusTooManyRequests, "The number of connections from your ip exceeds MaxConnsPerIP")
 		c.Close()
 		return nil
@@ -2024,6 +2030,7 @@ func (s *Server) ServeConn(c net.Conn) error {
 	n := atomic.AddUint32(&s.concurrency, 1)
 	if n > uint32(s.getConcurrency()) {
 		atomic.AddUint32(&s.concurrency, ^uint32(0))
+		atomic.AddUint64(&s.concurrencyRejected, 1)
 		s.writeFastError(c, StatusServiceUnavailable, "The connection cannot be served because Server.Concurrency limit exceeded")
 		c.Close()
 		return ErrConcurrencyLimit
@@ -2058,6 +2065,22 @@ func (s *Server) GetCurrentConcurrency() uint32 {
 	return atomic.LoadUint32(&s.concurrency)
 }
 
+// GetRejectedConnectionsCount returns the number of connections rejected
+// because Server.Concurrency connections were being served.
+//
+// This function is intended be used by monitoring systems.
+func (s *Server) GetRejectedConnectionsCount() uint64 {
+	return atomic.LoadUint64(&s.concurrencyRejected)
+}
+
+// GetPerIPRejectedConnectionsCount returns the number of connections rejected
+// because of Server.MaxConnsPerIP.
+//
+// This function is intended be used by monitoring systems.
+func (s *Server) GetPerIPRejectedConnectionsCount() uint64 {
+	return atomic.LoadUint64(&s.perIPRejected)
+}
+
 // GetOpenConnectionsCount returns a number of opened connections.
 //
 // This function is intended be used by monitoring systems.
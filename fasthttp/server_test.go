@@ -1005,6 +1005,10 @@ func TestServerConcurrencyLimit(t *testing.T) {
 		t.Fatal("timeout")
 	}
 
+	if n := s.GetRejectedConnectionsCount(); n != 1 {
+		t.Fatalf("unexpected number of rejected connections: %d. Expecting 1", n)
+	}
+
 	if err := ln.Close(); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1 +1,99 @@
 package utilcrypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"hash"
+	"sync"
+)
+
+// HMACTagLen is the length of the tag appended by HMACHash, the first 16 bytes of the HMAC-SHA256.
+const HMACTagLen = 16
+
+// MinHMACKeyLen is the minimum length of the keys of HMACHash.
+const MinHMACKeyLen = 32
+
+// HMACHash authenticates tokens with a truncated HMAC-SHA256 tag, which cannot be forged
+// without the key. Tokens tagged with one of the old keys are still accepted, so that the
+// key can be rotated without invalidating the tokens issued before.
+type HMACHash struct {
+	// macs[0] 签名使用的密钥，其余为轮换前的旧密钥，仅用于验证
+	macs []sync.Pool
+}
+
+// NewHMACHash creates an HMACHash tagging tokens with key, and accepting the tokens tagged
+// with key or one of oldKeys. It panics if a key is shorter than MinHMACKeyLen.
+func NewHMACHash(key []byte, oldKeys ...[]byte) *HMACHash {
+	keys := append([][]byte{key}, oldKeys...)
+	h := &HMACHash{macs: make([]sync.Pool, len(keys))}
+	for i, k := range keys {
+		if len(k) < MinHMACKeyLen {
+			panic("utilcrypt: HMAC key must be at least 32 bytes")
+		}
+		k := append([]byte(nil), k...)
+		h.macs[i].New = func() any {
+			return hmac.New(sha256.New, k)
+		}
+	}
+	return h
+}
+
+// RandomKey returns n bytes from crypto/rand, e.g. a key for NewHMACHash.
+func RandomKey(n int) []byte {
+	key := make([]byte, n)
+	DefaultRandomBytesGenerator(key)
+	return key
+}
+
+// sum writes the tag of msg under the i-th key to tag.
+func (h *HMACHash) sum(i int, msg []byte, tag *[sha256.Size]byte) {
+	mac := h.macs[i].Get().(hash.Hash)
+	mac.Reset()
+	mac.Write(msg)
+	mac.Sum(tag[:0])
+	h.macs[i].Put(mac)
+}
+
+// AppendHash writes the tag of bs[:len(bs)-HMACTagLen] to the last HMACTagLen bytes of bs.
+func (h *HMACHash) AppendHash(bs []byte) {
+	if len(bs) <= HMACTagLen {
+		panic("len(bs) at least 17.")
+	}
+	var tag [sha256.Size]byte
+	n := len(bs) - HMACTagLen
+	h.sum(0, bs[:n], &tag)
+	copy(bs[n:], tag[:HMACTagLen])
+}
+
+// ValidateHash reports whether bs ends with the tag of the rest of bs, under the current key
+// or one of the old keys.
+func (h *HMACHash) ValidateHash(bs []byte) bool {
+	if len(bs) <= HMACTagLen {
+		return false
+	}
+	var tag [sha256.Size]byte
+	n := len(bs) - HMACTagLen
+	for i := range h.macs {
+		h.sum(i, bs[:n], &tag)
+		if hmac.Equal(bs[n:], tag[:HMACTagLen]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HMACHash) EncodedLen(input int) (output int) {
+	return input + HMACTagLen
+}
+
+func (h *HMACHash) DecodedLen(input int) (output int) {
+	return input - HMACTagLen
+}
+
+// mustRead fills bs from crypto/rand. A failure of the system random source is not recoverable.
+func mustRead(bs []byte) {
+	if _, err := rand.Read(bs); err != nil {
+		panic("utilcrypt: crypto/rand failed: " + err.Error())
+	}
+}
@@ -0,0 +1,41 @@
+package utilcrypt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHMACHash(t *testing.T) {
+	oldKey := RandomKey(32)
+	old := NewHMACHash(oldKey)
+	h := NewHMACHash(RandomKey(32), oldKey)
+
+	token := make([]byte, h.EncodedLen(30))
+	DefaultRandomBytesGenerator(token[:30])
+	h.AppendHash(token)
+	assert.True(t, h.ValidateHash(token))
+	assert.False(t, old.ValidateHash(token))
+
+	// tokens of the old key are accepted after the rotation
+	oldToken := make([]byte, old.EncodedLen(30))
+	DefaultRandomBytesGenerator(oldToken[:30])
+	old.AppendHash(oldToken)
+	assert.True(t, h.ValidateHash(oldToken))
+
+	forged := bytes.Clone(token)
+	forged[0] ^= 1
+	assert.False(t, h.ValidateHash(forged))
+	assert.False(t, h.ValidateHash(token[:HMACTagLen]))
+	assert.False(t, NewHMACHash(RandomKey(32)).ValidateHash(token))
+	assert.Panics(t, func() { NewHMACHash(make([]byte, 16)) })
+}
+
+func TestDefaultRandomBytesGenerator(t *testing.T) {
+	a, b := make([]byte, 13), make([]byte, 13)
+	DefaultRandomBytesGenerator(a)
+	DefaultRandomBytesGenerator(b)
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, make([]byte, 13), a)
+}
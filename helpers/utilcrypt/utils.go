@@ -2,32 +2,28 @@ package utilcrypt
 
 import (
 	"encoding/binary"
-	"math/rand"
-	"unsafe"
+	_ "unsafe" // for go:linkname
 )
 
 type RandomBytesGenerator func(bs []byte)
 
+// DefaultRandomBytesGenerator fills bs from crypto/rand, it panics if the system random source fails.
 func DefaultRandomBytesGenerator(bs []byte) {
-	size := len(bs)
-	for i := 0; i < size/8; i++ {
-		r1 := rand.Uint64()
-		b1 := (*[8]byte)((unsafe.Pointer)(&r1))
-		copy(bs[i*8:], b1[:])
-	}
-	if size%8 > 0 {
-		r2 := rand.Uint64()
-		b2 := (*[8]byte)((unsafe.Pointer)(&r2))
-		copy(bs[:size-size%8], b2[:])
-	}
+	mustRead(bs)
 }
 
+// BytesWithHash appends a tag to the end of tokens and validates it. The tag takes
+// EncodedLen(n)-n bytes at the end of a token of n bytes.
 type BytesWithHash interface {
 	AppendHash(bs []byte)
 	ValidateHash(bs []byte) bool
 	EncodedLen(input int) (output int)
 	DecodedLen(input int) (output int)
 }
+
+// SimpleHash appends a 2-byte checksum, which detects typos but anyone can compute.
+//
+// Deprecated: use HMACHash to authenticate tokens.
 type SimpleHash struct {
 }
 
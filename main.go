@@ -2,18 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"flag"
 	"log"
+	"os"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	routing "fasthttp-routing"
+	"fasthttp-routing/middleware/accesslog"
+	"fasthttp-routing/middleware/trace"
 	"github.com/newacorn/fasthttp"
 	"helpers/unsafefn"
 )
@@ -41,24 +47,56 @@ type WxTokenResponseError struct {
 
 var tokenReady = make(chan struct{})
 
-func init() {
-	go updateToken()
-}
+var dumpRoutes = flag.Bool("routes", false, "print the route table and exit")
+
 func main() {
-	<-tokenReady
+	flag.Parse()
+	r := newRouter()
+	if *dumpRoutes {
+		if err := r.WriteRoutes(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := r.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	refresherDone := make(chan struct{})
+	r.OnStart(func() error {
+		go func() {
+			updateToken(ctx)
+			close(refresherDone)
+		}()
+		<-tokenReady
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		stop()
+		select {
+		case <-refresherDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err := r.Listen(":80"); err != nil {
+		log.Fatal(err)
+	}
+}
+func newRouter() *routing.Router {
 	r := routing.New()
+	r.Use(accesslog.New(), trace.New())
 	r.Get("/wx", handleSerVerify)
 	r.Post("/wx", copyUserMessage)
 	r.Get("/token", GetToken)
 
 	r.Post("/", func(ctx *routing.Ctx) error {
-		log.Println(ctx.Request.URI().String())
-		log.Println(string(ctx.Request.Body()))
+		ctx.Log().Info().Str("uri", ctx.Request.URI().String()).Bytes("body", ctx.Request.Body()).Msg("callback")
 		_, _ = ctx.WriteString("success")
 		return nil
 	})
-	server := fasthttp.Server{Handler: r.HandleRequest}
-	log.Fatal(server.ListenAndServe(":80"))
+	return r
 }
 func handleSerVerify(ctx *routing.Ctx) (err error) {
 	args := ctx.URI().QueryArgs()
@@ -146,19 +184,28 @@ func requestWxToken() (token string, err error) {
 	return ok.AccessToken, nil
 }
 
-func updateToken() {
-	t := time.Timer{}
-	time.NewTimer(time.Second * 270)
+// updateToken refreshes WxToken every 270 seconds, and retries every 10 seconds after a failure,
+// until ctx is done. tokenReady is closed once the first token is stored.
+func updateToken(ctx context.Context) {
+	var ready sync.Once
 	for {
+		wait := time.Second * 270
 		token, err := requestWxToken()
 		if err != nil {
 			// WxToken.Store("")
 			log.Println(err)
+			wait = time.Second * 10
 		} else {
 			WxToken.Store(token)
-			tokenReady <- struct{}{}
+			ready.Do(func() { close(tokenReady) })
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
 		}
-		<-t.C
 	}
 }
 